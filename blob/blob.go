@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps binary objects such as attachment images under string keys.
+type Store interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// FileStore is a Store that keeps every object as a file in Dir.
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) Put(key string, r io.Reader) (err error) {
+	err = os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *FileStore) Get(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *FileStore) Delete(key string) (err error) {
+	err = os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.Base(key))
+}
@@ -0,0 +1,181 @@
+package category
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	Produce   = "produce"
+	Dairy     = "dairy"
+	Bakery    = "bakery"
+	Meat      = "meat"
+	Fish      = "fish"
+	Frozen    = "frozen"
+	Pantry    = "pantry"
+	Snacks    = "snacks"
+	Beverages = "beverages"
+	Household = "household"
+	Personal  = "personal care"
+	Baby      = "baby"
+	Pets      = "pets"
+	Other     = "other"
+)
+
+// dictionary maps item names in English, German, French, Spanish, Italian and
+// Dutch to the aisle they are usually found in.
+var dictionary = map[string]string{
+	// produce
+	"apple": Produce, "apfel": Produce, "äpfel": Produce, "pomme": Produce, "manzana": Produce, "mela": Produce, "appel": Produce,
+	"banana": Produce, "banane": Produce, "plátano": Produce, "banaan": Produce,
+	"orange": Produce, "naranja": Produce, "arancia": Produce, "sinaasappel": Produce,
+	"lemon": Produce, "zitrone": Produce, "citron": Produce, "limón": Produce, "limone": Produce, "citroen": Produce,
+	"lime": Produce, "limette": Produce,
+	"grape": Produce, "trauben": Produce, "raisin": Produce, "uva": Produce, "druiven": Produce,
+	"strawberry": Produce, "strawberries": Produce, "erdbeere": Produce, "erdbeeren": Produce, "fraise": Produce, "fresa": Produce, "fragola": Produce, "aardbei": Produce,
+	"berries": Produce, "beeren": Produce, "blueberries": Produce, "heidelbeeren": Produce,
+	"pear": Produce, "birne": Produce, "poire": Produce, "pera": Produce, "peer": Produce,
+	"avocado": Produce, "mango": Produce, "pineapple": Produce, "ananas": Produce, "melon": Produce, "melone": Produce, "kiwi": Produce,
+	"tomato": Produce, "tomatoes": Produce, "tomate": Produce, "tomaten": Produce, "pomodoro": Produce, "pomodori": Produce,
+	"potato": Produce, "potatoes": Produce, "kartoffel": Produce, "kartoffeln": Produce, "pomme de terre": Produce, "patata": Produce, "aardappel": Produce,
+	"onion": Produce, "zwiebel": Produce, "zwiebeln": Produce, "oignon": Produce, "cebolla": Produce, "cipolla": Produce, "ui": Produce, "uien": Produce,
+	"garlic": Produce, "knoblauch": Produce, "ail": Produce, "ajo": Produce, "aglio": Produce, "knoflook": Produce,
+	"carrot": Produce, "karotte": Produce, "karotten": Produce, "möhre": Produce, "möhren": Produce, "carotte": Produce, "zanahoria": Produce, "carota": Produce, "wortel": Produce,
+	"lettuce": Produce, "salad": Produce, "salat": Produce, "salade": Produce, "lechuga": Produce, "insalata": Produce, "sla": Produce,
+	"cucumber": Produce, "gurke": Produce, "concombre": Produce, "pepino": Produce, "cetriolo": Produce, "komkommer": Produce,
+	"pepper": Produce, "paprika": Produce, "poivron": Produce, "pimiento": Produce, "peperone": Produce,
+	"zucchini": Produce, "courgette": Produce, "calabacín": Produce,
+	"broccoli": Produce, "brokkoli": Produce, "brócoli": Produce,
+	"spinach": Produce, "spinat": Produce, "épinards": Produce, "espinacas": Produce, "spinaci": Produce, "spinazie": Produce,
+	"mushroom": Produce, "mushrooms": Produce, "pilze": Produce, "champignons": Produce, "champignon": Produce, "champiñones": Produce, "funghi": Produce,
+	"herbs": Produce, "kräuter": Produce, "basil": Produce, "basilikum": Produce, "parsley": Produce, "petersilie": Produce, "mint": Produce, "minze": Produce,
+	"ginger": Produce, "ingwer": Produce, "gingembre": Produce, "jengibre": Produce, "zenzero": Produce, "gember": Produce,
+
+	// dairy
+	"milk": Dairy, "milch": Dairy, "lait": Dairy, "leche": Dairy, "latte": Dairy, "melk": Dairy,
+	"butter": Dairy, "beurre": Dairy, "mantequilla": Dairy, "burro": Dairy, "boter": Dairy,
+	"cheese": Dairy, "käse": Dairy, "fromage": Dairy, "queso": Dairy, "formaggio": Dairy, "kaas": Dairy,
+	"yogurt": Dairy, "yoghurt": Dairy, "joghurt": Dairy, "yaourt": Dairy, "yogur": Dairy,
+	"cream": Dairy, "sahne": Dairy, "crème": Dairy, "nata": Dairy, "panna": Dairy,
+	"quark": Dairy, "mozzarella": Dairy, "parmesan": Dairy, "feta": Dairy,
+	"eggs": Dairy, "egg": Dairy, "eier": Dairy, "ei": Dairy, "œufs": Dairy, "oeufs": Dairy, "huevos": Dairy, "uova": Dairy, "eieren": Dairy,
+
+	// bakery
+	"bread": Bakery, "brot": Bakery, "pain": Bakery, "pane": Bakery, "brood": Bakery,
+	"rolls": Bakery, "brötchen": Bakery, "semmeln": Bakery, "baguette": Bakery, "croissant": Bakery, "croissants": Bakery,
+	"toast": Bakery, "bagel": Bakery, "bagels": Bakery, "cake": Bakery, "kuchen": Bakery, "gâteau": Bakery, "pastel": Bakery, "torta": Bakery, "taart": Bakery,
+
+	// meat and fish
+	"chicken": Meat, "hähnchen": Meat, "hühnchen": Meat, "poulet": Meat, "pollo": Meat, "kip": Meat,
+	"beef": Meat, "rindfleisch": Meat, "boeuf": Meat, "bœuf": Meat, "ternera": Meat, "manzo": Meat, "rundvlees": Meat,
+	"pork": Meat, "schweinefleisch": Meat, "porc": Meat, "cerdo": Meat, "maiale": Meat, "varkensvlees": Meat,
+	"mince": Meat, "hackfleisch": Meat, "ground beef": Meat, "bacon": Meat, "speck": Meat, "ham": Meat, "schinken": Meat, "jambon": Meat, "jamón": Meat, "prosciutto": Meat,
+	"sausage": Meat, "sausages": Meat, "wurst": Meat, "würstchen": Meat, "saucisse": Meat, "salchicha": Meat, "salsiccia": Meat, "worst": Meat,
+	"salami": Meat, "steak": Meat, "meat": Meat, "fleisch": Meat, "viande": Meat, "carne": Meat, "vlees": Meat,
+	"fish": Fish, "fisch": Fish, "poisson": Fish, "pescado": Fish, "pesce": Fish, "vis": Fish,
+	"salmon": Fish, "lachs": Fish, "saumon": Fish, "salmón": Fish, "salmone": Fish, "zalm": Fish,
+	"tuna": Fish, "thunfisch": Fish, "thon": Fish, "atún": Fish, "tonno": Fish, "tonijn": Fish,
+	"shrimp": Fish, "prawns": Fish, "garnelen": Fish, "crevettes": Fish, "gambas": Fish, "gamberi": Fish, "garnalen": Fish,
+
+	// frozen
+	"ice cream": Frozen, "eis": Frozen, "glace": Frozen, "helado": Frozen, "gelato": Frozen, "ijs": Frozen,
+	"frozen": Frozen, "tiefkühl": Frozen, "surgelé": Frozen, "congelado": Frozen, "surgelati": Frozen, "diepvries": Frozen,
+	"pizza": Frozen, "fries": Frozen,
+
+	// pantry
+	"rice": Pantry, "reis": Pantry, "riz": Pantry, "arroz": Pantry, "riso": Pantry, "rijst": Pantry,
+	"pasta": Pantry, "nudeln": Pantry, "spaghetti": Pantry, "pâtes": Pantry, "noodles": Pantry,
+	"flour": Pantry, "mehl": Pantry, "farine": Pantry, "harina": Pantry, "farina": Pantry, "bloem": Pantry,
+	"sugar": Pantry, "zucker": Pantry, "sucre": Pantry, "azúcar": Pantry, "zucchero": Pantry, "suiker": Pantry,
+	"salt": Pantry, "salz": Pantry, "sel": Pantry, "sal": Pantry, "zout": Pantry,
+	"oil": Pantry, "öl": Pantry, "huile": Pantry, "aceite": Pantry, "olio": Pantry, "olie": Pantry,
+	"vinegar": Pantry, "essig": Pantry, "vinaigre": Pantry, "vinagre": Pantry, "aceto": Pantry, "azijn": Pantry,
+	"honey": Pantry, "honig": Pantry, "miel": Pantry, "miele": Pantry, "honing": Pantry,
+	"jam": Pantry, "marmelade": Pantry, "konfitüre": Pantry, "confiture": Pantry, "mermelada": Pantry, "marmellata": Pantry,
+	"cereal": Pantry, "müsli": Pantry, "muesli": Pantry, "cornflakes": Pantry, "oats": Pantry, "haferflocken": Pantry,
+	"coffee": Pantry, "kaffee": Pantry, "café": Pantry, "caffè": Pantry, "koffie": Pantry,
+	"tea": Pantry, "tee": Pantry, "thé": Pantry, "té": Pantry, "tè": Pantry, "thee": Pantry,
+	"beans": Pantry, "bohnen": Pantry, "haricots": Pantry, "frijoles": Pantry, "fagioli": Pantry, "bonen": Pantry,
+	"lentils": Pantry, "linsen": Pantry, "lentilles": Pantry, "lentejas": Pantry, "lenticchie": Pantry,
+	"sauce": Pantry, "soße": Pantry, "salsa": Pantry, "ketchup": Pantry, "mustard": Pantry, "senf": Pantry, "moutarde": Pantry, "mayonnaise": Pantry,
+	"spices": Pantry, "gewürze": Pantry, "épices": Pantry, "especias": Pantry, "spezie": Pantry, "kruiden": Pantry,
+
+	// snacks
+	"chips": Snacks, "crisps": Snacks, "chocolate": Snacks, "schokolade": Snacks, "chocolat": Snacks, "cioccolato": Snacks, "chocolade": Snacks,
+	"cookies": Snacks, "kekse": Snacks, "biscuits": Snacks, "galletas": Snacks, "biscotti": Snacks, "koekjes": Snacks,
+	"nuts": Snacks, "nüsse": Snacks, "noix": Snacks, "nueces": Snacks, "noci": Snacks, "noten": Snacks,
+	"candy": Snacks, "sweets": Snacks, "süßigkeiten": Snacks, "bonbons": Snacks, "gummibärchen": Snacks, "popcorn": Snacks,
+
+	// beverages
+	"water": Beverages, "wasser": Beverages, "eau": Beverages, "agua": Beverages, "acqua": Beverages,
+	"juice": Beverages, "saft": Beverages, "jus": Beverages, "zumo": Beverages, "succo": Beverages, "sap": Beverages,
+	"beer": Beverages, "bier": Beverages, "bière": Beverages, "cerveza": Beverages, "birra": Beverages,
+	"wine": Beverages, "wein": Beverages, "vin": Beverages, "vino": Beverages, "wijn": Beverages,
+	"soda": Beverages, "cola": Beverages, "lemonade": Beverages, "limonade": Beverages, "sprudel": Beverages,
+
+	// household
+	"toilet paper": Household, "klopapier": Household, "toilettenpapier": Household, "papier toilette": Household, "papel higiénico": Household, "carta igienica": Household, "wc-papier": Household,
+	"paper towels": Household, "küchenrolle": Household, "detergent": Household, "waschmittel": Household, "lessive": Household, "detergente": Household, "wasmiddel": Household,
+	"dish soap": Household, "spülmittel": Household, "liquide vaisselle": Household, "lavavajillas": Household,
+	"trash bags": Household, "müllbeutel": Household, "sacs poubelle": Household, "bolsas de basura": Household,
+	"sponge": Household, "schwamm": Household, "éponge": Household, "esponja": Household, "spugna": Household,
+	"batteries": Household, "batterien": Household, "piles": Household, "pilas": Household, "batterie": Household,
+	"foil": Household, "alufolie": Household, "frischhaltefolie": Household, "candles": Household, "kerzen": Household, "bougies": Household, "velas": Household,
+
+	// personal care
+	"shampoo": Personal, "soap": Personal, "seife": Personal, "savon": Personal, "jabón": Personal, "sapone": Personal, "zeep": Personal,
+	"toothpaste": Personal, "zahnpasta": Personal, "dentifrice": Personal, "pasta de dientes": Personal, "dentifricio": Personal, "tandpasta": Personal,
+	"toothbrush": Personal, "zahnbürste": Personal, "deodorant": Personal, "deo": Personal, "déodorant": Personal, "desodorante": Personal,
+	"shower gel": Personal, "duschgel": Personal, "gel douche": Personal, "razor": Personal, "rasierer": Personal, "sunscreen": Personal, "sonnencreme": Personal,
+	"tissues": Personal, "taschentücher": Personal, "mouchoirs": Personal, "pañuelos": Personal,
+
+	// baby and pets
+	"diapers": Baby, "nappies": Baby, "windeln": Baby, "couches": Baby, "pañales": Baby, "pannolini": Baby, "luiers": Baby, "baby food": Baby, "babynahrung": Baby,
+	"cat food": Pets, "katzenfutter": Pets, "dog food": Pets, "hundefutter": Pets, "croquettes": Pets, "cat litter": Pets, "katzenstreu": Pets,
+}
+
+// Infer guesses the aisle of an item from its name using the built-in
+// dictionary. Longer phrases win, so "ice cream" beats "cream", and among words
+// of the same length the last one wins, so "orange juice" is a beverage. Words
+// that end in a known item, like the German "Vollmilch", match as well.
+func Infer(text string) (category string, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+
+	for n := 3; n >= 1; n-- {
+		for i := len(words) - n; i >= 0; i-- {
+			category, ok = lookup(strings.Join(words[i:i+n], " "))
+			if ok {
+				return category, true
+			}
+		}
+	}
+
+	best := 0
+	for i := len(words) - 1; i >= 0 && best == 0; i-- {
+		for item, itemCategory := range dictionary {
+			if len(item) >= 4 && len(item) > best && !strings.Contains(item, " ") && strings.HasSuffix(words[i], item) {
+				category, best = itemCategory, len(item)
+			}
+		}
+	}
+	return category, best > 0
+}
+
+func lookup(word string) (category string, ok bool) {
+	category, ok = dictionary[word]
+	if ok {
+		return category, true
+	}
+	// plain English and Dutch plurals
+	for _, suffix := range []string{"es", "s", "en"} {
+		if strings.HasSuffix(word, suffix) {
+			category, ok = dictionary[strings.TrimSuffix(word, suffix)]
+			if ok {
+				return category, true
+			}
+		}
+	}
+	return "", false
+}
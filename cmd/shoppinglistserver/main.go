@@ -1,15 +1,48 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/blob"
+	"github.com/slh335/shoppinglistserver/events"
 	"github.com/slh335/shoppinglistserver/http"
+	"github.com/slh335/shoppinglistserver/mail"
+	"github.com/slh335/shoppinglistserver/push"
 	"github.com/slh335/shoppinglistserver/sqlite"
+	"github.com/slh335/shoppinglistserver/webhook"
 )
 
 func main() {
-	db, err := sqlite.Open("file:app.db")
+	trashRetention := flag.Int("trash-retention", 30, "days deleted lists and entries are kept in the trash")
+	notificationRetention := flag.Int("notification-retention", 30, "days read notifications are kept")
+	blobDir := flag.String("blob-dir", "blobs", "directory attachments are stored in")
+	vapidKey := flag.String("vapid-key", "vapid.pem", "file the VAPID key for push messages is kept in, created if missing")
+	pushSubject := flag.String("push-subject", "mailto:admin@localhost", "mailto: or https: URL push services can contact the operator at")
+	pushMock := flag.Bool("push-mock", false, "serve a mock push service under /push/mock for testing, which allows push services on private addresses")
+	pushAllowPrivate := flag.Bool("push-allow-private", false, "allow push services on loopback and private addresses, for development")
+	baseURL := flag.String("base-url", "http://localhost:9000", "URL the server is reached at, which links in mails and invitation links point to")
+	smtpAddr := flag.String("smtp-addr", "", "host:port of the SMTP server mails are sent through, no mails are sent if empty")
+	smtpUsername := flag.String("smtp-username", "", "username for the SMTP server")
+	smtpPassword := flag.String("smtp-password", "", "password for the SMTP server")
+	smtpFrom := flag.String("smtp-from", "Shopping List <noreply@localhost>", "sender of mails")
+	ingestSecret := flag.String("ingest-secret", "", "secret inbound mail and chat messages must carry, ingestion is turned off if empty")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "allow webhooks on loopback and private addresses, for development")
+	webhookLogRetention := flag.Int("webhook-log-retention", 30, "days the delivery logs of webhooks are kept")
+	smtpFake := flag.Bool("smtp-fake", false, "send mails to a fake SMTP server whose mails are served under /mail/fake for testing")
+	flag.Parse()
+
+	db, err := sqlite.Open("file:app.db?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	key, err := push.LoadKey(*vapidKey)
 	if err != nil {
 		log.Fatal(err)
 		return
@@ -31,20 +64,289 @@ func main() {
 		EntryService: &sqlite.EntryService{
 			DB: db,
 		},
+		TrashService: &sqlite.TrashService{
+			DB:        db,
+			Retention: 24 * time.Hour * time.Duration(*trashRetention),
+		},
+		ActivityService: &sqlite.ActivityService{
+			DB: db,
+		},
+		AttachmentService: &sqlite.AttachmentService{
+			DB: db,
+		},
+		StapleService: &sqlite.StapleService{
+			DB: db,
+		},
+		SuggestionService: &sqlite.SuggestionService{
+			DB: db,
+		},
+		CategoryService: &sqlite.CategoryService{
+			DB: db,
+		},
+		SearchService: &sqlite.SearchService{
+			DB: db,
+		},
+		TemplateService: &sqlite.TemplateService{
+			DB: db,
+		},
+		LinkService: &sqlite.LinkService{
+			DB: db,
+		},
+		JoinRequestService: &sqlite.JoinRequestService{
+			DB: db,
+		},
+		NotificationService: &sqlite.NotificationService{
+			DB: db,
+		},
+		PushService: &sqlite.PushService{
+			DB: db,
+		},
+		EmailService: &sqlite.EmailService{
+			DB: db,
+		},
+		WebhookService: &sqlite.WebhookService{
+			DB: db,
+		},
+		IngestService: &sqlite.IngestService{
+			DB: db,
+		},
+		RecipeService: &sqlite.RecipeService{
+			DB: db,
+		},
+		PantryService: &sqlite.PantryService{
+			DB: db,
+		},
+		Events: events.NewBroker(),
+		Blobs: &blob.FileStore{
+			Dir: *blobDir,
+		},
+		// the mock push service is served by this server, usually on a private address
+		Push:         push.NewSender(key, *pushSubject, 30*time.Second, *pushAllowPrivate || *pushMock),
+		Webhooks:     webhook.NewSender(10*time.Second, *webhookAllowPrivate),
+		BaseURL:      strings.TrimSuffix(*baseURL, "/"),
+		IngestSecret: *ingestSecret,
+	}
+	if *pushMock {
+		server.PushMock = push.NewMock()
+	}
+	if *smtpFake {
+		server.MailFake, err = mail.ListenFake("127.0.0.1:0")
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+		*smtpAddr = server.MailFake.Addr()
 	}
+	if *smtpAddr != "" {
+		server.Mailer = &mail.SMTP{
+			Addr:     *smtpAddr,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			From:     *smtpFrom,
+		}
+	}
+
+	server.Events.Handle(func(event Event) {
+		err := server.Notify(event)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	server.Events.Handle(func(event Event) {
+		err := server.EnqueuePush(event)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	server.Events.Handle(func(event Event) {
+		err := server.EnqueueWebhooks(event)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	server.Events.Handle(func(event Event) {
+		err := server.Restock(event)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	server.Events.Handle(func(event Event) {
+		// mails are sent in the background, since SMTP servers can be slow
+		go func() {
+			err := server.MailNotify(event)
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+	})
+
+	go every(time.Hour, func() {
+		keys, err := server.TrashService.Purge()
+		if err != nil {
+			log.Println(err)
+		}
+		for _, key := range keys {
+			err = server.Blobs.Delete(key)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	})
+
+	go every(time.Hour, func() {
+		_, err := server.InvitationService.Expire(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(time.Hour, func() {
+		err := server.NotificationService.Prune(time.Now().AddDate(0, 0, -*notificationRetention))
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(time.Hour, func() {
+		err := server.SendDigests(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+		err = server.AuthService.PruneResets(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(time.Hour, func() {
+		err := server.WebhookService.Prune(time.Now().AddDate(0, 0, -*webhookLogRetention))
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(5*time.Second, func() {
+		err := server.DeliverPush(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(5*time.Second, func() {
+		err := server.DeliverWebhooks(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	go every(time.Minute, func() {
+		err := server.AddDueStaples(time.Now())
+		if err != nil {
+			log.Println(err)
+		}
+	})
 
 	e := echo.New()
 
 	e.POST("/auth/register", server.Register)
 	e.POST("/auth/login", server.Login)
 	e.POST("/auth/verifysession", server.VerifySession)
+	e.POST("/auth/reset", server.RequestPasswordReset)
+	e.GET("/auth/reset/confirm", server.ConfirmResetPassword)
+	e.POST("/auth/reset/confirm", server.ResetPassword)
+
+	e.GET("/user/email", server.GetEmailSettings)
+	e.PUT("/user/email", server.SetEmailSettings)
+	e.DELETE("/user/email", server.RemoveEmailSettings)
+	e.GET("/user/email/verify", server.ConfirmVerifyEmail)
+	e.POST("/user/email/verify", server.VerifyEmail)
+	e.GET("/mail/unsubscribe", server.ConfirmUnsubscribeMail)
+	e.POST("/mail/unsubscribe", server.UnsubscribeMail)
+	if server.MailFake != nil {
+		e.GET("/mail/fake", server.GetFakeMails)
+	}
+
+	e.GET("/ingest/aliases", server.GetIngestAliases)
+	e.POST("/ingest/aliases", server.AddIngestAlias)
+	e.DELETE("/ingest/alias/:id", server.DeleteIngestAlias)
+	if server.IngestSecret != "" {
+		e.POST("/ingest/message", server.IngestMessage)
+		e.POST("/ingest/email", server.IngestEmail)
+	}
+
+	e.GET("/recipes", server.GetRecipes)
+	e.POST("/recipes", server.AddRecipe)
+	e.GET("/recipe/:id", server.GetRecipe)
+	e.PUT("/recipe/:id", server.UpdateRecipe)
+	e.DELETE("/recipe/:id", server.DeleteRecipe)
+	e.POST("/recipe/:id/list", server.AddRecipeToList)
+
+	e.PUT("/pantry/:id", server.UpdatePantryItem)
+	e.DELETE("/pantry/:id", server.DeletePantryItem)
+	e.POST("/pantry/:id/consume", server.ConsumePantryItem)
+
+	e.GET("/meals", server.GetMeals)
+	e.POST("/meals", server.AddMeal)
+	e.DELETE("/meal/:id", server.DeleteMeal)
+	e.POST("/meals/list", server.AddMealsToList)
+
+	e.GET("/search", server.Search)
+
+	e.GET("/push/key", server.GetPushKey)
+	e.GET("/push/subscriptions", server.GetPushSubscriptions)
+	e.POST("/push/subscriptions", server.Subscribe)
+	e.DELETE("/push/subscription/:id", server.Unsubscribe)
+	if server.PushMock != nil {
+		e.POST("/push/mock", server.AddMockPushSubscription)
+		e.POST("/push/mock/:token", server.ReceiveMockPush)
+		e.GET("/push/mock/:token", server.GetMockPushMessages)
+	}
+
+	e.GET("/notifications", server.GetNotifications)
+	e.GET("/notifications/unread", server.GetUnreadNotifications)
+	e.POST("/notifications/read", server.MarkNotificationsRead)
+	e.GET("/notifications/preferences", server.GetNotificationPreferences)
+	e.PUT("/notifications/preferences", server.SetNotificationPreferences)
 
 	e.GET("/lists", server.GetLists)
+	e.GET("/lists/trash", server.GetDeletedLists)
 	e.POST("/list", server.AddList)
 	e.GET("/list/:id", server.GetEntries)
+	e.PUT("/list/:id", server.UpdateList)
 	e.DELETE("/list/:id", server.DeleteList)
-	e.POST("/list/:id/join", server.JoinList)
+	e.POST("/list/:id/join", server.RequestToJoin)
+	e.GET("/list/:id/join-requests", server.GetJoinRequests)
 	e.POST("/list/:id/leave", server.LeaveList)
+	e.GET("/list/:id/members", server.GetMembers)
+	e.DELETE("/list/:id/member/:userId", server.RemoveMember)
+	e.POST("/list/:id/owner", server.TransferOwnership)
+	e.GET("/list/:id/webhooks", server.GetWebhooks)
+	e.POST("/list/:id/webhooks", server.AddWebhook)
+	e.POST("/list/:id/paste", server.PasteEntries)
+	e.GET("/list/:id/pantry", server.GetPantry)
+	e.POST("/list/:id/pantry", server.AddPantryItem)
+	e.POST("/list/:id/rerank", server.RerankList)
+	e.POST("/list/:id/archive", server.ArchiveList)
+	e.POST("/list/:id/unarchive", server.UnarchiveList)
+	e.POST("/list/:id/duplicate", server.DuplicateList)
+	e.POST("/list/:id/template", server.SaveTemplate)
+	e.GET("/list/:id/links", server.GetLinks)
+	e.POST("/list/:id/links", server.AddLink)
+	e.GET("/list/:id/trash", server.GetTrash)
+	e.GET("/list/:id/activity", server.GetActivity)
+	e.GET("/list/:id/staples", server.GetStaples)
+	e.GET("/list/:id/staples/upcoming", server.GetUpcomingStaples)
+	e.POST("/list/:id/staples", server.AddStaple)
+	e.GET("/list/:id/suggestions", server.GetSuggestions)
+	e.GET("/list/:id/category", server.InferCategory)
+	e.GET("/list/:id/category-rules", server.GetCategoryRules)
+	e.POST("/list/:id/category-rules", server.SetCategoryRule)
+	e.POST("/list/:id/restore", server.RestoreList)
+	e.GET("/list/:id/events", server.StreamEvents)
+	e.POST("/list/:id/clear", server.ClearCompletedEntries)
+	e.POST("/list/:id/complete", server.CompleteAllEntries)
+	e.POST("/list/:id/entries/delete", server.DeleteEntries)
+	e.POST("/list/:id/entries/move", server.MoveEntries)
 
 	e.GET("/invitations", server.GetInvitations)
 	e.POST("/invitation", server.Invite)
@@ -52,11 +354,51 @@ func main() {
 	e.POST("/invitation/decline", server.DeclineInvitation)
 	e.POST("/invitation/revoke", server.RevokeInvitation)
 
+	e.GET("/join-requests", server.GetSentJoinRequests)
+	e.POST("/join-request/:id/approve", server.ApproveJoinRequest)
+	e.POST("/join-request/:id/reject", server.RejectJoinRequest)
+
+	e.GET("/link/:token", server.GetLink)
+	e.POST("/link/:token/join", server.JoinLink)
+	e.DELETE("/link/:token", server.RevokeLink)
+
 	e.POST("/entry", server.AddEntry)
 	e.PUT("/entry/:id", server.UpdateEntry)
 	e.DELETE("/entry/:id", server.DeleteEntry)
 	e.POST("/entry/:id/complete", server.CompleteEntry)
 	e.POST("/entry/move", server.MoveEntry)
+	e.POST("/entry/:id/move", server.MoveEntryTo)
+	e.POST("/entry/:id/restore", server.RestoreEntry)
+	e.GET("/entry/:id/history", server.GetEntryHistory)
+	e.POST("/entry/:id/attachments", server.UploadAttachment)
+
+	e.GET("/attachment/:id", server.GetAttachment)
+	e.GET("/attachment/:id/thumbnail", server.GetAttachmentThumbnail)
+	e.DELETE("/attachment/:id", server.DeleteAttachment)
+
+	e.PUT("/staple/:id", server.UpdateStaple)
+	e.DELETE("/staple/:id", server.DeleteStaple)
+	e.DELETE("/category-rule/:id", server.DeleteCategoryRule)
+
+	e.PUT("/webhook/:id", server.UpdateWebhook)
+	e.DELETE("/webhook/:id", server.DeleteWebhook)
+	e.POST("/webhook/:id/test", server.TestWebhook)
+	e.GET("/webhook/:id/deliveries", server.GetWebhookDeliveries)
+
+	e.GET("/templates", server.GetTemplates)
+	e.GET("/template/:id", server.GetTemplate)
+	e.POST("/template/:id/instantiate", server.InstantiateTemplate)
+	e.DELETE("/template/:id", server.DeleteTemplate)
+
+	e.POST("/undo", server.Undo)
 
 	e.Logger.Fatal(e.Start(":9000"))
 }
+
+// every runs job immediately and then once per interval.
+func every(interval time.Duration, job func()) {
+	for {
+		job()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"sync"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// queueSize is how many events can wait for the handlers before publishing
+// blocks.
+const queueSize = 1024
+
+// Broker fans out list events to open streams of that list and to handlers
+// that want to see every event. Handlers run one event after another in the
+// order the events were published, on a worker of their own, so that slow
+// handlers do not hold up the requests that publish events.
+type Broker struct {
+	mu sync.Mutex
+	// streams holds the open streams of every list with the user reading them
+	streams  map[int]map[chan Event]int
+	handlers []func(Event)
+	queue    chan Event
+}
+
+func NewBroker() *Broker {
+	b := &Broker{
+		streams: map[int]map[chan Event]int{},
+		queue:   make(chan Event, queueSize),
+	}
+	go b.work()
+	return b
+}
+
+// Subscribe opens a stream of the events of a list for a member. The stream
+// must be closed with unsubscribe once the caller stops reading from it. The
+// broker ends the stream itself, after delivering the event, once the member
+// leaves or is removed from the list or the list is deleted.
+func (b *Broker) Subscribe(listId, userId int) (events <-chan Event, unsubscribe func()) {
+	stream := make(chan Event, 16)
+
+	b.mu.Lock()
+	if b.streams[listId] == nil {
+		b.streams[listId] = map[chan Event]int{}
+	}
+	b.streams[listId][stream] = userId
+	b.mu.Unlock()
+
+	return stream, func() {
+		b.mu.Lock()
+		delete(b.streams[listId], stream)
+		if len(b.streams[listId]) == 0 {
+			delete(b.streams, listId)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Handle registers a handler that is called for every published event.
+func (b *Broker) Handle(handler func(Event)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// Publish delivers an event to the streams of its list right away and queues
+// it for the handlers. Streams that are not keeping up miss the event instead
+// of blocking the publisher, whereas handlers see every event, so publishing
+// blocks while the queue is full.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	for stream, userId := range b.streams[event.ListId] {
+		select {
+		case stream <- event:
+		default:
+		}
+		if ends(event, userId) {
+			delete(b.streams[event.ListId], stream)
+			close(stream)
+		}
+	}
+	if len(b.streams[event.ListId]) == 0 {
+		delete(b.streams, event.ListId)
+	}
+	b.mu.Unlock()
+
+	b.queue <- event
+}
+
+// ends reports whether an event takes a user's access to its list away.
+func ends(event Event, userId int) bool {
+	switch event.Type {
+	case EventListDeleted:
+		return true
+	case EventMemberLeft, EventMemberRemoved:
+		member, ok := event.Data.(User)
+		return ok && member.Id == userId
+	}
+	return false
+}
+
+func (b *Broker) work() {
+	for event := range b.queue {
+		b.mu.Lock()
+		handlers := b.handlers
+		b.mu.Unlock()
+
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
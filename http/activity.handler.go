@@ -0,0 +1,97 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// GetActivity returns a page of the changes to the entries of a list, newest
+// first, 50 by default.
+func (server *Server) GetActivity(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	filter, success, err := getFilter(c, SortCreated)
+	if !success {
+		return err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 50
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	activities, next, err := server.ActivityService.List(id, filter)
+	if err != nil {
+		return queryError(c, err, "error: failed to load activity")
+	}
+	return pageResponse(c, activities, next)
+}
+
+func (server *Server) GetEntryHistory(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	listId, err := server.ActivityService.EntryList(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d has no history", id),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entry history",
+		})
+	}
+	success, err = requireMember(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	// members of the list the entry is on now only see its history there
+	activities, err := server.ActivityService.Entry(id, listId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entry history",
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    activities,
+	})
+}
@@ -0,0 +1,255 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+	"github.com/slh335/shoppinglistserver/thumbnail"
+)
+
+const (
+	maxAttachmentSize = 10 << 20
+	thumbnailSize     = 256
+)
+
+var attachmentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func (server *Server) UploadAttachment(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	entry, err := server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'file' must be provided",
+		})
+	}
+	if header.Size > maxAttachmentSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: attachments must not be larger than %d MB", maxAttachmentSize>>20),
+		})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: failed to read file",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil || len(data) > maxAttachmentSize {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: failed to read file",
+		})
+	}
+
+	// the type is taken from the content, not from what the client claims
+	contentType := http.DetectContentType(data)
+	extension, ok := attachmentTypes[contentType]
+	if !ok {
+		return c.JSON(http.StatusUnsupportedMediaType, Response{
+			Success: false,
+			Message: "error: attachments must be JPEG, PNG or GIF images",
+		})
+	}
+	thumb, width, height, err := thumbnail.Generate(bytes.NewReader(data), thumbnailSize)
+	if errors.Is(err, thumbnail.ErrTooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: images must not have more than %d megapixels", thumbnail.MaxPixels/1_000_000),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: file is not a valid image",
+		})
+	}
+
+	key := crypto.GenerateToken(24)
+	attachment := Attachment{
+		EntryId:      entry.Id,
+		Key:          key + extension,
+		ThumbnailKey: key + ".thumb.jpg",
+		ContentType:  contentType,
+		Size:         len(data),
+		Width:        width,
+		Height:       height,
+	}
+	err = server.Blobs.Put(attachment.Key, bytes.NewReader(data))
+	if err == nil {
+		err = server.Blobs.Put(attachment.ThumbnailKey, bytes.NewReader(thumb))
+	}
+	if err != nil {
+		server.Blobs.Delete(attachment.Key)
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to store attachment",
+		})
+	}
+
+	attachment, err = server.AttachmentService.Add(attachment)
+	if err != nil {
+		server.Blobs.Delete(attachment.Key)
+		server.Blobs.Delete(attachment.ThumbnailKey)
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create attachment",
+		})
+	}
+
+	entry, err = server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entry",
+		})
+	}
+	server.publish(EventEntryUpdated, entry.ListId, user, entry)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully attached image to entry %d", id),
+		Data:    attachment,
+	})
+}
+
+func (server *Server) GetAttachment(c echo.Context) error {
+	return server.serveAttachment(c, false)
+}
+
+func (server *Server) GetAttachmentThumbnail(c echo.Context) error {
+	return server.serveAttachment(c, true)
+}
+
+func (server *Server) serveAttachment(c echo.Context, thumbnail bool) error {
+	_, attachment, _, success, err := server.loadAttachment(c)
+	if !success {
+		return err
+	}
+
+	key, contentType := attachment.Key, attachment.ContentType
+	if thumbnail {
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	}
+	blob, err := server.Blobs.Get(key)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load attachment",
+		})
+	}
+	defer blob.Close()
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=31536000, immutable")
+	return c.Stream(http.StatusOK, contentType, blob)
+}
+
+func (server *Server) DeleteAttachment(c echo.Context) error {
+	user, attachment, entry, success, err := server.loadAttachment(c)
+	if !success {
+		return err
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	deleted, err := server.AttachmentService.Delete(attachment.Id)
+	if err != nil || !deleted {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete attachment",
+		})
+	}
+	server.Blobs.Delete(attachment.Key)
+	server.Blobs.Delete(attachment.ThumbnailKey)
+
+	entry, err = server.EntryService.Get(attachment.EntryId)
+	if err == nil {
+		server.publish(EventEntryUpdated, entry.ListId, user, entry)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully deleted attachment %d", attachment.Id),
+	})
+}
+
+// loadAttachment loads the attachment in the path and its entry, and checks
+// that the user is a member of the list the entry belongs to, even if the
+// entry is in the trash.
+func (server *Server) loadAttachment(c echo.Context) (user User, attachment Attachment, entry Entry, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, attachment, entry, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+		return user, attachment, entry, false, err
+	}
+
+	attachment, err = server.AttachmentService.Get(id)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: attachment %d does not exist", id),
+		})
+		return user, attachment, entry, false, err
+	}
+	entry, err = server.EntryService.Get(attachment.EntryId)
+	if err != nil {
+		entry, err = server.TrashService.GetEntry(attachment.EntryId)
+	}
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entry",
+		})
+		return user, attachment, entry, false, err
+	}
+	success, err = requireMember(c, server, entry.ListId, user.Id)
+	return user, attachment, entry, success, err
+}
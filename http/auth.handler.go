@@ -1,6 +1,7 @@
 package http
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -13,6 +14,10 @@ func (server *Server) Register(c echo.Context) error {
 		return err
 	}
 	username, password := values[0], values[1]
+	link, success, err := server.getLinkToken(c)
+	if !success {
+		return err
+	}
 
 	user, err := server.AuthService.Register(username, password)
 	if err != nil {
@@ -30,9 +35,18 @@ func (server *Server) Register(c echo.Context) error {
 		})
 	}
 
+	success, err = server.joinAfterAuth(c, link, user)
+	if !success {
+		return err
+	}
+	message := "successfully registered user"
+	if link != nil {
+		message += fmt.Sprintf(" and joined list '%s'", link.List.Name)
+	}
+
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
-		Message: "successfully registered user",
+		Message: message,
 		Data:    session,
 	})
 }
@@ -43,6 +57,10 @@ func (server *Server) Login(c echo.Context) error {
 		return err
 	}
 	username, password := values[0], values[1]
+	link, success, err := server.getLinkToken(c)
+	if !success {
+		return err
+	}
 
 	user, err := server.AuthService.Login(username, password)
 	if err != nil {
@@ -60,8 +78,18 @@ func (server *Server) Login(c echo.Context) error {
 		})
 	}
 
+	success, err = server.joinAfterAuth(c, link, user)
+	if !success {
+		return err
+	}
+	message := ""
+	if link != nil {
+		message = fmt.Sprintf("successfully joined list '%s'", link.List.Name)
+	}
+
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
+		Message: message,
 		Data:    session,
 	})
 }
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetCategoryRules(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	rules, err := server.CategoryService.Rules(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load category rules",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+func (server *Server) SetCategoryRule(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "keyword", "category")
+	if !success {
+		return err
+	}
+	keyword, category := strings.TrimSpace(values[0]), strings.TrimSpace(values[1])
+	if keyword == "" || category == "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: fields 'keyword' and 'category' must not be blank",
+		})
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	rule, err := server.CategoryService.SetRule(id, keyword, category)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to save category rule",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully saved category rule for '%s'", rule.Keyword),
+		Data:    rule,
+	})
+}
+
+func (server *Server) DeleteCategoryRule(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	rule, err := server.CategoryService.GetRule(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: category rule %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, rule.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	deleted, err := server.CategoryService.DeleteRule(id)
+	if err != nil || !deleted {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete category rule",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully deleted category rule %d", id),
+	})
+}
+
+// InferCategory returns the category a new entry with the text in the query
+// parameter 'text' would be put into if it was added without one.
+func (server *Server) InferCategory(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	text := c.QueryParam("text")
+	if text == "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: query parameter 'text' must be provided",
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	category, err := server.CategoryService.Infer(id, text)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to infer category",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    category,
+	})
+}
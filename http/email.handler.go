@@ -0,0 +1,394 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/mail"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+func (server *Server) GetEmailSettings(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	settings, err := server.EmailService.Settings(user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: no email address was given",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load email settings",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    settings,
+	})
+}
+
+// SetEmailSettings sets the email address of the user in the field 'email'.
+// The optional field 'notifications' turns mails about invitations on or off,
+// and 'digest' is one of the Digests. Both are kept as they are when they are
+// left out, and default to notifications without digest. Until the user
+// verifies the address with the link mailed to it, see VerifyEmail, no other
+// mails are sent to it; saving an unverified address again mails another link.
+func (server *Server) SetEmailSettings(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "email")
+	if !success {
+		return err
+	}
+	address, err := netmail.ParseAddress(values[0])
+	if err != nil || address.Name != "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'email' must be an email address",
+		})
+	}
+
+	settings, err := server.EmailService.Settings(user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		settings = EmailSettings{User: user, Notifications: true, Digest: DigestOff}
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load email settings",
+		})
+	}
+	settings.Email = address.Address
+
+	if notificationsStr, ok := getOptionalFormValue(c, "notifications"); ok {
+		settings.Notifications, err = strconv.ParseBool(notificationsStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'notifications' must be a boolean",
+			})
+		}
+	}
+	if digest, ok := getOptionalFormValue(c, "digest"); ok {
+		if !slices.Contains(Digests, digest) {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("error: field 'digest' must be one of %s", strings.Join(Digests, ", ")),
+			})
+		}
+		settings.Digest = digest
+	}
+
+	settings, err = server.EmailService.SetSettings(settings)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to save email settings",
+		})
+	}
+	message := "successfully saved email settings"
+	if !settings.Verified {
+		err = server.sendVerification(settings)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to send mail",
+			})
+		}
+		message = fmt.Sprintf("successfully saved email settings, open the link mailed to %s to verify it", settings.Email)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    settings,
+	})
+}
+
+// ConfirmVerifyEmail shows the page the link in verification mails opens,
+// which asks to confirm the address with the token in the query parameter
+// 'token'. Like ConfirmUnsubscribeMail, opening the link changes nothing.
+func (server *Server) ConfirmVerifyEmail(c echo.Context) error {
+	return server.verifyPage(c, c.QueryParam("token"), "")
+}
+
+// VerifyEmail verifies the address of the user with the token from the mail
+// SetEmailSettings sent in the field 'token'. The form of ConfirmVerifyEmail
+// gets a page in response.
+func (server *Server) VerifyEmail(c echo.Context) error {
+	values, success, err := getFormValues(c, "token")
+	if !success {
+		return err
+	}
+
+	settings, err := server.EmailService.Verify(values[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: verification token is invalid",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to verify email address",
+		})
+	}
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return server.verifyPage(c, "", settings.Email)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully verified %s", settings.Email),
+		Data:    settings,
+	})
+}
+
+func (server *Server) verifyPage(c echo.Context, token, email string) error {
+	page, err := mail.RenderPage("verifyemail", verifyPage{
+		mailLayout: mailLayout{Subject: "Confirm your email address", URL: server.BaseURL + "/user/email/verify"},
+		Token:      token,
+		Email:      email,
+		Done:       email != "",
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to render page",
+		})
+	}
+	return c.HTML(http.StatusOK, page)
+}
+
+func (server *Server) RemoveEmailSettings(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	removed, err := server.EmailService.RemoveSettings(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to remove email address",
+		})
+	}
+	if !removed {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: no email address was given",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully removed email address",
+	})
+}
+
+// ConfirmUnsubscribeMail shows the page the unsubscribe link in mails opens,
+// which asks to confirm unsubscribing with the token in the query parameter
+// 'token'. Opening the link changes nothing, since mail scanners and link
+// previews open it as well.
+func (server *Server) ConfirmUnsubscribeMail(c echo.Context) error {
+	return server.unsubscribePage(c, c.QueryParam("token"), false)
+}
+
+// UnsubscribeMail turns off all mails but password resets for the owner of the
+// token in the field 'token'. It is linked in every mail, so it needs no
+// session, and accepts the one-click POST of mail clients (RFC 8058) as well
+// as the form of ConfirmUnsubscribeMail, which gets a page in response.
+func (server *Server) UnsubscribeMail(c echo.Context) error {
+	values, success, err := getFormValues(c, "token")
+	if !success {
+		return err
+	}
+
+	settings, err := server.EmailService.Unsubscribe(values[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: unsubscribe token is invalid",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to unsubscribe",
+		})
+	}
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return server.unsubscribePage(c, "", true)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully unsubscribed %s from all mails", settings.Email),
+	})
+}
+
+func (server *Server) unsubscribePage(c echo.Context, token string, done bool) error {
+	page, err := mail.RenderPage("unsubscribe", unsubscribePage{
+		mailLayout: mailLayout{Subject: "Unsubscribe", URL: server.BaseURL + "/mail/unsubscribe"},
+		Token:      token,
+		Done:       done,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to render page",
+		})
+	}
+	return c.HTML(http.StatusOK, page)
+}
+
+// RequestPasswordReset mails a link to reset their password to the user in the
+// field 'username', if they have given and verified an email address. The
+// response is the same either way, so that it does not tell who has one.
+func (server *Server) RequestPasswordReset(c echo.Context) error {
+	values, success, err := getFormValues(c, "username")
+	if !success {
+		return err
+	}
+	response := Response{
+		Success: true,
+		Message: "if the user has an email address, a mail to reset the password was sent to it",
+	}
+
+	user, err := server.UserService.GetUser(values[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusOK, response)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load user",
+		})
+	}
+	settings, err := server.EmailService.Settings(user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusOK, response)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load email settings",
+		})
+	}
+	if !settings.Verified {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	token, err := server.AuthService.NewPasswordReset(user.Id, time.Now().Add(passwordResetExpiry))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create password reset",
+		})
+	}
+	layout := mailLayout{
+		Subject: "Reset your password",
+		URL:     server.BaseURL + "/auth/reset/confirm?token=" + token,
+	}
+	err = server.sendMail(settings.Email, "reset", layout, resetMail{
+		mailLayout: layout,
+		Username:   user.Username,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to send mail",
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// ConfirmResetPassword shows the page the link in password reset mails opens,
+// which asks for the new password to set with the token in the query
+// parameter 'token'.
+func (server *Server) ConfirmResetPassword(c echo.Context) error {
+	return server.resetPage(c, c.QueryParam("token"), false)
+}
+
+// ResetPassword sets the password in the field 'password' with the token from
+// a password reset mail in the field 'token'. The user is logged out
+// everywhere. The form of ConfirmResetPassword gets a page in response.
+func (server *Server) ResetPassword(c echo.Context) error {
+	values, success, err := getFormValues(c, "token", "password")
+	if !success {
+		return err
+	}
+
+	user, err := server.AuthService.ResetPassword(values[0], values[1], time.Now())
+	if errors.Is(err, sqlite.ErrResetTokenInvalid) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to reset password",
+		})
+	}
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return server.resetPage(c, "", true)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully reset password of %s", user.Username),
+	})
+}
+
+func (server *Server) resetPage(c echo.Context, token string, done bool) error {
+	page, err := mail.RenderPage("resetpassword", resetPage{
+		mailLayout: mailLayout{Subject: "Reset your password", URL: server.BaseURL + "/auth/reset/confirm"},
+		Token:      token,
+		Done:       done,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to render page",
+		})
+	}
+	return c.HTML(http.StatusOK, page)
+}
+
+// GetFakeMails returns the mails the fake SMTP server has received.
+func (server *Server) GetFakeMails(c echo.Context) error {
+	type fakeMail struct {
+		mail.Received
+		Message mail.Message `json:"message"`
+	}
+	mails := []fakeMail{}
+	for _, received := range server.MailFake.Mails() {
+		message, err := received.Message()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to parse mail",
+			})
+		}
+		mails = append(mails, fakeMail{Received: received, Message: message})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    mails,
+	})
+}
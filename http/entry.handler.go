@@ -8,10 +8,16 @@ import (
 
 	"github.com/labstack/echo/v4"
 	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/ingest"
+)
+
+const (
+	maxPasteSize  = 100000
+	maxPasteItems = 200
 )
 
 func (server *Server) GetEntries(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
@@ -25,18 +31,25 @@ func (server *Server) GetEntries(c echo.Context) error {
 		})
 	}
 
-	entries, err := server.EntryService.All(listId)
+	success, err = requireMember(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	filter, success, err := getFilter(c, SortCategory, SortText, SortCreated, SortUpdated)
+	if !success {
+		return err
+	}
+
+	entries, next, err := server.EntryService.Query(listId, filter)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "error: failed to load entries",
-		})
+		return queryError(c, err, "error: failed to load entries")
 	}
-	return c.JSON(http.StatusOK, Response{Success: true, Data: entries})
+	return pageResponse(c, entries, next)
 }
 
 func (server *Server) CompleteEntry(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
@@ -60,7 +73,19 @@ func (server *Server) CompleteEntry(c echo.Context) error {
 		completed = false
 	}
 
-	updated, err := server.EntryService.Complete(id, completed)
+	entry, err := server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	updated, err := server.EntryService.Complete(user.Id, id, completed)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -77,13 +102,14 @@ func (server *Server) CompleteEntry(c echo.Context) error {
 	if !completed {
 		status = "uncomplete"
 	}
-	entry, err := server.EntryService.Get(id)
+	entry, err = server.EntryService.Get(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Message: "error: failed to load entry",
 		})
 	}
+	server.publish(EventEntryCompleted, entry.ListId, user, entry)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: fmt.Sprintf("successfully marked entry %d as %s", id, status),
@@ -92,7 +118,7 @@ func (server *Server) CompleteEntry(c echo.Context) error {
 }
 
 func (server *Server) MoveEntry(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
@@ -123,16 +149,65 @@ func (server *Server) MoveEntry(c echo.Context) error {
 			Message: "error: field 'new_index' must be a valid integer",
 		})
 	}
+	if newIndex < 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'new_index' must not be negative",
+		})
+	}
+
+	success, err = requireEditor(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	entries, err := server.EntryService.All(listId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entries",
+		})
+	}
+	others := []Entry{}
+	id := 0
+	for _, entry := range entries {
+		if entry.Category != category {
+			continue
+		}
+		if len(others) == oldIndex && id == 0 {
+			id = entry.Id
+			continue
+		}
+		others = append(others, entry)
+	}
+	if id == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: no entry at index %d in category '%s'", oldIndex, category),
+		})
+	}
+	// new_index is the drop position before the entry is taken out
+	if oldIndex < newIndex {
+		newIndex--
+	}
+	afterId := 0
+	if newIndex > len(others) {
+		newIndex = len(others)
+	}
+	if newIndex > 0 {
+		afterId = others[newIndex-1].Id
+	}
 
-	updated, err := server.EntryService.Move(listId, category, oldIndex, newIndex)
-	if err != nil || !updated {
-		fmt.Println(updated, err)
+	entry, err := server.EntryService.Move(user.Id, id, listId, category, afterId)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Message: "error: failed to move entry",
 		})
 	}
-	entries, err := server.EntryService.All(listId)
+	server.publish(EventEntryMoved, listId, user, entry)
+
+	entries, err = server.EntryService.All(listId)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -146,17 +221,93 @@ func (server *Server) MoveEntry(c echo.Context) error {
 	})
 }
 
+func (server *Server) MoveEntryTo(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "list_id", "category")
+	if !success {
+		return err
+	}
+	listIdStr, category := values[0], values[1]
+	listId, err := strconv.Atoi(listIdStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'list_id' must be a valid integer",
+		})
+	}
+	afterId := 0
+	afterIdStr := c.FormValue("after_id")
+	if afterIdStr != "" {
+		afterId, err = strconv.Atoi(afterIdStr)
+		if err != nil || afterId < 0 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'after_id' must be a valid entry id",
+			})
+		}
+	}
+
+	entry, err := server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+	if listId != entry.ListId {
+		success, err = requireEditor(c, server, listId, user.Id)
+		if !success {
+			return err
+		}
+	}
+
+	oldListId := entry.ListId
+	entry, err = server.EntryService.Move(user.Id, id, listId, category, afterId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to move entry",
+		})
+	}
+	server.publish(EventEntryMoved, entry.ListId, user, entry)
+	if oldListId != entry.ListId {
+		server.publish(EventEntryMoved, oldListId, user, entry)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully moved entry %d", id),
+		Data:    entry,
+	})
+}
+
 func (server *Server) AddEntry(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
 
-	values, success, err := getFormValues(c, "list_id", "text", "category")
+	values, success, err := getFormValues(c, "list_id", "text")
 	if !success {
 		return err
 	}
-	listIdStr, text, category := values[0], values[1], values[2]
+	listIdStr, text := values[0], values[1]
 	listId, err := strconv.Atoi(listIdStr)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, Response{
@@ -165,18 +316,151 @@ func (server *Server) AddEntry(c echo.Context) error {
 		})
 	}
 
-	entry, err := server.EntryService.Add(listId, text, category)
+	success, err = requireEditor(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	price, success, err := getPrice(c)
+	if !success {
+		return err
+	}
+	quantity, success, err := getQuantity(c)
+	if !success {
+		return err
+	}
+
+	// entries added without a category are put into the one the list's rules,
+	// its history or the built-in dictionary suggest
+	category := c.FormValue("category")
+	if category == "" {
+		category, err = server.CategoryService.Infer(listId, text)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to infer category",
+			})
+		}
+	}
+
+	entry, err := server.EntryService.Add(user.Id, listId, text, category, c.FormValue("note"), price, quantity)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Message: "error: failed to create entry",
 		})
 	}
+	server.publish(EventEntryAdded, entry.ListId, user, entry)
 	return c.JSON(http.StatusOK, Response{Success: true, Data: entry})
 }
 
+// PasteEntries adds the items of the text in the field 'text', like the
+// ingredients of a recipe or a chat message, to a list at once. Quantities,
+// units and notes are parsed from the items and their categories inferred.
+// With the field 'dry_run' set to true the parsed entries are only returned,
+// so they can be previewed before adding them.
+func (server *Server) PasteEntries(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "text")
+	if !success {
+		return err
+	}
+	text := values[0]
+	if len(text) > maxPasteSize {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: field 'text' must not be longer than %d characters", maxPasteSize),
+		})
+	}
+	dryRun := false
+	if dryRunStr, ok := getOptionalFormValue(c, "dry_run"); ok {
+		dryRun, err = strconv.ParseBool(dryRunStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'dry_run' must be a boolean",
+			})
+		}
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	items := ingest.Parse(text)
+	if len(items) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: text does not contain any items",
+		})
+	}
+	if len(items) > maxPasteItems {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: text must not contain more than %d items", maxPasteItems),
+		})
+	}
+
+	entries := []Entry{}
+	for _, item := range items {
+		category, err := server.CategoryService.Infer(id, item.Text)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to infer category",
+			})
+		}
+		entries = append(entries, Entry{
+			ListId:   id,
+			Text:     item.Text,
+			Category: category,
+			Note:     item.Note,
+			Quantity: item.Quantity,
+		})
+	}
+	if dryRun {
+		return c.JSON(http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("parsed %d entries", len(entries)),
+			Data:    entries,
+		})
+	}
+
+	entries, err = server.EntryService.AddMany(user.Id, id, entries)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create entries",
+		})
+	}
+	batch := EntryBatch{}
+	for _, entry := range entries {
+		batch.Ids = append(batch.Ids, entry.Id)
+	}
+	server.publish(EventEntriesAdded, id, user, batch)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added %d entries", len(entries)),
+		Data:    entries,
+	})
+}
+
 func (server *Server) UpdateEntry(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
@@ -196,7 +480,39 @@ func (server *Server) UpdateEntry(c echo.Context) error {
 	}
 	text, category := values[0], values[1]
 
-	updated, err := server.EntryService.Update(id, text, category)
+	entry, err := server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+	// note, price and quantity are only changed if they are sent, so older
+	// clients do not clear them
+	note, ok := getOptionalFormValue(c, "note")
+	if !ok {
+		note = entry.Note
+	}
+	price := entry.Price
+	if _, ok := getOptionalFormValue(c, "price"); ok {
+		price, success, err = getPrice(c)
+		if !success {
+			return err
+		}
+	}
+	quantity := entry.Quantity
+	if _, ok := getOptionalFormValue(c, "quantity"); ok {
+		quantity, success, err = getQuantity(c)
+		if !success {
+			return err
+		}
+	}
+
+	updated, err := server.EntryService.Update(user.Id, id, text, category, note, price, quantity)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -209,13 +525,14 @@ func (server *Server) UpdateEntry(c echo.Context) error {
 			Message: fmt.Sprintf("error: entry %d does not exist", id),
 		})
 	}
-	entry, err := server.EntryService.Get(id)
+	entry, err = server.EntryService.Get(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Message: "error: failed to load entry",
 		})
 	}
+	server.publish(EventEntryUpdated, entry.ListId, user, entry)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: fmt.Sprintf("successfully updated entry %d", id),
@@ -224,7 +541,7 @@ func (server *Server) UpdateEntry(c echo.Context) error {
 }
 
 func (server *Server) DeleteEntry(c echo.Context) error {
-	_, success, err := verifySession(c, server)
+	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
@@ -238,7 +555,19 @@ func (server *Server) DeleteEntry(c echo.Context) error {
 		})
 	}
 
-	deleted, err := server.EntryService.Delete(id)
+	entry, err := server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d does not exist", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	deleted, token, err := server.EntryService.Delete(user.Id, id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -251,8 +580,223 @@ func (server *Server) DeleteEntry(c echo.Context) error {
 			Message: fmt.Sprintf("error: entry %d does not exist", id),
 		})
 	}
+	server.publish(EventEntryDeleted, entry.ListId, user, entry)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: fmt.Sprintf("successfully deleted entry %d", id),
+		Data:    server.undo(token, entry.ListId),
+	})
+}
+
+func (server *Server) ClearCompletedEntries(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	ids, token, err := server.EntryService.ClearCompleted(user.Id, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to clear completed entries",
+		})
+	}
+	batch := EntryBatch{Ids: ids, Completed: true, Undo: server.undo(token, id)}
+	if len(ids) > 0 {
+		server.publish(EventEntriesCleared, id, user, batch)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully cleared %d completed entries", len(ids)),
+		Data:    batch,
+	})
+}
+
+func (server *Server) CompleteAllEntries(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "completed")
+	if !success {
+		return err
+	}
+	completed := strings.ToLower(values[0]) != "false"
+	category := c.FormValue("category")
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	ids, err := server.EntryService.CompleteAll(user.Id, id, category, completed)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to complete entries",
+		})
+	}
+	batch := EntryBatch{Ids: ids, Category: category, Completed: completed}
+	if len(ids) > 0 {
+		server.publish(EventEntriesCompleted, id, user, batch)
+	}
+	status := "complete"
+	if !completed {
+		status = "uncomplete"
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully marked %d entries as %s", len(ids), status),
+		Data:    batch,
+	})
+}
+
+func (server *Server) DeleteEntries(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	_, success, err = getFormValues(c, "ids")
+	if !success {
+		return err
+	}
+	ids, success, err := parseIds(c, "ids")
+	if !success {
+		return err
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	token, err := server.EntryService.DeleteMany(user.Id, id, ids)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: failed to delete entries",
+		})
+	}
+	batch := EntryBatch{Ids: ids, Undo: server.undo(token, id)}
+	server.publish(EventEntriesDeleted, id, user, batch)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully deleted %d entries", len(ids)),
+		Data:    batch,
+	})
+}
+
+func (server *Server) MoveEntries(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "ids", "list_id", "category")
+	if !success {
+		return err
+	}
+	listIdStr, category := values[1], values[2]
+	ids, success, err := parseIds(c, "ids")
+	if !success {
+		return err
+	}
+	listId, err := strconv.Atoi(listIdStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'list_id' must be a valid integer",
+		})
+	}
+	afterId := 0
+	afterIdStr := c.FormValue("after_id")
+	if afterIdStr != "" {
+		afterId, err = strconv.Atoi(afterIdStr)
+		if err != nil || afterId < 0 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'after_id' must be a valid entry id",
+			})
+		}
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+	if listId != id {
+		success, err = requireEditor(c, server, listId, user.Id)
+		if !success {
+			return err
+		}
+	}
+
+	err = server.EntryService.MoveMany(user.Id, id, ids, listId, category, afterId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: failed to move entries",
+		})
+	}
+	batch := EntryBatch{Ids: ids, Category: category, TargetListId: listId}
+	server.publish(EventEntriesMoved, id, user, batch)
+	if listId != id {
+		server.publish(EventEntriesMoved, listId, user, batch)
+	}
+
+	entries, err := server.EntryService.All(listId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entries",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully moved %d entries", len(ids)),
+		Data:    entries,
 	})
 }
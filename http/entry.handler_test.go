@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/events"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	db, err := sqlite.Open("file:" + filepath.Join(t.TempDir(), "app.db") + "?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Server{
+		AuthService:  &sqlite.AuthService{DB: db},
+		UserService:  &sqlite.UserService{DB: db},
+		ListService:  &sqlite.ListService{DB: db},
+		EntryService: &sqlite.EntryService{DB: db},
+		Events:       events.NewBroker(),
+	}
+}
+
+func TestMoveEntry(t *testing.T) {
+	server := newTestServer(t)
+	user, err := server.AuthService.Register("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := server.AuthService.NewSession(user, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := server.ListService.Add(user, "groceries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"apples", "pears", "plums"} {
+		_, err = server.EntryService.Add(user.Id, list.Id, text, "fruit", "", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = server.EntryService.Add(user.Id, list.Id, "milk", "dairy", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		oldIndex string
+		newIndex string
+		status   int
+		want     []string
+	}{
+		{"forward", "fruit", "0", "2", http.StatusOK, []string{"pears", "apples", "plums"}},
+		{"backward", "fruit", "2", "0", http.StatusOK, []string{"plums", "pears", "apples"}},
+		{"past the end", "fruit", "0", "9", http.StatusOK, []string{"pears", "apples", "plums"}},
+		{"only entry in category", "dairy", "0", "5", http.StatusOK, []string{"milk"}},
+		{"negative new index", "fruit", "0", "-1", http.StatusBadRequest, nil},
+		{"no entry at old index", "dairy", "1", "0", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{
+				"list_id":   {strconv.Itoa(list.Id)},
+				"category":  {test.category},
+				"old_index": {test.oldIndex},
+				"new_index": {test.newIndex},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/entry/move", strings.NewReader(form.Encode()))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			req.Header.Set("Authorization", "Bearer "+session.Token)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := server.MoveEntry(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+			if test.want == nil {
+				return
+			}
+
+			var response struct {
+				Data []Entry `json:"data"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, entry := range response.Data {
+				if entry.Category == test.category {
+					got = append(got, entry.Text)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("order = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
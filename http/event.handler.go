@@ -0,0 +1,62 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) StreamEvents(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	events, unsubscribe := server.Events.Subscribe(id, user.Id)
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case event, ok := <-events:
+			// the stream ends once the user cannot see the list anymore
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return err
+			}
+			res.Flush()
+		}
+	}
+}
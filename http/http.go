@@ -1,12 +1,19 @@
 package http
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
 )
 
 func getFormValues(c echo.Context, keys ...string) (values []string, successs bool, err error) {
@@ -59,3 +66,242 @@ func verifySession(c echo.Context, server *Server) (user User, success bool, err
 	}
 	return session.User, true, nil
 }
+
+func requireMember(c echo.Context, server *Server, listId, userId int) (success bool, err error) {
+	member, err := server.ListService.IsMember(listId, userId)
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+		return false, err
+	}
+	if !member {
+		err = c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user is not a member of list %d", listId),
+		})
+		return false, err
+	}
+	return true, nil
+}
+
+// requireRole checks that a user is a member of a list with one of the given
+// roles.
+func requireRole(c echo.Context, server *Server, listId, userId int, roles ...string) (success bool, err error) {
+	role, err := server.ListService.Role(listId, userId)
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+		return false, err
+	}
+	if role == "" {
+		err = c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user is not a member of list %d", listId),
+		})
+		return false, err
+	}
+	if !slices.Contains(roles, role) {
+		err = c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: members with the role '%s' are not allowed to do that", role),
+		})
+		return false, err
+	}
+	return true, nil
+}
+
+// requireEditor checks that a user may change a list and its entries, which
+// viewers may not.
+func requireEditor(c echo.Context, server *Server, listId, userId int) (success bool, err error) {
+	return requireRole(c, server, listId, userId, RoleOwner, RoleEditor)
+}
+
+func parseIds(c echo.Context, key string) (ids []int, success bool, err error) {
+	for _, idStr := range strings.Split(c.FormValue(key), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil {
+			err = c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("error: field '%s' must be a comma separated list of integers", key),
+			})
+			return ids, false, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, true, nil
+}
+
+// getOptionalFormValue reports whether the field was sent at all, which
+// c.FormValue cannot tell apart from an empty value.
+func getOptionalFormValue(c echo.Context, key string) (value string, ok bool) {
+	params, err := c.FormParams()
+	if err != nil {
+		return "", false
+	}
+	_, ok = params[key]
+	return params.Get(key), ok
+}
+
+// getExpiresIn parses the optional field 'expires_in', a number of hours of up
+// to a year, and returns when something created now expires.
+func getExpiresIn(c echo.Context, defaultExpiresIn int) (expiresAt time.Time, success bool, err error) {
+	expiresIn := defaultExpiresIn
+	if expiresInStr := c.FormValue("expires_in"); expiresInStr != "" {
+		expiresIn, err = strconv.Atoi(expiresInStr)
+		if err != nil || expiresIn < 1 || expiresIn > 365*24 {
+			err = c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'expires_in' must be a number of hours between 1 and 8760",
+			})
+			return expiresAt, false, err
+		}
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Hour), true, nil
+}
+
+var currencyPattern = regexp.MustCompile("^[A-Z]{3}$")
+
+// getPrice parses the optional fields 'price', a decimal amount like "2.49",
+// and 'currency', an ISO 4217 code. An empty price means no price.
+func getPrice(c echo.Context) (price *Price, success bool, err error) {
+	amountStr := strings.Replace(c.FormValue("price"), ",", ".", 1)
+	if amountStr == "" {
+		return nil, true, nil
+	}
+
+	amount, err := strconv.ParseFloat(amountStr, 64)
+	if err != nil || amount < 0 || amount > 1e9 {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'price' must be a positive decimal number",
+		})
+		return nil, false, err
+	}
+	currency := strings.ToUpper(c.FormValue("currency"))
+	if !currencyPattern.MatchString(currency) {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'currency' must be a three letter ISO 4217 code",
+		})
+		return nil, false, err
+	}
+
+	return &Price{
+		Amount:   int(math.Round(amount * 100)),
+		Currency: currency,
+	}, true, nil
+}
+
+// getQuantity parses the optional fields 'quantity', a positive decimal number,
+// and 'unit' of an entry.
+func getQuantity(c echo.Context) (quantity *Quantity, success bool, err error) {
+	amountStr := strings.Replace(c.FormValue("quantity"), ",", ".", 1)
+	if amountStr == "" {
+		return nil, true, nil
+	}
+
+	amount, err := strconv.ParseFloat(amountStr, 64)
+	if err != nil || amount <= 0 || amount > 1e6 {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'quantity' must be a positive decimal number",
+		})
+		return nil, false, err
+	}
+	unit := strings.TrimSpace(c.FormValue("unit"))
+	if len(unit) > 20 {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'unit' must not be longer than 20 characters",
+		})
+		return nil, false, err
+	}
+
+	return &Quantity{Amount: amount, Unit: unit}, true, nil
+}
+
+// getFilter parses the query parameters 'completed', 'category',
+// 'created_since', 'created_by', 'sort', 'cursor' and 'limit' of a collection
+// that can be sorted by the given sort orders.
+func getFilter(c echo.Context, sorts ...string) (filter Filter, success bool, err error) {
+	badRequest := func(message string) (Filter, bool, error) {
+		return filter, false, c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: message,
+		})
+	}
+
+	if completedStr := c.QueryParam("completed"); completedStr != "" {
+		completed, err := strconv.ParseBool(completedStr)
+		if err != nil {
+			return badRequest("error: query parameter 'completed' must be a boolean")
+		}
+		filter.Completed = &completed
+	}
+	if params := c.QueryParams(); params.Has("category") {
+		category := params.Get("category")
+		filter.Category = &category
+	}
+	if createdSinceStr := c.QueryParam("created_since"); createdSinceStr != "" {
+		createdSince, err := time.Parse(time.RFC3339, createdSinceStr)
+		if err != nil {
+			return badRequest("error: query parameter 'created_since' must be an RFC 3339 timestamp")
+		}
+		filter.CreatedSince = &createdSince
+	}
+	if createdByStr := c.QueryParam("created_by"); createdByStr != "" {
+		filter.CreatedBy, err = strconv.Atoi(createdByStr)
+		if err != nil {
+			return badRequest("error: query parameter 'created_by' must be a valid integer")
+		}
+	}
+
+	filter.Sort = c.QueryParam("sort")
+	if filter.Sort != "" && !slices.Contains(sorts, strings.TrimPrefix(filter.Sort, "-")) {
+		return badRequest(fmt.Sprintf("error: query parameter 'sort' must be one of '%s', optionally prefixed with '-'", strings.Join(sorts, "', '")))
+	}
+	filter.Cursor = c.QueryParam("cursor")
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		filter.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || filter.Limit < 1 || filter.Limit > 100 {
+			return badRequest("error: query parameter 'limit' must be an integer between 1 and 100")
+		}
+	}
+	return filter, true, nil
+}
+
+// pageResponse responds with a page of a collection. If there is a next page,
+// its cursor is sent in the response and its URL in the Link header.
+func pageResponse(c echo.Context, data any, next string) error {
+	if next != "" {
+		url := *c.Request().URL
+		query := url.Query()
+		query.Set("cursor", next)
+		url.RawQuery = query.Encode()
+		c.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, url.String()))
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    data,
+		Next:    next,
+	})
+}
+
+// queryError responds to an error of a Query service method, which is the
+// client's fault if the cursor it sent was not valid.
+func queryError(c echo.Context, err error, message string) error {
+	if errors.Is(err, sqlite.ErrInvalidCursor) || errors.Is(err, sqlite.ErrInvalidSort) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: query parameter 'cursor' does not belong to this query",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, Response{
+		Success: false,
+		Message: message,
+	})
+}
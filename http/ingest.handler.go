@@ -0,0 +1,310 @@
+package http
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/ingest"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+const (
+	maxIngestSize  = 1 << 20
+	maxIngestItems = 50
+)
+
+func (server *Server) GetIngestAliases(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	aliases, err := server.IngestService.All(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load aliases",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    aliases,
+	})
+}
+
+// AddIngestAlias adds the items of messages from the sender in the field
+// 'sender' to the list in the field 'list_id' on behalf of the user. For mails
+// the sender is the email address, for chats whatever the chat integration
+// sends as sender. The alias is only used once the sender has sent a message
+// containing the code in the response, which proves that it is theirs.
+func (server *Server) AddIngestAlias(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "sender", "list_id")
+	if !success {
+		return err
+	}
+	sender, listIdStr := values[0], values[1]
+	listId, err := strconv.Atoi(listIdStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'list_id' must be a valid integer",
+		})
+	}
+	if len(sender) > 200 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'sender' must not be longer than 200 characters",
+		})
+	}
+
+	success, err = requireEditor(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	alias, err := server.IngestService.Add(user.Id, listId, sender)
+	if errors.Is(err, sqlite.ErrDuplicateAlias) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add alias",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added alias for %s, send a message containing the code %s from it to confirm it", alias.Sender, alias.Code),
+		Data:    alias,
+	})
+}
+
+func (server *Server) DeleteIngestAlias(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	alias, err := server.IngestService.Get(id)
+	if err != nil || alias.UserId != user.Id {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: alias %d does not exist", id),
+		})
+	}
+	_, err = server.IngestService.Delete(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete alias",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully deleted alias",
+	})
+}
+
+// IngestMessage adds the items of a chat message, sent as JSON object with the
+// keys "sender" and "text", to the list of the sender's alias.
+func (server *Server) IngestMessage(c echo.Context) error {
+	success, err := requireIngestSecret(c, server)
+	if !success {
+		return err
+	}
+
+	var message struct {
+		Sender string `json:"sender"`
+		Text   string `json:"text"`
+	}
+	err = json.NewDecoder(io.LimitReader(c.Request().Body, maxIngestSize)).Decode(&message)
+	if err != nil || message.Sender == "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: body must be a JSON object with the keys 'sender' and 'text'",
+		})
+	}
+	return server.ingest(c, message.Sender, message.Text, message.Text)
+}
+
+// IngestEmail adds the items of a mail, sent as raw RFC 5322 message in the
+// body, to the list of the alias of its sender. The mail provider forwarding
+// it is trusted to have checked that the sender is genuine.
+func (server *Server) IngestEmail(c echo.Context) error {
+	success, err := requireIngestSecret(c, server)
+	if !success {
+		return err
+	}
+
+	email, err := ingest.ParseEmail(io.LimitReader(c.Request().Body, maxIngestSize))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: body must be a mail with a sender and a text body",
+		})
+	}
+	text := email.Text
+	if len(ingest.Parse(text)) == 0 {
+		text = email.Subject
+	}
+	return server.ingest(c, email.From, text, email.Subject+"\n"+email.Text)
+}
+
+// ingest adds the items of a message from a sender. Items that are already on
+// the list are not added twice, but uncompleted if they were completed. If the
+// sender has no confirmed alias, the message confirms the alias whose code is
+// contained in the whole message instead.
+func (server *Server) ingest(c echo.Context, sender, text, message string) error {
+	alias, err := server.IngestService.Lookup(sender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return server.confirmIngestAlias(c, sender, message)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load alias",
+		})
+	}
+	// the user may have lost access to the list since adding the alias
+	role, err := server.ListService.Role(alias.List.Id, alias.UserId)
+	if err != nil || !slices.Contains([]string{RoleOwner, RoleEditor}, role) {
+		return c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user of the alias may not add entries to list %d", alias.List.Id),
+		})
+	}
+
+	items := ingest.Parse(text)
+	if len(items) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: message does not contain any items",
+		})
+	}
+	if len(items) > maxIngestItems {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: message must not contain more than %d items", maxIngestItems),
+		})
+	}
+
+	user, err := server.UserService.Get(alias.UserId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load user",
+		})
+	}
+	entries := []Entry{}
+	for _, item := range items {
+		entry, found, err := server.EntryService.Find(alias.List.Id, item.Text)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to load entries",
+			})
+		}
+
+		if !found {
+			category, err := server.CategoryService.Infer(alias.List.Id, item.Text)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, Response{
+					Success: false,
+					Message: "error: failed to infer category",
+				})
+			}
+			entry, err = server.EntryService.Add(user.Id, alias.List.Id, item.Text, category, item.Note, nil, item.Quantity)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, Response{
+					Success: false,
+					Message: "error: failed to create entry",
+				})
+			}
+			server.publish(EventEntryAdded, entry.ListId, user, entry)
+		} else if entry.Completed {
+			_, err = server.EntryService.Reopen(user.Id, entry.Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, Response{
+					Success: false,
+					Message: "error: failed to update entry",
+				})
+			}
+			entry.Completed = false
+			server.publish(EventEntryCompleted, entry.ListId, user, entry)
+		} else {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added %d entries to '%s'", len(entries), alias.List.Name),
+		Data:    entries,
+	})
+}
+
+func (server *Server) confirmIngestAlias(c echo.Context, sender, message string) error {
+	alias, err := server.IngestService.Confirm(sender, message)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: sender has no confirmed alias",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to confirm alias",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully confirmed alias for '%s'", alias.List.Name),
+		Data:    alias,
+	})
+}
+
+// requireIngestSecret checks that an inbound message carries the ingestion
+// secret in the header 'X-Ingest-Secret' or the query parameter 'secret', so
+// that only the configured mail and chat integrations can add entries.
+func requireIngestSecret(c echo.Context, server *Server) (success bool, err error) {
+	secret := c.Request().Header.Get("X-Ingest-Secret")
+	if secret == "" {
+		secret = c.QueryParam("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(server.IngestSecret)) != 1 {
+		err = c.JSON(http.StatusUnauthorized, Response{
+			Success: false,
+			Message: "error: ingestion secret is invalid",
+		})
+		return false, err
+	}
+	return true, nil
+}
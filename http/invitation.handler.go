@@ -1,34 +1,58 @@
 package http
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
 )
 
+var invitationStatuses = []string{
+	InvitationPending, InvitationAccepted, InvitationDeclined, InvitationRevoked, InvitationExpired,
+}
+
+// GetInvitations returns the invitations a user has sent or received. Only
+// pending invitations are returned unless the query parameter 'status' asks
+// for another status, or for "all" of them.
 func (server *Server) GetInvitations(c echo.Context) error {
 	user, success, err := verifySession(c, server)
 	if !success {
 		return err
 	}
 
-	invitations, err := server.InvitationService.GetInvitations(user.Id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+	filter, success, err := getFilter(c, SortCreated, SortName)
+	if !success {
+		return err
+	}
+	filter.Status = c.QueryParam("status")
+	switch {
+	case filter.Status == "":
+		filter.Status = InvitationPending
+	case filter.Status == "all":
+		filter.Status = ""
+	case !slices.Contains(invitationStatuses, filter.Status):
+		return c.JSON(http.StatusBadRequest, Response{
 			Success: false,
-			Message: "error: failed to load invitations",
+			Message: fmt.Sprintf("error: query parameter 'status' must be 'all' or one of '%s'", strings.Join(invitationStatuses, "', '")),
 		})
 	}
 
-	return c.JSON(http.StatusOK, Response{
-		Success: true,
-		Data:    invitations,
-	})
+	invitations, next, err := server.InvitationService.Query(user.Id, filter)
+	if err != nil {
+		return queryError(c, err, "error: failed to load invitations")
+	}
+	return pageResponse(c, invitations, next)
 }
 
+// Invite invites a user to a list for 'expires_in' hours, which defaults to
+// two weeks.
 func (server *Server) Invite(c echo.Context) error {
 	inviter, success, err := verifySession(c, server)
 	if !success {
@@ -48,6 +72,15 @@ func (server *Server) Invite(c echo.Context) error {
 		})
 	}
 
+	expiresAt, success, err := getExpiresIn(c, 14*24)
+	if !success {
+		return err
+	}
+
+	success, err = requireEditor(c, server, listId, inviter.Id)
+	if !success {
+		return err
+	}
 	members, err := server.ListService.Members(listId)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
@@ -55,18 +88,6 @@ func (server *Server) Invite(c echo.Context) error {
 			Message: "error: failed to load list members",
 		})
 	}
-	foundInviter := false
-	for _, member := range members {
-		if member.Id == inviter.Id {
-			foundInviter = true
-		}
-	}
-	if !foundInviter {
-		return c.JSON(http.StatusForbidden, Response{
-			Success: false,
-			Message: "error: user is not authorized to invite to this list",
-		})
-	}
 	for _, member := range members {
 		if member.Username == username {
 			return c.JSON(http.StatusBadRequest, Response{
@@ -77,6 +98,12 @@ func (server *Server) Invite(c echo.Context) error {
 	}
 
 	invitee, err := server.UserService.GetUser(username)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user '%s' does not exist, invite them with a link instead", username),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -84,7 +111,13 @@ func (server *Server) Invite(c echo.Context) error {
 		})
 	}
 
-	invitation, err := server.InvitationService.AddInvitation(inviter.Id, invitee.Id, listId)
+	invitation, err := server.InvitationService.AddInvitation(inviter.Id, invitee.Id, listId, expiresAt)
+	if errors.Is(err, sqlite.ErrDuplicateInvitation) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: %s already has a pending invitation to this list", username),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -92,6 +125,7 @@ func (server *Server) Invite(c echo.Context) error {
 		})
 	}
 
+	server.publish(EventInvitationSent, listId, inviter, invitation)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: fmt.Sprintf("successfully invited %s to '%s'", invitation.Invitee.Username, invitation.List.Name),
@@ -126,22 +160,16 @@ func (server *Server) AcceptInvitation(c echo.Context) error {
 		})
 	}
 
-	err = server.ListService.Join(invitation.List.Id, invitee.Id)
+	joined, err := server.InvitationService.Accept(token)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "error: failed to join list",
-		})
+		return respondError(c, err, invitation, "error: failed to join list")
 	}
+	invitation, _ = server.InvitationService.GetInvitation(token)
 
-	err = server.InvitationService.DeleteInvitation(token)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "error: failed to delete invitation",
-		})
+	server.publish(EventInvitationAccepted, invitation.List.Id, invitee, invitation)
+	if joined {
+		server.publish(EventMemberJoined, invitation.List.Id, invitee, invitee)
 	}
-
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: fmt.Sprintf("successfully accepted invitation to \"%s\"", invitation.List.Name),
@@ -176,17 +204,17 @@ func (server *Server) DeclineInvitation(c echo.Context) error {
 		})
 	}
 
-	err = server.InvitationService.DeleteInvitation(token)
+	err = server.InvitationService.Decline(token)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "error: failed to delete invitation",
-		})
+		return respondError(c, err, invitation, "error: failed to decline invitation")
 	}
+	invitation, _ = server.InvitationService.GetInvitation(token)
 
+	server.publish(EventInvitationDeclined, invitation.List.Id, invitee, invitation)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: "successfully declined invitation",
+		Data:    invitation,
 	})
 }
 
@@ -217,16 +245,36 @@ func (server *Server) RevokeInvitation(c echo.Context) error {
 		})
 	}
 
-	err = server.InvitationService.DeleteInvitation(token)
+	err = server.InvitationService.Revoke(token)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "error: failed to delete invitation",
-		})
+		return respondError(c, err, invitation, "error: failed to revoke invitation")
 	}
+	invitation, _ = server.InvitationService.GetInvitation(token)
 
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
 		Message: "successfully revoked invitation",
+		Data:    invitation,
+	})
+}
+
+// respondError responds to an error of responding to an invitation, which is
+// the client's fault if the invitation is not pending anymore.
+func respondError(c echo.Context, err error, invitation Invitation, message string) error {
+	if errors.Is(err, sqlite.ErrInvitationNotPending) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: invitation is %s, not pending", invitation.Status),
+		})
+	}
+	if errors.Is(err, sqlite.ErrListDeleted) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, Response{
+		Success: false,
+		Message: message,
 	})
 }
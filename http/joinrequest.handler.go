@@ -0,0 +1,245 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+const maxJoinRequestMessageLength = 500
+
+// RequestToJoin asks the members of a list to let the user join it, with an
+// optional 'message' for them.
+func (server *Server) RequestToJoin(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+	message := c.FormValue("message")
+	if utf8.RuneCountInString(message) > maxJoinRequestMessageLength {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: field 'message' must not be longer than %d characters", maxJoinRequestMessageLength),
+		})
+	}
+
+	_, err = server.ListService.Get(id)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: list %d does not exist", id),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list",
+		})
+	}
+
+	request, err := server.JoinRequestService.Add(user.Id, id, message)
+	if errors.Is(err, sqlite.ErrAlreadyMember) || errors.Is(err, sqlite.ErrDuplicateJoinRequest) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create join request",
+		})
+	}
+
+	server.publish(EventJoinRequested, id, user, request)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully asked to join '%s'", request.List.Name),
+		Data:    request,
+	})
+}
+
+// GetJoinRequests returns the pending requests to join a list to the members
+// who may answer them.
+func (server *Server) GetJoinRequests(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	requests, err := server.JoinRequestService.Pending(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load join requests",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// GetSentJoinRequests returns the requests to join lists the user has made,
+// including how they were answered.
+func (server *Server) GetSentJoinRequests(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	requests, err := server.JoinRequestService.Sent(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load join requests",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// ApproveJoinRequest lets the requester join the list with 'role', either
+// "editor" (the default) or "viewer".
+func (server *Server) ApproveJoinRequest(c echo.Context) error {
+	user, request, success, err := server.loadJoinRequest(c)
+	if !success {
+		return err
+	}
+
+	role := c.FormValue("role")
+	if role == "" {
+		role = RoleEditor
+	}
+	if role != RoleEditor && role != RoleViewer {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: field 'role' must be '%s' or '%s'", RoleEditor, RoleViewer),
+		})
+	}
+
+	joined, err := server.JoinRequestService.Approve(request.Id, user.Id, role)
+	if err != nil {
+		return joinRequestError(c, err, "error: failed to approve join request")
+	}
+	request, err = server.JoinRequestService.Get(request.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load join request",
+		})
+	}
+
+	server.publish(EventJoinApproved, request.List.Id, user, request)
+	if joined {
+		server.publish(EventMemberJoined, request.List.Id, request.User, request.User)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added %s to '%s'", request.User.Username, request.List.Name),
+		Data:    request,
+	})
+}
+
+func (server *Server) RejectJoinRequest(c echo.Context) error {
+	user, request, success, err := server.loadJoinRequest(c)
+	if !success {
+		return err
+	}
+
+	err = server.JoinRequestService.Reject(request.Id, user.Id)
+	if err != nil {
+		return joinRequestError(c, err, "error: failed to reject join request")
+	}
+	request, err = server.JoinRequestService.Get(request.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load join request",
+		})
+	}
+
+	server.publish(EventJoinRejected, request.List.Id, user, request)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully rejected %s's request to join '%s'", request.User.Username, request.List.Name),
+		Data:    request,
+	})
+}
+
+// loadJoinRequest loads the join request in the path and checks that the user
+// may answer it.
+func (server *Server) loadJoinRequest(c echo.Context) (user User, request JoinRequest, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, request, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+		return user, request, false, err
+	}
+
+	request, err = server.JoinRequestService.Get(id)
+	if err != nil {
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: join request %d does not exist", id),
+		})
+		return user, request, false, err
+	}
+	success, err = requireEditor(c, server, request.List.Id, user.Id)
+	return user, request, success, err
+}
+
+// joinRequestError responds to an error of answering a join request, which is
+// the client's fault if it has been answered already.
+func joinRequestError(c echo.Context, err error, message string) error {
+	if errors.Is(err, sqlite.ErrJoinRequestNotPending) || errors.Is(err, sqlite.ErrListDeleted) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, Response{
+		Success: false,
+		Message: message,
+	})
+}
@@ -0,0 +1,309 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+// AddLink creates an invitation link to a list. The optional fields are
+// 'role', either "editor" (the default) or "viewer", 'expires_in' in hours,
+// which defaults to a week, and 'max_uses', which defaults to no limit.
+func (server *Server) AddLink(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	role := c.FormValue("role")
+	if role == "" {
+		role = RoleEditor
+	}
+	if role != RoleEditor && role != RoleViewer {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: field 'role' must be '%s' or '%s'", RoleEditor, RoleViewer),
+		})
+	}
+	expiresAt, success, err := getExpiresIn(c, 7*24)
+	if !success {
+		return err
+	}
+	maxUses := 0
+	if maxUsesStr := c.FormValue("max_uses"); maxUsesStr != "" {
+		maxUses, err = strconv.Atoi(maxUsesStr)
+		if err != nil || maxUses < 1 || maxUses > 1000 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'max_uses' must be an integer between 1 and 1000",
+			})
+		}
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	link, err := server.LinkService.Add(user.Id, id, role, expiresAt, maxUses)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create invitation link",
+		})
+	}
+	link.URL = server.linkURL(link.Token)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully created invitation link to '%s'", link.List.Name),
+		Data:    link,
+	})
+}
+
+// GetLinks returns the links of a list that can still be used. Owners see
+// all of them, other members only the ones they created.
+func (server *Server) GetLinks(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+	role, err := server.ListService.Role(id, user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+	}
+
+	links, err := server.LinkService.Outstanding(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load invitation links",
+		})
+	}
+	visible := []InviteLink{}
+	for _, link := range links {
+		if role == RoleOwner || link.Creator.Id == user.Id {
+			link.URL = server.linkURL(link.Token)
+			visible = append(visible, link)
+		}
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    visible,
+	})
+}
+
+// GetLink shows what an invitation link is for. It does not require a
+// session, so that people without an account can see what they are invited
+// to before registering.
+func (server *Server) GetLink(c echo.Context) error {
+	token := c.Param("token")
+	link, err := server.LinkService.Get(token)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: invitation link does not exist",
+		})
+	}
+	if !link.Usable(time.Now()) {
+		return c.JSON(http.StatusGone, Response{
+			Success: false,
+			Message: sqlite.ErrLinkUnusable.Error(),
+		})
+	}
+
+	link.URL = server.linkURL(link.Token)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    link,
+	})
+}
+
+func (server *Server) JoinLink(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	list, success, err := server.redeemLink(c, c.Param("token"), user)
+	if !success {
+		return err
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully joined list '%s'", list.Name),
+		Data:    list,
+	})
+}
+
+// RevokeLink revokes a link, which only its creator and the owners of its
+// list may do.
+func (server *Server) RevokeLink(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	token := c.Param("token")
+	link, err := server.LinkService.Get(token)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: invitation link does not exist",
+		})
+	}
+	if link.Creator.Id != user.Id {
+		success, err = requireRole(c, server, link.List.Id, user.Id, RoleOwner)
+		if !success {
+			return err
+		}
+	}
+
+	revoked, err := server.LinkService.Revoke(token)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to revoke invitation link",
+		})
+	}
+	if !revoked {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: invitation link has already been revoked",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully revoked invitation link",
+	})
+}
+
+// redeemLink adds the user to the list of a link and tells the other members.
+func (server *Server) redeemLink(c echo.Context, token string, user User) (list List, success bool, err error) {
+	link, err := server.LinkService.Redeem(token, user.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: invitation link does not exist",
+		})
+		return list, false, err
+	case errors.Is(err, sqlite.ErrLinkUnusable):
+		err = c.JSON(http.StatusGone, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return list, false, err
+	case errors.Is(err, sqlite.ErrAlreadyMember):
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return list, false, err
+	case err != nil:
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to join list",
+		})
+		return list, false, err
+	}
+
+	list, err = server.ListService.Get(link.List.Id)
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list",
+		})
+		return list, false, err
+	}
+	server.publish(EventMemberJoined, list.Id, user, user)
+	return list, true, nil
+}
+
+// linkURL returns the URL of an invitation link. It is built from the
+// configured base URL rather than the Host header of the request, which
+// clients control.
+func (server *Server) linkURL(token string) string {
+	return server.BaseURL + "/link/" + token
+}
+
+// getLinkToken loads the link in the optional field 'link_token', which can be
+// sent when registering or logging in to join its list right away. It is
+// checked before the user is authenticated, so that nobody registers through
+// a dead link. link is nil if no token was sent.
+func (server *Server) getLinkToken(c echo.Context) (link *InviteLink, success bool, err error) {
+	token := c.FormValue("link_token")
+	if token == "" {
+		return nil, true, nil
+	}
+
+	found, err := server.LinkService.Get(token)
+	if err != nil {
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: invitation link does not exist",
+		})
+		return nil, false, err
+	}
+	if !found.Usable(time.Now()) {
+		err = c.JSON(http.StatusGone, Response{
+			Success: false,
+			Message: sqlite.ErrLinkUnusable.Error(),
+		})
+		return nil, false, err
+	}
+	return &found, true, nil
+}
+
+// joinAfterAuth redeems a link from getLinkToken for a user who just
+// authenticated, unless they are a member of its list already.
+func (server *Server) joinAfterAuth(c echo.Context, link *InviteLink, user User) (success bool, err error) {
+	if link == nil {
+		return true, nil
+	}
+	member, err := server.ListService.IsMember(link.List.Id, user.Id)
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+		return false, err
+	}
+	if member {
+		return true, nil
+	}
+	_, success, err = server.redeemLink(c, link.Token, user)
+	return success, err
+}
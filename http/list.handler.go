@@ -3,7 +3,11 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 	. "github.com/slh335/shoppinglistserver"
@@ -15,17 +19,31 @@ func (server *Server) GetLists(c echo.Context) error {
 		return err
 	}
 
-	lists, err := server.ListService.All(user.Id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Response{
+	filter, success, err := getFilter(c, SortCreated, SortName)
+	if !success {
+		return err
+	}
+	// archived lists are hidden unless asked for with 'true' or 'all'
+	switch c.QueryParam("archived") {
+	case "", "false":
+		archived := false
+		filter.Archived = &archived
+	case "true":
+		archived := true
+		filter.Archived = &archived
+	case "all":
+	default:
+		return c.JSON(http.StatusBadRequest, Response{
 			Success: false,
-			Message: "error: failed to load lists",
+			Message: "error: query parameter 'archived' must be 'true', 'false' or 'all'",
 		})
 	}
-	return c.JSON(http.StatusOK, Response{
-		Success: true,
-		Data:    lists,
-	})
+
+	lists, next, err := server.ListService.Query(user.Id, filter)
+	if err != nil {
+		return queryError(c, err, "error: failed to load lists")
+	}
+	return pageResponse(c, lists, next)
 }
 
 func (server *Server) AddList(c echo.Context) error {
@@ -53,7 +71,17 @@ func (server *Server) AddList(c echo.Context) error {
 	})
 }
 
-func (server *Server) DeleteList(c echo.Context) error {
+var (
+	colorPattern = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+	listIcons    = []string{
+		"cart", "basket", "bag", "gift", "party", "cake", "holiday", "home", "food", "drink",
+		"baby", "pet", "pharmacy", "hardware", "garden", "clothes", "star", "heart",
+	}
+)
+
+// UpdateList changes the name and appearance of a list. Only the fields that
+// are sent are changed, and an empty value clears everything but the name.
+func (server *Server) UpdateList(c echo.Context) error {
 	user, success, err := verifySession(c, server)
 	if !success {
 		return err
@@ -68,6 +96,10 @@ func (server *Server) DeleteList(c echo.Context) error {
 		})
 	}
 
+	success, err = requireRole(c, server, id, user.Id, RoleOwner, RoleEditor)
+	if !success {
+		return err
+	}
 	list, err := server.ListService.Get(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
@@ -76,27 +108,89 @@ func (server *Server) DeleteList(c echo.Context) error {
 		})
 	}
 
-	if list.Creator.Id != user.Id {
-		return c.JSON(http.StatusForbidden, Response{
+	badRequest := func(message string) error {
+		return c.JSON(http.StatusBadRequest, Response{
 			Success: false,
-			Message: "error: user is not authorized to delete that list",
+			Message: message,
 		})
 	}
+	if name, ok := getOptionalFormValue(c, "name"); ok {
+		list.Name = strings.TrimSpace(name)
+		if list.Name == "" || utf8.RuneCountInString(list.Name) > 100 {
+			return badRequest("error: field 'name' must be between 1 and 100 characters long")
+		}
+	}
+	if description, ok := getOptionalFormValue(c, "description"); ok {
+		list.Description = strings.TrimSpace(description)
+		if utf8.RuneCountInString(list.Description) > 1000 {
+			return badRequest("error: field 'description' must not be longer than 1000 characters")
+		}
+	}
+	if color, ok := getOptionalFormValue(c, "color"); ok {
+		list.Color = strings.ToLower(color)
+		if list.Color != "" && !colorPattern.MatchString(list.Color) {
+			return badRequest("error: field 'color' must be a hex colour like '#1e90ff'")
+		}
+	}
+	if icon, ok := getOptionalFormValue(c, "icon"); ok {
+		list.Icon = icon
+		if list.Icon != "" && !slices.Contains(listIcons, list.Icon) {
+			return badRequest(fmt.Sprintf("error: field 'icon' must be one of '%s'", strings.Join(listIcons, "', '")))
+		}
+	}
+	if emoji, ok := getOptionalFormValue(c, "emoji"); ok {
+		list.Emoji = emoji
+		if list.Emoji != "" && !isEmoji(list.Emoji) {
+			return badRequest("error: field 'emoji' must be a single emoji")
+		}
+	}
 
-	err = server.ListService.Delete(id)
-	if err != nil {
+	updated, err := server.ListService.Update(list)
+	if err != nil || !updated {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
-			Message: "error: failed to delete list",
+			Message: "error: failed to update list",
 		})
 	}
+	server.publish(EventListUpdated, id, user, list)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
-		Message: "successfully deleted list",
+		Message: "successfully updated list",
+		Data:    list,
 	})
 }
 
-func (server *Server) JoinList(c echo.Context) error {
+// isEmoji reports whether s looks like a single emoji, which may be made up of
+// several code points joined by zero width joiners or followed by modifiers.
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 || len(runes) > 10 || runes[0] == 0x200d || runes[0] == 0xfe0f {
+		return false
+	}
+	for _, r := range runes {
+		switch {
+		case r >= 0x1f000 && r <= 0x1faff, // pictographs, flags and skin tones
+			r >= 0x2300 && r <= 0x23ff,   // technical symbols like ⌚
+			r >= 0x2600 && r <= 0x27bf,   // symbols and dingbats like ☕
+			r >= 0x2b00 && r <= 0x2bff,   // arrows and stars like ⭐
+			r >= 0xe0020 && r <= 0xe007f, // tags of subdivision flags
+			r == 0x200d, r == 0xfe0f, r == 0x20e3:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (server *Server) ArchiveList(c echo.Context) error {
+	return server.archiveList(c, true)
+}
+
+func (server *Server) UnarchiveList(c echo.Context) error {
+	return server.archiveList(c, false)
+}
+
+func (server *Server) archiveList(c echo.Context, archived bool) error {
 	user, success, err := verifySession(c, server)
 	if !success {
 		return err
@@ -111,14 +205,61 @@ func (server *Server) JoinList(c echo.Context) error {
 		})
 	}
 
-	err = server.ListService.Join(id, user.Id)
+	success, err = requireRole(c, server, id, user.Id, RoleOwner, RoleEditor)
+	if !success {
+		return err
+	}
+
+	changed, err := server.ListService.Archive(id, archived)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to archive list",
+		})
+	}
+	list, err := server.ListService.Get(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
-			Message: "error: failed to join list",
+			Message: "error: failed to load list",
+		})
+	}
+
+	eventType, message := EventListArchived, "successfully archived list"
+	if !archived {
+		eventType, message = EventListUnarchived, "successfully unarchived list"
+	}
+	if changed {
+		server.publish(eventType, id, user, list)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    list,
+	})
+}
+
+// DuplicateList copies a list with its uncompleted entries into a new list
+// owned by the user, named after the field 'name' or the original list.
+func (server *Server) DuplicateList(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
 		})
 	}
 
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
 	list, err := server.ListService.Get(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
@@ -126,22 +267,93 @@ func (server *Server) JoinList(c echo.Context) error {
 			Message: "error: failed to load list",
 		})
 	}
-	entries, err := server.EntryService.All(id)
+	name, success, err := getListName(c, list.Name+" (copy)")
+	if !success {
+		return err
+	}
+
+	duplicate, err := server.ListService.Duplicate(user.Id, id, name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to duplicate list",
+		})
+	}
+	duplicate.Entries, err = server.EntryService.All(duplicate.Id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Message: "error: failed to load entries",
 		})
 	}
-	list.Entries = entries
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully duplicated list",
+		Data:    duplicate,
+	})
+}
+
+// getListName returns the trimmed field 'name', or fallback if it is not sent.
+func getListName(c echo.Context, fallback string) (name string, success bool, err error) {
+	name = strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		name = fallback
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'name' must be between 1 and 100 characters long",
+		})
+		return name, false, err
+	}
+	return name, true, nil
+}
+
+func (server *Server) DeleteList(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	list, err := server.ListService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list",
+		})
+	}
+
+	success, err = requireRole(c, server, id, user.Id, RoleOwner)
+	if !success {
+		return err
+	}
 
+	token, err := server.ListService.Delete(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete list",
+		})
+	}
+	server.publish(EventListDeleted, id, user, list)
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
-		Message: "successfully joined list",
-		Data:    list,
+		Message: "successfully deleted list",
+		Data:    server.undo(token, id),
 	})
 }
 
+// LeaveList takes the user out of a list. See ListService.RemoveMember for
+// what happens to lists that would be left without an owner or members.
 func (server *Server) LeaveList(c echo.Context) error {
 	user, success, err := verifySession(c, server)
 	if !success {
@@ -157,16 +369,51 @@ func (server *Server) LeaveList(c echo.Context) error {
 		})
 	}
 
-	err = server.ListService.Leave(id, user.Id)
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	return server.removeMember(c, id, user, user, EventMemberLeft)
+}
+
+func (server *Server) RerankList(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	err = server.EntryService.Rerank(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
-			Message: "error: failed to leave list",
+			Message: "error: failed to repair list order",
+		})
+	}
+	entries, err := server.EntryService.All(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entries",
 		})
 	}
-
 	return c.JSON(http.StatusOK, Response{
 		Success: true,
-		Message: "successfully left list",
+		Message: "successfully repaired list order",
+		Data:    entries,
 	})
 }
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/mail"
+)
+
+const (
+	passwordResetExpiry = time.Hour
+	// digestItems is how many open entries of a list are shown in a digest.
+	digestItems = 20
+)
+
+// mailLayout holds the fields the header and footer of every mail need.
+type mailLayout struct {
+	Subject     string
+	URL         string
+	Unsubscribe string
+}
+
+type invitationMail struct {
+	mailLayout
+	Invitee   string
+	Inviter   string
+	List      string
+	ExpiresAt time.Time
+}
+
+type resetMail struct {
+	mailLayout
+	Username string
+}
+
+type verifyMail struct {
+	mailLayout
+	Username string
+}
+
+type unsubscribePage struct {
+	mailLayout
+	Token string
+	Done  bool
+}
+
+type verifyPage struct {
+	mailLayout
+	Token string
+	Email string
+	Done  bool
+}
+
+type resetPage struct {
+	mailLayout
+	Token string
+	Done  bool
+}
+
+type digestMail struct {
+	mailLayout
+	Username string
+	Lists    []digestList
+}
+
+type digestList struct {
+	Name  string
+	Items []string
+	More  int
+}
+
+// sendVerification mails the link to verify their address to a user whose
+// address is not verified yet.
+func (server *Server) sendVerification(settings EmailSettings) (err error) {
+	if settings.Verified {
+		return nil
+	}
+	layout := mailLayout{
+		Subject: "Confirm your email address",
+		URL:     server.BaseURL + "/user/email/verify?token=" + settings.VerificationToken,
+	}
+	return server.sendMail(settings.Email, "verify", layout, verifyMail{
+		mailLayout: layout,
+		Username:   settings.User.Username,
+	})
+}
+
+// sendMail renders the templates of a mail and sends it. Nothing is sent if no
+// mailer is configured.
+func (server *Server) sendMail(to, template string, layout mailLayout, data any) (err error) {
+	if server.Mailer == nil {
+		return nil
+	}
+	text, html, err := mail.Render(template, data)
+	if err != nil {
+		return err
+	}
+	return server.Mailer.Send(mail.Message{
+		To:          to,
+		Subject:     layout.Subject,
+		Text:        text,
+		HTML:        html,
+		Unsubscribe: layout.Unsubscribe,
+	})
+}
+
+func (server *Server) unsubscribeURL(settings EmailSettings) string {
+	return server.BaseURL + "/mail/unsubscribe?token=" + settings.UnsubscribeToken
+}
+
+// MailNotify mails invitations to invitees with a verified address who turned
+// on email notifications and have not turned off notifications of invitations.
+func (server *Server) MailNotify(event Event) (err error) {
+	invitation, ok := event.Data.(Invitation)
+	if event.Type != EventInvitationSent || !ok {
+		return nil
+	}
+
+	settings, err := server.EmailService.Settings(invitation.Invitee.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	preferences, err := server.NotificationService.Preferences(invitation.Invitee.Id)
+	if err != nil {
+		return err
+	}
+	if !settings.Verified || !settings.Notifications || !preferences[event.Type] {
+		return nil
+	}
+
+	layout := mailLayout{
+		Subject:     invitation.Inviter.Username + " invited you to " + invitation.List.Name,
+		URL:         server.BaseURL,
+		Unsubscribe: server.unsubscribeURL(settings),
+	}
+	return server.sendMail(settings.Email, "invitation", layout, invitationMail{
+		mailLayout: layout,
+		Invitee:    settings.User.Username,
+		Inviter:    invitation.Inviter.Username,
+		List:       invitation.List.Name,
+		ExpiresAt:  invitation.ExpiresAt,
+	})
+}
+
+// SendDigests mails the open entries of their lists to the users whose digest
+// is due. Users without open entries get no mail, but their digest counts as
+// sent all the same.
+func (server *Server) SendDigests(now time.Time) (err error) {
+	due, err := server.EmailService.DueDigests(now)
+	if err != nil {
+		return err
+	}
+
+	for _, settings := range due {
+		lists, err := server.digestLists(settings.User.Id)
+		if err != nil {
+			return err
+		}
+		if len(lists) > 0 {
+			layout := mailLayout{
+				Subject:     "Your open shopping lists",
+				URL:         server.BaseURL,
+				Unsubscribe: server.unsubscribeURL(settings),
+			}
+			err = server.sendMail(settings.Email, "digest", layout, digestMail{
+				mailLayout: layout,
+				Username:   settings.User.Username,
+				Lists:      lists,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = server.EmailService.DigestSent(settings.User.Id, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// digestLists returns the lists of a user that are not archived and have open
+// entries, with up to digestItems of them each.
+func (server *Server) digestLists(userId int) (lists []digestList, err error) {
+	archived, completed := false, false
+	all, _, err := server.ListService.Query(userId, Filter{Archived: &archived})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, list := range all {
+		entries, _, err := server.EntryService.Query(list.Id, Filter{Completed: &completed})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		digest := digestList{Name: list.Name}
+		for _, entry := range entries[:min(len(entries), digestItems)] {
+			digest.Items = append(digest.Items, entry.Text)
+		}
+		digest.More = len(entries) - len(digest.Items)
+		lists = append(lists, digest)
+	}
+	return lists, nil
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// maxMealPlanDays is the longest period meals are returned or added to a list
+// for at once.
+const maxMealPlanDays = 62
+
+// GetMeals returns the meal plan of the user from the day in the query
+// parameter 'from' to the day in 'to', both in the format 2006-01-02. It
+// defaults to the current week, from Monday to Sunday.
+func (server *Server) GetMeals(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	from, to, success, err := getPeriod(c, c.QueryParam("from"), c.QueryParam("to"))
+	if !success {
+		return err
+	}
+
+	meals, err := server.RecipeService.Meals(user.Id, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load meals",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    meals,
+	})
+}
+
+// AddMeal plans the recipe in the field 'recipe_id' for the day in the field
+// 'date', in the format 2006-01-02. The optional field 'servings' defaults to
+// the servings of the recipe.
+func (server *Server) AddMeal(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "recipe_id", "date")
+	if !success {
+		return err
+	}
+	recipeId, err := strconv.Atoi(values[0])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'recipe_id' must be a valid integer",
+		})
+	}
+	date, err := time.Parse(time.DateOnly, values[1])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'date' must be a date in the format YYYY-MM-DD",
+		})
+	}
+
+	recipe, err := server.RecipeService.Get(recipeId)
+	if err != nil || recipe.UserId != user.Id {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: recipe %d does not exist", recipeId),
+		})
+	}
+	servings := recipe.Servings
+	if servingsStr, ok := getOptionalFormValue(c, "servings"); ok {
+		servings, success, err = getServings(c, servingsStr)
+		if !success {
+			return err
+		}
+	}
+
+	meal, err := server.RecipeService.AddMeal(user.Id, recipe.Id, date.Format(time.DateOnly), servings)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add meal",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully planned '%s' for %s", recipe.Name, meal.Date),
+		Data:    meal,
+	})
+}
+
+func (server *Server) DeleteMeal(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	meal, err := server.RecipeService.Meal(id)
+	if err != nil || meal.UserId != user.Id {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: meal %d does not exist", id),
+		})
+	}
+	_, err = server.RecipeService.DeleteMeal(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete meal",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully deleted meal",
+	})
+}
+
+// AddMealsToList adds the ingredients of the meals planned from the day in the
+// field 'from' to the day in the field 'to', by default the current week, to
+// the list in the field 'list_id'. The ingredients are scaled to the servings
+// of each meal, and the same ingredients of several meals are merged.
+func (server *Server) AddMealsToList(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "list_id")
+	if !success {
+		return err
+	}
+	listId, err := strconv.Atoi(values[0])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'list_id' must be a valid integer",
+		})
+	}
+	from, to, success, err := getPeriod(c, c.FormValue("from"), c.FormValue("to"))
+	if !success {
+		return err
+	}
+
+	meals, err := server.RecipeService.Meals(user.Id, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load meals",
+		})
+	}
+	if len(meals) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: no meals are planned from %s to %s", from, to),
+		})
+	}
+
+	recipes := map[int]Recipe{}
+	ingredients := []Ingredient{}
+	for _, meal := range meals {
+		recipe, ok := recipes[meal.Recipe.Id]
+		if !ok {
+			recipe, err = server.RecipeService.Get(meal.Recipe.Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, Response{
+					Success: false,
+					Message: "error: failed to load recipe",
+				})
+			}
+			recipes[recipe.Id] = recipe
+		}
+		ingredients = append(ingredients, recipe.Scaled(meal.Servings)...)
+	}
+
+	return server.addIngredients(c, user, listId, ingredients)
+}
+
+// getPeriod parses the first and last day of a period in the format
+// 2006-01-02. Without a first day the period is the current week, without a
+// last day the week from the first day.
+func getPeriod(c echo.Context, fromStr, toStr string) (from, to string, success bool, err error) {
+	badRequest := func(message string) (string, string, bool, error) {
+		return "", "", false, c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: message,
+		})
+	}
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	if fromStr != "" {
+		start, err = time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			return badRequest("error: 'from' must be a date in the format YYYY-MM-DD")
+		}
+	}
+	end := start.AddDate(0, 0, 6)
+	if toStr != "" {
+		end, err = time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			return badRequest("error: 'to' must be a date in the format YYYY-MM-DD")
+		}
+	}
+	if end.Before(start) || end.Sub(start) > maxMealPlanDays*24*time.Hour {
+		return badRequest(fmt.Sprintf("error: 'to' must be up to %d days after 'from'", maxMealPlanDays))
+	}
+	return start.Format(time.DateOnly), end.Format(time.DateOnly), true, nil
+}
@@ -0,0 +1,219 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+func (server *Server) GetMembers(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	members, err := server.ListService.MemberRoles(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    members,
+	})
+}
+
+// RemoveMember takes another member out of a list, which only its owners may
+// do.
+func (server *Server) RemoveMember(c echo.Context) error {
+	user, id, member, success, err := server.loadMember(c)
+	if !success {
+		return err
+	}
+
+	return server.removeMember(c, id, user, member, EventMemberRemoved)
+}
+
+// TransferOwnership makes the member in the field 'user_id' the owner of a
+// list in place of the user, who becomes an editor.
+func (server *Server) TransferOwnership(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+	values, success, err := getFormValues(c, "user_id")
+	if !success {
+		return err
+	}
+	memberId, err := strconv.Atoi(values[0])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'user_id' must be a valid integer",
+		})
+	}
+	if memberId == user.Id {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: user already owns the list",
+		})
+	}
+
+	success, err = requireRole(c, server, id, user.Id, RoleOwner)
+	if !success {
+		return err
+	}
+
+	err = server.ListService.TransferOwnership(id, user.Id, memberId)
+	if errors.Is(err, sqlite.ErrNotMember) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user %d is not a member of list %d", memberId, id),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to transfer ownership",
+		})
+	}
+
+	members, err := server.ListService.MemberRoles(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+	}
+	for _, member := range members {
+		if member.Id == memberId {
+			server.publish(EventOwnerChanged, id, user, member)
+		}
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully transferred ownership",
+		Data:    members,
+	})
+}
+
+// removeMember takes a member out of a list and tells the remaining members,
+// including who owns the list now if the member was its last owner. The
+// deletion of a list its last member left can be undone.
+func (server *Server) removeMember(c echo.Context, listId int, user, member User, eventType string) error {
+	successor, token, err := server.ListService.RemoveMember(listId, member.Id)
+	if errors.Is(err, sqlite.ErrNotMember) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: user %d is not a member of list %d", member.Id, listId),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to remove member",
+		})
+	}
+
+	if token != "" {
+		server.publish(EventListDeleted, listId, user, List{Id: listId})
+		return c.JSON(http.StatusOK, Response{
+			Success: true,
+			Message: "successfully deleted list, as its last member left",
+			Data:    server.undo(token, listId),
+		})
+	}
+	server.publish(eventType, listId, user, User{Id: member.Id, Username: member.Username})
+	message := fmt.Sprintf("successfully removed %s from list", member.Username)
+	if eventType == EventMemberLeft {
+		message = "successfully left list"
+	}
+	if successor != nil {
+		server.publish(EventMemberPromoted, listId, user, *successor)
+		message += fmt.Sprintf(", %s is its owner now", successor.Username)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+	})
+}
+
+// loadMember loads the member in the path of a list the user owns.
+func (server *Server) loadMember(c echo.Context) (user User, listId int, member User, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, 0, member, false, err
+	}
+
+	idStr := c.Param("id")
+	listId, err = strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+		return user, 0, member, false, err
+	}
+	userIdStr := c.Param("userId")
+	member.Id, err = strconv.Atoi(userIdStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", userIdStr),
+		})
+		return user, 0, member, false, err
+	}
+
+	success, err = requireRole(c, server, listId, user.Id, RoleOwner)
+	if !success {
+		return user, 0, member, false, err
+	}
+	members, err := server.ListService.MemberRoles(listId)
+	if err != nil {
+		err = c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list members",
+		})
+		return user, 0, member, false, err
+	}
+	for _, m := range members {
+		if m.Id == member.Id {
+			return user, listId, m.User, true, nil
+		}
+	}
+	err = c.JSON(http.StatusBadRequest, Response{
+		Success: false,
+		Message: fmt.Sprintf("error: user %d is not a member of list %d", member.Id, listId),
+	})
+	return user, 0, member, false, err
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// GetNotifications returns a page of the user's notifications, newest first.
+// The query parameter 'read' narrows them down to read or unread ones.
+func (server *Server) GetNotifications(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	filter, success, err := getFilter(c, SortCreated)
+	if !success {
+		return err
+	}
+	if readStr := c.QueryParam("read"); readStr != "" {
+		read, err := strconv.ParseBool(readStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'read' must be a boolean",
+			})
+		}
+		filter.Read = &read
+	}
+
+	notifications, next, err := server.NotificationService.Query(user.Id, filter)
+	if err != nil {
+		return queryError(c, err, "error: failed to load notifications")
+	}
+	return pageResponse(c, notifications, next)
+}
+
+func (server *Server) GetUnreadNotifications(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	unread, err := server.NotificationService.Unread(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to count notifications",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    unread,
+	})
+}
+
+// MarkNotificationsRead marks the notifications in the optional field 'ids',
+// a comma separated list, as read, or all of them without it.
+func (server *Server) MarkNotificationsRead(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	var ids []int
+	if c.FormValue("ids") != "" {
+		ids, success, err = parseIds(c, "ids")
+		if !success {
+			return err
+		}
+	}
+
+	marked, err := server.NotificationService.MarkRead(user.Id, ids)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to mark notifications as read",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully marked %d notifications as read", marked),
+	})
+}
+
+// GetNotificationPreferences returns for each notification type whether the
+// user is notified of it.
+func (server *Server) GetNotificationPreferences(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	preferences, err := server.NotificationService.Preferences(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load notification preferences",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    preferences,
+	})
+}
+
+// SetNotificationPreferences turns notification types on or off. Each field
+// is named after a notification type and holds a boolean; types that are not
+// sent are left as they are.
+func (server *Server) SetNotificationPreferences(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	changes := map[string]bool{}
+	for _, notificationType := range NotificationTypes {
+		enabledStr, ok := getOptionalFormValue(c, notificationType)
+		if !ok {
+			continue
+		}
+		enabled, err := strconv.ParseBool(enabledStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("error: field '%s' must be a boolean", notificationType),
+			})
+		}
+		changes[notificationType] = enabled
+	}
+	if len(changes) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: at least one notification type must be provided",
+		})
+	}
+
+	err = server.NotificationService.SetPreferences(user.Id, changes)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to save notification preferences",
+		})
+	}
+	preferences, err := server.NotificationService.Preferences(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load notification preferences",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully saved notification preferences",
+		Data:    preferences,
+	})
+}
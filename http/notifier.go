@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"slices"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// Notify records a notification of an event for everyone it concerns, except
+// the user who caused it. Events that are not one of the NotificationTypes are
+// ignored.
+func (server *Server) Notify(event Event) (err error) {
+	if !slices.Contains(NotificationTypes, event.Type) {
+		return nil
+	}
+
+	recipients, err := server.recipients(event)
+	if err != nil {
+		return err
+	}
+	recipients = slices.DeleteFunc(recipients, func(id int) bool {
+		return id == event.User.Id
+	})
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	return server.NotificationService.Add(recipients, Notification{
+		Type:      event.Type,
+		ListId:    event.ListId,
+		Actor:     event.User,
+		Data:      data,
+		CreatedAt: event.CreatedAt,
+	})
+}
+
+// recipients returns who is notified of an event: the other side of
+// invitations and join requests, the removed member, the members who may
+// answer join requests, the owners of lists entries were added to, and all
+// members of the list otherwise.
+func (server *Server) recipients(event Event) (userIds []int, err error) {
+	switch data := event.Data.(type) {
+	case Invitation:
+		if event.Type == EventInvitationSent {
+			return []int{data.Invitee.Id}, nil
+		}
+		return []int{data.Inviter.Id}, nil
+	case JoinRequest:
+		if event.Type != EventJoinRequested {
+			return []int{data.User.Id}, nil
+		}
+	case User:
+		if event.Type == EventMemberRemoved {
+			return []int{data.Id}, nil
+		}
+	}
+
+	roles := []string{RoleOwner, RoleEditor, RoleViewer}
+	switch event.Type {
+	case EventJoinRequested:
+		roles = []string{RoleOwner, RoleEditor}
+	case EventEntryAdded, EventEntriesAdded:
+		roles = []string{RoleOwner}
+	}
+	members, err := server.ListService.MemberRoles(event.ListId)
+	if err != nil {
+		return userIds, err
+	}
+	for _, member := range members {
+		if slices.Contains(roles, member.Role) {
+			userIds = append(userIds, member.Id)
+		}
+	}
+	return userIds, nil
+}
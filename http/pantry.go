@@ -0,0 +1,100 @@
+package http
+
+import (
+	"math"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// Restock adds the quantities of completed entries to the stock of the items
+// of the same name in the pantry of their list. Entries without a quantity
+// count as one piece, and entries whose unit cannot be converted into the unit
+// of the item are left out. Uncompleting an entry takes back what it added.
+func (server *Server) Restock(event Event) (err error) {
+	var entries []Entry
+	completed := false
+	switch data := event.Data.(type) {
+	case Entry:
+		if event.Type == EventEntryCompleted {
+			entries = append(entries, data)
+			completed = data.Completed
+		}
+	case EntryBatch:
+		if event.Type == EventEntriesCompleted {
+			for _, id := range data.Ids {
+				entry, err := server.EntryService.Get(id)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, entry)
+			}
+			completed = data.Completed
+		}
+	}
+
+	for _, entry := range entries {
+		if !completed {
+			_, err = server.PantryService.Unrestock(entry.Id)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		item, found, err := server.PantryService.Find(entry.ListId, entry.Text)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		quantity := Quantity{Amount: 1}
+		if entry.Quantity != nil {
+			quantity = *entry.Quantity
+		}
+		stock, ok := Quantity{Unit: item.Unit}.Add(quantity)
+		if !ok {
+			continue
+		}
+		_, err = server.PantryService.Restock(item.Id, entry.Id, stock.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replenish puts an item whose stock is below its minimum on the list of its
+// pantry, with what is missing to reach the minimum as quantity, unless it is
+// on the list already.
+func (server *Server) replenish(user User, item PantryItem) (err error) {
+	if !item.Low() {
+		return nil
+	}
+	entry, found, err := server.EntryService.Find(item.ListId, item.Name)
+	if err != nil {
+		return err
+	}
+	if found && !entry.Completed {
+		return nil
+	}
+
+	category, err := server.CategoryService.Infer(item.ListId, item.Name)
+	if err != nil {
+		return err
+	}
+	missing := math.Round((*item.Minimum-item.Stock)*1000) / 1000
+	added, updated, reopened, err := server.EntryService.Merge(user.Id, item.ListId, []Entry{{
+		Text:     item.Name,
+		Category: category,
+		Quantity: &Quantity{Amount: missing, Unit: item.Unit},
+	}})
+	if err != nil {
+		return err
+	}
+	for _, entry := range added {
+		server.publish(EventEntryAdded, entry.ListId, user, entry)
+	}
+	server.publishMerged(user, updated, reopened)
+	return nil
+}
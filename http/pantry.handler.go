@@ -0,0 +1,296 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/sqlite"
+)
+
+// GetPantry returns the items of the pantry of a list. The optional query
+// parameter 'expiring' narrows them down to the items that expire within that
+// many days, including the expired ones.
+func (server *Server) GetPantry(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	expiresBy := ""
+	if expiringStr := c.QueryParam("expiring"); expiringStr != "" {
+		days, err := strconv.Atoi(expiringStr)
+		if err != nil || days < 0 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'expiring' must be a positive integer",
+			})
+		}
+		expiresBy = time.Now().AddDate(0, 0, days).Format(time.DateOnly)
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	items, err := server.PantryService.All(id, expiresBy)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load pantry",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    items,
+	})
+}
+
+// AddPantryItem adds the item in the field 'name' to the pantry of a list.
+// The optional fields 'stock', 'unit', 'minimum' and 'expires_on', in the
+// format 2006-01-02, default to an empty stock without minimum and expiry. An
+// item added with less stock than its minimum is put on the list right away.
+func (server *Server) AddPantryItem(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "name")
+	if !success {
+		return err
+	}
+	item := PantryItem{ListId: id, Name: values[0]}
+	success, err = getPantryFields(c, &item)
+	if !success {
+		return err
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	item, err = server.PantryService.Add(item)
+	if errors.Is(err, sqlite.ErrDuplicatePantryItem) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add pantry item",
+		})
+	}
+	server.replenishOrLog(user, item)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added '%s' to the pantry", item.Name),
+		Data:    item,
+	})
+}
+
+// UpdatePantryItem changes the fields 'name', 'stock', 'unit', 'minimum' and
+// 'expires_on' of a pantry item that are sent. An empty 'minimum' or
+// 'expires_on' removes the minimum or expiry.
+func (server *Server) UpdatePantryItem(c echo.Context) error {
+	user, item, success, err := server.loadPantryItem(c)
+	if !success {
+		return err
+	}
+
+	if name, ok := getOptionalFormValue(c, "name"); ok && name != "" {
+		item.Name = name
+	}
+	success, err = getPantryFields(c, &item)
+	if !success {
+		return err
+	}
+
+	item, err = server.PantryService.Update(item)
+	if errors.Is(err, sqlite.ErrDuplicatePantryItem) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to update pantry item",
+		})
+	}
+	server.replenishOrLog(user, item)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully updated pantry item",
+		Data:    item,
+	})
+}
+
+// ConsumePantryItem takes the amount in the optional field 'amount', one by
+// default, from the stock of a pantry item. If that leaves less than its
+// minimum, the item is put on the list.
+func (server *Server) ConsumePantryItem(c echo.Context) error {
+	user, item, success, err := server.loadPantryItem(c)
+	if !success {
+		return err
+	}
+
+	amount := 1.0
+	if amountStr, ok := getOptionalFormValue(c, "amount"); ok {
+		amount, err = strconv.ParseFloat(strings.Replace(amountStr, ",", ".", 1), 64)
+		if err != nil || amount <= 0 || amount > 1e6 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'amount' must be a positive decimal number",
+			})
+		}
+	}
+
+	item, err = server.PantryService.Adjust(item.Id, -amount)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to update pantry item",
+		})
+	}
+	server.replenishOrLog(user, item)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully consumed %s", item.Name),
+		Data:    item,
+	})
+}
+
+func (server *Server) DeletePantryItem(c echo.Context) error {
+	_, item, success, err := server.loadPantryItem(c)
+	if !success {
+		return err
+	}
+
+	_, err = server.PantryService.Delete(item.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete pantry item",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully deleted pantry item",
+	})
+}
+
+// replenishOrLog puts an item below its minimum on its list. The change of
+// the pantry is kept if that fails, so the error is only logged.
+func (server *Server) replenishOrLog(user User, item PantryItem) {
+	err := server.replenish(user, item)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// loadPantryItem loads the pantry item in the path parameter 'id', which only
+// editors of its list may change.
+func (server *Server) loadPantryItem(c echo.Context) (user User, item PantryItem, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, item, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+		return user, item, false, err
+	}
+
+	item, err = server.PantryService.Get(id)
+	if err != nil {
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: pantry item %d does not exist", id),
+		})
+		return user, item, false, err
+	}
+	success, err = requireEditor(c, server, item.ListId, user.Id)
+	if !success {
+		return user, item, false, err
+	}
+	return user, item, true, nil
+}
+
+// getPantryFields parses the optional fields 'stock', 'unit', 'minimum' and
+// 'expires_on' of a pantry item that are sent into item.
+func getPantryFields(c echo.Context, item *PantryItem) (success bool, err error) {
+	badRequest := func(message string) (bool, error) {
+		return false, c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: message,
+		})
+	}
+	parseAmount := func(s string) (float64, bool) {
+		amount, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		return amount, err == nil && amount >= 0 && amount <= 1e6
+	}
+
+	if stockStr, ok := getOptionalFormValue(c, "stock"); ok {
+		if item.Stock, ok = parseAmount(stockStr); !ok {
+			return badRequest("error: field 'stock' must be a positive decimal number")
+		}
+	}
+	if unit, ok := getOptionalFormValue(c, "unit"); ok {
+		item.Unit = strings.TrimSpace(unit)
+		if len(item.Unit) > 20 {
+			return badRequest("error: field 'unit' must not be longer than 20 characters")
+		}
+	}
+	if minimumStr, ok := getOptionalFormValue(c, "minimum"); ok {
+		item.Minimum = nil
+		if minimumStr != "" {
+			minimum, ok := parseAmount(minimumStr)
+			if !ok {
+				return badRequest("error: field 'minimum' must be a positive decimal number")
+			}
+			item.Minimum = &minimum
+		}
+	}
+	if expiresOn, ok := getOptionalFormValue(c, "expires_on"); ok {
+		item.ExpiresOn = expiresOn
+		if _, err := time.Parse(time.DateOnly, expiresOn); expiresOn != "" && err != nil {
+			return badRequest("error: field 'expires_on' must be a date in the format YYYY-MM-DD")
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/push"
+)
+
+const (
+	// pushBatchDelay is how long entries added to a list are collected before
+	// they are pushed as one message.
+	pushBatchDelay  = 30 * time.Second
+	pushTTL         = 24 * time.Hour
+	maxPushAttempts = 5
+)
+
+// EnqueuePush queues push messages about entries added to a list, one by one
+// or in a batch, for its other members, and about invitations for the
+// invitee. Entries added to the same list within pushBatchDelay are pushed
+// together.
+func (server *Server) EnqueuePush(event Event) (err error) {
+	message := PushMessage{
+		Type:   event.Type,
+		ListId: event.ListId,
+		Actor:  event.User.Username,
+	}
+	var recipients []int
+	var batchKey string
+	at := event.CreatedAt
+
+	var items []string
+	switch data := event.Data.(type) {
+	case Entry:
+		if event.Type != EventEntryAdded {
+			return nil
+		}
+		items = []string{data.Text}
+	case EntryBatch:
+		if event.Type != EventEntriesAdded {
+			return nil
+		}
+		for _, id := range data.Ids {
+			entry, err := server.EntryService.Get(id)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			items = append(items, entry.Text)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+	case Invitation:
+		if event.Type != EventInvitationSent {
+			return nil
+		}
+		recipients = []int{data.Invitee.Id}
+		message.ListName = data.List.Name
+	default:
+		return nil
+	}
+	if items != nil {
+		list, err := server.ListService.Get(event.ListId)
+		if err != nil {
+			return err
+		}
+		members, err := server.ListService.Members(event.ListId)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			recipients = append(recipients, member.Id)
+		}
+		message.ListName = list.Name
+		message.Items = items
+		batchKey = fmt.Sprintf("entries:%d", event.ListId)
+		at = at.Add(pushBatchDelay)
+	}
+
+	recipients = slices.DeleteFunc(recipients, func(id int) bool {
+		return id == event.User.Id
+	})
+	if len(recipients) == 0 {
+		return nil
+	}
+	return server.PushService.Enqueue(recipients, message, batchKey, at)
+}
+
+// DeliverPush sends the queued push messages that are due. Messages that fail
+// temporarily are retried with exponential backoff, up to maxPushAttempts
+// times, and subscriptions the push service reports as gone are removed.
+func (server *Server) DeliverPush(now time.Time) (err error) {
+	deliveries, err := server.PushService.Due(now, 100)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		err = server.sendPush(delivery)
+		var statusErr *push.StatusError
+		switch {
+		case err == nil:
+			err = server.PushService.Delivered(delivery.Id)
+		case errors.Is(err, push.ErrGone):
+			_, err = server.PushService.Unsubscribe(delivery.Subscription.Id)
+		case errors.As(err, &statusErr) && !statusErr.Temporary(), delivery.Attempts+1 >= maxPushAttempts:
+			err = server.PushService.Delivered(delivery.Id)
+		default:
+			err = server.PushService.Retry(delivery.Id, now.Add(time.Minute<<delivery.Attempts))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (server *Server) sendPush(delivery PushDelivery) (err error) {
+	p256dh, err := base64.RawURLEncoding.DecodeString(delivery.Subscription.P256dh)
+	if err != nil {
+		return push.ErrGone
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(delivery.Subscription.Auth)
+	if err != nil {
+		return push.ErrGone
+	}
+
+	message := delivery.Message
+	message.Title, message.Body = pushText(message)
+	data, err := json.Marshal(message)
+	// long batches are cut short to fit into a push message
+	for err == nil && len(data) > push.MaxMessageSize && len(message.Items) > 1 {
+		message.Items = message.Items[:len(message.Items)/2]
+		data, err = json.Marshal(message)
+	}
+	if err != nil {
+		return err
+	}
+	return server.Push.Send(delivery.Subscription.Endpoint, p256dh, auth, data, pushTTL)
+}
+
+// pushText returns the title and body a push message is shown with.
+func pushText(message PushMessage) (title, body string) {
+	switch message.Type {
+	case EventInvitationSent:
+		return fmt.Sprintf("Invitation to %s", message.ListName),
+			fmt.Sprintf("%s invited you to %s", message.Actor, message.ListName)
+	case EventEntryAdded, EventEntriesAdded:
+		items := strings.Join(message.Items[:min(len(message.Items), 3)], ", ")
+		if len(message.Items) > 3 {
+			items += fmt.Sprintf(" and %d more", len(message.Items)-3)
+		}
+		if message.Actor == "" {
+			return message.ListName, "Added " + items
+		}
+		return message.ListName, fmt.Sprintf("%s added %s", message.Actor, items)
+	}
+	return message.ListName, ""
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// GetPushKey returns the VAPID public key, which browsers need to subscribe.
+func (server *Server) GetPushKey(c echo.Context) error {
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    server.Push.PublicKey(),
+	})
+}
+
+func (server *Server) GetPushSubscriptions(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	subscriptions, err := server.PushService.Subscriptions(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load push subscriptions",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    subscriptions,
+	})
+}
+
+// Subscribe registers a device for push messages with the fields 'endpoint',
+// 'p256dh' and 'auth' of its PushSubscription, and an optional 'device' name
+// to tell the user's devices apart.
+func (server *Server) Subscribe(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "endpoint", "p256dh", "auth")
+	if !success {
+		return err
+	}
+	endpoint, p256dh, auth := values[0], trimBase64(values[1]), trimBase64(values[2])
+	device := c.FormValue("device")
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && (server.PushMock == nil || u.Scheme != "http")) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'endpoint' must be an https URL",
+		})
+	}
+	err = server.Push.CheckEndpoint(c.Request().Context(), endpoint)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	key, err := base64.RawURLEncoding.DecodeString(p256dh)
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(key)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'p256dh' must be an uncompressed P-256 public key in base64",
+		})
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil || len(secret) != 16 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'auth' must be a 16 byte secret in base64",
+		})
+	}
+	if len(device) > 100 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'device' must not be longer than 100 characters",
+		})
+	}
+
+	subscription, err := server.PushService.Subscribe(PushSubscription{
+		UserId:   user.Id,
+		Endpoint: endpoint,
+		P256dh:   p256dh,
+		Auth:     auth,
+		Device:   device,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to save push subscription",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully subscribed to push messages",
+		Data:    subscription,
+	})
+}
+
+func (server *Server) Unsubscribe(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	subscription, err := server.PushService.Get(id)
+	if err != nil || subscription.UserId != user.Id {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: push subscription %d does not exist", id),
+		})
+	}
+	_, err = server.PushService.Unsubscribe(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete push subscription",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully unsubscribed from push messages",
+	})
+}
+
+// trimBase64 turns standard or padded base64 into the unpadded URL-safe
+// base64 browsers normally send.
+func trimBase64(s string) string {
+	s = strings.TrimRight(s, "=")
+	return strings.NewReplacer("+", "-", "/", "_").Replace(s)
+}
+
+// AddMockPushSubscription creates a subscription of the mock push service,
+// which can be registered with Subscribe. The optional field 'status' makes
+// the mock answer every message with that status.
+func (server *Server) AddMockPushSubscription(c echo.Context) error {
+	status := 0
+	if statusStr := c.FormValue("status"); statusStr != "" {
+		var err error
+		status, err = strconv.Atoi(statusStr)
+		if err != nil || status < 200 || status > 599 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'status' must be an HTTP status code",
+			})
+		}
+	}
+
+	token, p256dh, auth, err := server.PushMock.Subscribe(status)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create mock push subscription",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: map[string]string{
+			"endpoint": fmt.Sprintf("%s://%s/push/mock/%s", c.Scheme(), c.Request().Host, token),
+			"p256dh":   base64.RawURLEncoding.EncodeToString(p256dh),
+			"auth":     base64.RawURLEncoding.EncodeToString(auth),
+		},
+	})
+}
+
+// ReceiveMockPush is the endpoint of mock push subscriptions.
+func (server *Server) ReceiveMockPush(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 8192))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	origin := c.Scheme() + "://" + c.Request().Host
+	status := server.PushMock.Receive(c.Param("token"), origin, c.Request().Header.Get("Authorization"), body)
+	return c.NoContent(status)
+}
+
+// GetMockPushMessages returns the decrypted messages a mock push subscription
+// has received.
+func (server *Server) GetMockPushMessages(c echo.Context) error {
+	messages, ok := server.PushMock.Messages(c.Param("token"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "error: mock push subscription does not exist",
+		})
+	}
+	data := []json.RawMessage{}
+	for _, message := range messages {
+		data = append(data, message)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    data,
+	})
+}
@@ -0,0 +1,318 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/recipe"
+)
+
+const (
+	maxRecipeSize        = 4 << 20
+	maxRecipeIngredients = 200
+	maxServings          = 100
+)
+
+func (server *Server) GetRecipes(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	recipes, err := server.RecipeService.All(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load recipes",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    recipes,
+	})
+}
+
+func (server *Server) GetRecipe(c echo.Context) error {
+	_, recipe, success, err := server.loadRecipe(c)
+	if !success {
+		return err
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    recipe,
+	})
+}
+
+// AddRecipe imports the schema.org Recipe of the HTML page or JSON-LD document
+// uploaded in the field 'file'. Without a file the recipe is made of the
+// fields 'name', 'servings' and 'ingredients', one ingredient per line.
+func (server *Server) AddRecipe(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	var imported Recipe
+	if header, err := c.FormFile("file"); err == nil {
+		file, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: failed to read file",
+			})
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxRecipeSize+1))
+		if err != nil || len(data) > maxRecipeSize {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("error: field 'file' must not be larger than %d MB", maxRecipeSize>>20),
+			})
+		}
+		imported, err = recipe.Parse(data)
+		if errors.Is(err, recipe.ErrNoRecipe) {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: file does not contain a schema.org recipe",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: failed to parse recipe",
+			})
+		}
+	} else {
+		values, success, err := getFormValues(c, "name", "ingredients")
+		if !success {
+			return err
+		}
+		imported.Name = values[0]
+		imported.Ingredients = recipe.Ingredients(strings.Split(values[1], "\n"))
+		imported.Servings = 1
+		if servingsStr, ok := getOptionalFormValue(c, "servings"); ok {
+			imported.Servings, success, err = getServings(c, servingsStr)
+			if !success {
+				return err
+			}
+		}
+	}
+
+	// names of imported recipes may be longer than the ones entered by hand
+	if name := []rune(imported.Name); len(name) > 200 {
+		imported.Name = string(name[:200])
+	}
+	if len(imported.Ingredients) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: recipe does not contain any ingredients",
+		})
+	}
+	if len(imported.Ingredients) > maxRecipeIngredients {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: recipe must not contain more than %d ingredients", maxRecipeIngredients),
+		})
+	}
+
+	imported.UserId = user.Id
+	imported, err = server.RecipeService.Add(imported)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add recipe",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added recipe '%s'", imported.Name),
+		Data:    imported,
+	})
+}
+
+// UpdateRecipe changes the fields 'name' and 'servings' of a recipe that are
+// sent.
+func (server *Server) UpdateRecipe(c echo.Context) error {
+	_, recipe, success, err := server.loadRecipe(c)
+	if !success {
+		return err
+	}
+
+	if name, ok := getOptionalFormValue(c, "name"); ok && name != "" {
+		recipe.Name = name
+	}
+	if servingsStr, ok := getOptionalFormValue(c, "servings"); ok {
+		recipe.Servings, success, err = getServings(c, servingsStr)
+		if !success {
+			return err
+		}
+	}
+
+	_, err = server.RecipeService.Update(recipe.Id, recipe.Name, recipe.Servings)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to update recipe",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully updated recipe",
+		Data:    recipe,
+	})
+}
+
+// DeleteRecipe deletes a recipe and removes it from the meal plan.
+func (server *Server) DeleteRecipe(c echo.Context) error {
+	_, recipe, success, err := server.loadRecipe(c)
+	if !success {
+		return err
+	}
+
+	_, err = server.RecipeService.Delete(recipe.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete recipe",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully deleted recipe",
+	})
+}
+
+// AddRecipeToList adds the ingredients of a recipe to the list in the field
+// 'list_id', scaled to the servings in the optional field 'servings'.
+// Ingredients already on the list are merged into their entries.
+func (server *Server) AddRecipeToList(c echo.Context) error {
+	user, recipe, success, err := server.loadRecipe(c)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "list_id")
+	if !success {
+		return err
+	}
+	listId, err := strconv.Atoi(values[0])
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: field 'list_id' must be a valid integer",
+		})
+	}
+	servings := recipe.Servings
+	if servingsStr, ok := getOptionalFormValue(c, "servings"); ok {
+		servings, success, err = getServings(c, servingsStr)
+		if !success {
+			return err
+		}
+	}
+
+	return server.addIngredients(c, user, listId, recipe.Scaled(servings))
+}
+
+// addIngredients merges ingredients into a list, inferring the categories of
+// the ones that are added, and responds with the MergeResult.
+func (server *Server) addIngredients(c echo.Context, user User, listId int, ingredients []Ingredient) error {
+	success, err := requireEditor(c, server, listId, user.Id)
+	if !success {
+		return err
+	}
+
+	entries := []Entry{}
+	for _, ingredient := range ingredients {
+		category, err := server.CategoryService.Infer(listId, ingredient.Text)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to infer category",
+			})
+		}
+		entries = append(entries, Entry{
+			Text:     ingredient.Text,
+			Category: category,
+			Note:     ingredient.Note,
+			Quantity: ingredient.Quantity,
+		})
+	}
+
+	added, updated, reopened, err := server.EntryService.Merge(user.Id, listId, entries)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add ingredients",
+		})
+	}
+	for _, entry := range added {
+		server.publish(EventEntryAdded, entry.ListId, user, entry)
+	}
+	server.publishMerged(user, updated, reopened)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully added %d and updated %d entries", len(added), len(updated)),
+		Data:    MergeResult{Added: added, Updated: updated},
+	})
+}
+
+// publishMerged publishes the entries a merge changed: the ones it reopened as
+// uncompleted, and the others, whose quantity it only increased, as updated.
+func (server *Server) publishMerged(user User, updated []Entry, reopened []int) {
+	for _, entry := range updated {
+		if slices.Contains(reopened, entry.Id) {
+			server.publish(EventEntryCompleted, entry.ListId, user, entry)
+		} else {
+			server.publish(EventEntryUpdated, entry.ListId, user, entry)
+		}
+	}
+}
+
+// loadRecipe loads the recipe in the path parameter 'id', which only its user
+// may see.
+func (server *Server) loadRecipe(c echo.Context) (user User, recipe Recipe, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, recipe, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+		return user, recipe, false, err
+	}
+
+	recipe, err = server.RecipeService.Get(id)
+	if err != nil || recipe.UserId != user.Id {
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: recipe %d does not exist", id),
+		})
+		return user, recipe, false, err
+	}
+	return user, recipe, true, nil
+}
+
+// getServings parses the value of the field 'servings'.
+func getServings(c echo.Context, servingsStr string) (servings int, success bool, err error) {
+	servings, err = strconv.Atoi(servingsStr)
+	if err != nil || servings < 1 || servings > maxServings {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: field 'servings' must be an integer between 1 and %d", maxServings),
+		})
+		return 0, false, err
+	}
+	return servings, true, nil
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"log"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// AddDueStaples puts every staple that is due back onto its list. Staples that
+// are still on the list are uncompleted instead of being added twice. A staple
+// that fails is logged and retried with the next run, without holding up the
+// others.
+func (server *Server) AddDueStaples(now time.Time) (err error) {
+	staples, err := server.StapleService.Due(now)
+	if err != nil {
+		return err
+	}
+
+	for _, staple := range staples {
+		err = server.addStaple(staple, now)
+		if err != nil {
+			log.Printf("staple %d: %v", staple.Id, err)
+		}
+	}
+	return nil
+}
+
+// addStaple puts a due staple back onto its list and schedules its next
+// occurrence. Staples of users who may no longer edit the list are deleted
+// instead.
+func (server *Server) addStaple(staple Staple, now time.Time) (err error) {
+	role, err := server.ListService.Role(staple.ListId, staple.CreatedBy)
+	if err != nil {
+		return err
+	}
+	if role != RoleOwner && role != RoleEditor {
+		_, err = server.StapleService.Delete(staple.Id)
+		return err
+	}
+
+	user, err := server.UserService.Get(staple.CreatedBy)
+	if err != nil {
+		return err
+	}
+	entry, found, err := server.EntryService.Find(staple.ListId, staple.Text)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		entry, err = server.EntryService.Add(user.Id, staple.ListId, staple.Text, staple.Category, "", nil, nil)
+		if err != nil {
+			return err
+		}
+		server.publish(EventEntryAdded, entry.ListId, user, entry)
+	} else if entry.Completed {
+		_, err = server.EntryService.Reopen(user.Id, entry.Id)
+		if err != nil {
+			return err
+		}
+		entry.Completed = false
+		server.publish(EventEntryCompleted, entry.ListId, user, entry)
+	}
+
+	// occurrences missed while the server was down are skipped
+	nextAt := staple.Recurrence.Next(staple.NextAt.Local())
+	for !nextAt.After(now) {
+		nextAt = staple.Recurrence.Next(nextAt)
+	}
+	return server.StapleService.Reschedule(staple.Id, nextAt)
+}
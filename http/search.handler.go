@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) Search(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: query parameter 'q' must be provided",
+		})
+	}
+	limit := 20
+	limitStr := c.QueryParam("limit")
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'limit' must be an integer between 1 and 100",
+			})
+		}
+	}
+	offset := 0
+	offsetStr := c.QueryParam("offset")
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'offset' must be a non-negative integer",
+			})
+		}
+	}
+
+	page, err := server.SearchService.Search(user.Id, query, offset, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to search",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    page,
+	})
+}
@@ -1,11 +1,71 @@
 package http
 
-import "github.com/slh335/shoppinglistserver/sqlite"
+import (
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/blob"
+	"github.com/slh335/shoppinglistserver/events"
+	"github.com/slh335/shoppinglistserver/mail"
+	"github.com/slh335/shoppinglistserver/push"
+	"github.com/slh335/shoppinglistserver/sqlite"
+	"github.com/slh335/shoppinglistserver/webhook"
+)
 
 type Server struct {
-	AuthService       *sqlite.AuthService
-	UserService       *sqlite.UserService
-	ListService       *sqlite.ListService
-	EntryService      *sqlite.EntryService
-	InvitationService *sqlite.InvitationService
+	AuthService         *sqlite.AuthService
+	UserService         *sqlite.UserService
+	ListService         *sqlite.ListService
+	EntryService        *sqlite.EntryService
+	InvitationService   *sqlite.InvitationService
+	TrashService        *sqlite.TrashService
+	ActivityService     *sqlite.ActivityService
+	AttachmentService   *sqlite.AttachmentService
+	StapleService       *sqlite.StapleService
+	SuggestionService   *sqlite.SuggestionService
+	CategoryService     *sqlite.CategoryService
+	SearchService       *sqlite.SearchService
+	TemplateService     *sqlite.TemplateService
+	LinkService         *sqlite.LinkService
+	JoinRequestService  *sqlite.JoinRequestService
+	NotificationService *sqlite.NotificationService
+	PushService         *sqlite.PushService
+	EmailService        *sqlite.EmailService
+	WebhookService      *sqlite.WebhookService
+	IngestService       *sqlite.IngestService
+	RecipeService       *sqlite.RecipeService
+	PantryService       *sqlite.PantryService
+	Events              *events.Broker
+	Blobs               blob.Store
+	Push                *push.Sender
+	PushMock            *push.Mock
+	Mailer              mail.Mailer
+	MailFake            *mail.FakeServer
+	Webhooks            *webhook.Sender
+	// BaseURL is the URL the server is reached at, which links in mails and
+	// invitation links point to.
+	BaseURL string
+	// IngestSecret authenticates the integrations that send inbound messages.
+	IngestSecret string
+}
+
+func (server *Server) publish(eventType string, listId int, user User, data any) {
+	server.Events.Publish(Event{
+		Type:   eventType,
+		ListId: listId,
+		User: User{
+			Id:       user.Id,
+			Username: user.Username,
+		},
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (server *Server) undo(token string, listId int) *Undo {
+	return &Undo{
+		Token:     token,
+		ListId:    listId,
+		ExpiresAt: time.Now().Add(server.TrashService.Retention),
+	}
 }
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetStaples(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	staples, err := server.StapleService.All(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load staples",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    staples,
+	})
+}
+
+func (server *Server) GetUpcomingStaples(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	days := 14
+	daysStr := c.QueryParam("days")
+	if daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 366 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'days' must be an integer between 1 and 366",
+			})
+		}
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	staples, err := server.StapleService.All(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load staples",
+		})
+	}
+
+	until := time.Now().AddDate(0, 0, days)
+	upcoming := []Upcoming{}
+	for _, staple := range staples {
+		for at := staple.NextAt.Local(); !at.After(until); at = staple.Recurrence.Next(at) {
+			upcoming = append(upcoming, Upcoming{Staple: staple, At: at})
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].At.Before(upcoming[j].At)
+	})
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    upcoming,
+	})
+}
+
+func (server *Server) AddStaple(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "text", "category")
+	if !success {
+		return err
+	}
+	text, category := values[0], values[1]
+	recurrence, success, err := getRecurrence(c)
+	if !success {
+		return err
+	}
+
+	success, err = requireEditor(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	staple, err := server.StapleService.Add(user.Id, id, text, category, recurrence)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create staple",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    staple,
+	})
+}
+
+func (server *Server) UpdateStaple(c echo.Context) error {
+	_, staple, success, err := server.loadStaple(c)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "text", "category")
+	if !success {
+		return err
+	}
+	text, category := values[0], values[1]
+	recurrence, success, err := getRecurrence(c)
+	if !success {
+		return err
+	}
+
+	updated, err := server.StapleService.Update(staple.Id, text, category, recurrence)
+	if err != nil || !updated {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to update staple",
+		})
+	}
+	staple, err = server.StapleService.Get(staple.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load staple",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully updated staple %d", staple.Id),
+		Data:    staple,
+	})
+}
+
+func (server *Server) DeleteStaple(c echo.Context) error {
+	_, staple, success, err := server.loadStaple(c)
+	if !success {
+		return err
+	}
+
+	deleted, err := server.StapleService.Delete(staple.Id)
+	if err != nil || !deleted {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete staple",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully deleted staple %d", staple.Id),
+	})
+}
+
+func (server *Server) loadStaple(c echo.Context) (user User, staple Staple, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, staple, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+		return user, staple, false, err
+	}
+
+	staple, err = server.StapleService.Get(id)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: staple %d does not exist", id),
+		})
+		return user, staple, false, err
+	}
+	success, err = requireEditor(c, server, staple.ListId, user.Id)
+	return user, staple, success, err
+}
+
+// getRecurrence parses either the field 'every_days' or the field 'weekday',
+// which takes an English day name or a number from 0 (Sunday) to 6.
+func getRecurrence(c echo.Context) (recurrence Recurrence, success bool, err error) {
+	everyDaysStr, weekdayStr := c.FormValue("every_days"), strings.ToLower(c.FormValue("weekday"))
+	if (everyDaysStr == "") == (weekdayStr == "") {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: exactly one of the fields 'every_days' and 'weekday' must be provided",
+		})
+		return recurrence, false, err
+	}
+
+	if everyDaysStr != "" {
+		everyDays, err := strconv.Atoi(everyDaysStr)
+		if err != nil || everyDays < 1 || everyDays > 365 {
+			err = c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: field 'every_days' must be an integer between 1 and 365",
+			})
+			return recurrence, false, err
+		}
+		return Recurrence{Days: everyDays}, true, nil
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if weekdayStr == strings.ToLower(day.String()) || weekdayStr == strconv.Itoa(int(day)) {
+			return Recurrence{Weekday: &day}, true, nil
+		}
+	}
+	err = c.JSON(http.StatusBadRequest, Response{
+		Success: false,
+		Message: "error: field 'weekday' must be a day of the week",
+	})
+	return recurrence, false, err
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetSuggestions(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	prefix := c.QueryParam("q")
+	if prefix == "" {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: query parameter 'q' must be provided",
+		})
+	}
+	limit := 10
+	limitStr := c.QueryParam("limit")
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 50 {
+			return c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Message: "error: query parameter 'limit' must be an integer between 1 and 50",
+			})
+		}
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	suggestions, err := server.SuggestionService.Suggest(user.Id, id, prefix, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load suggestions",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    suggestions,
+	})
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetTemplates(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	templates, err := server.TemplateService.All(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load templates",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    templates,
+	})
+}
+
+func (server *Server) GetTemplate(c echo.Context) error {
+	_, template, success, err := server.loadTemplate(c)
+	if !success {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    template,
+	})
+}
+
+// SaveTemplate saves a list as a template of the user, named after the field
+// 'name' or the list.
+func (server *Server) SaveTemplate(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+	list, err := server.ListService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list",
+		})
+	}
+	name, success, err := getListName(c, list.Name)
+	if !success {
+		return err
+	}
+
+	template, err := server.TemplateService.Add(user.Id, id, name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to save template",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully saved list %d as template", id),
+		Data:    template,
+	})
+}
+
+// InstantiateTemplate creates a new list owned by the user from a template,
+// named after the field 'name' or the template.
+func (server *Server) InstantiateTemplate(c echo.Context) error {
+	user, template, success, err := server.loadTemplate(c)
+	if !success {
+		return err
+	}
+	name, success, err := getListName(c, template.Name)
+	if !success {
+		return err
+	}
+
+	listId, err := server.TemplateService.Instantiate(user.Id, template.Id, name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create list from template",
+		})
+	}
+	list, err := server.ListService.Get(listId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load list",
+		})
+	}
+	list.Entries, err = server.EntryService.All(listId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entries",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully created list from template %d", template.Id),
+		Data:    list,
+	})
+}
+
+func (server *Server) DeleteTemplate(c echo.Context) error {
+	_, template, success, err := server.loadTemplate(c)
+	if !success {
+		return err
+	}
+
+	deleted, err := server.TemplateService.Delete(template.Id)
+	if err != nil || !deleted {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete template",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully deleted template %d", template.Id),
+	})
+}
+
+// loadTemplate loads the template in the path and checks that the user saved
+// it.
+func (server *Server) loadTemplate(c echo.Context) (user User, template Template, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, template, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+		return user, template, false, err
+	}
+
+	template, err = server.TemplateService.Get(id)
+	if err != nil || template.CreatorId != user.Id {
+		// other users' templates are reported as missing, as they are private
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: template %d does not exist", id),
+		})
+		return user, template, false, err
+	}
+	return user, template, true, nil
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetTrash(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireMember(c, server, id, user.Id)
+	if !success {
+		return err
+	}
+
+	entries, err := server.TrashService.Entries(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load trash",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    entries,
+	})
+}
+
+func (server *Server) GetDeletedLists(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	lists, err := server.TrashService.Lists(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load deleted lists",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    lists,
+	})
+}
+
+func (server *Server) RestoreEntry(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' must be a valid integer", idStr),
+		})
+	}
+
+	entry, err := server.TrashService.GetEntry(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: entry %d is not in the trash", id),
+		})
+	}
+	success, err = requireEditor(c, server, entry.ListId, user.Id)
+	if !success {
+		return err
+	}
+
+	restored, err := server.TrashService.RestoreEntry(user.Id, id)
+	if err != nil || !restored {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to restore entry",
+		})
+	}
+	entry, err = server.EntryService.Get(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load entry",
+		})
+	}
+	server.publish(EventEntryRestored, entry.ListId, user, entry)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("successfully restored entry %d", id),
+		Data:    entry,
+	})
+}
+
+func (server *Server) RestoreList(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	list, err := server.TrashService.GetList(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: list %d is not in the trash", id),
+		})
+	}
+	if list.Creator.Id != user.Id {
+		return c.JSON(http.StatusForbidden, Response{
+			Success: false,
+			Message: "error: user is not authorized to restore that list",
+		})
+	}
+
+	restored, err := server.TrashService.RestoreList(id)
+	if err != nil || !restored {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to restore list",
+		})
+	}
+	server.publish(EventListRestored, id, user, list)
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully restored list",
+		Data:    list,
+	})
+}
+
+func (server *Server) Undo(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	values, success, err := getFormValues(c, "undo_token")
+	if !success {
+		return err
+	}
+	token := values[0]
+
+	undo, isList, err := server.TrashService.GetUndo(token)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "error: nothing to undo for that token",
+		})
+	}
+	if isList {
+		list, err := server.TrashService.GetList(undo.ListId)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "error: failed to load list",
+			})
+		}
+		if list.Creator.Id != user.Id {
+			return c.JSON(http.StatusForbidden, Response{
+				Success: false,
+				Message: "error: user is not authorized to restore that list",
+			})
+		}
+	} else {
+		success, err = requireEditor(c, server, undo.ListId, user.Id)
+		if !success {
+			return err
+		}
+	}
+
+	err = server.TrashService.Undo(user.Id, token)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to undo deletion",
+		})
+	}
+	if isList {
+		server.publish(EventListRestored, undo.ListId, user, undo)
+	} else {
+		server.publish(EventEntriesRestored, undo.ListId, user, undo)
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully undid deletion",
+		Data:    undo,
+	})
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// maxWebhookAttempts is how often a delivery is tried before it fails. With
+// the backoff doubling from a minute, the last attempt is about two hours
+// after the first.
+const maxWebhookAttempts = 8
+
+// EnqueueWebhooks queues entry and membership events for the webhooks of
+// their list. The payload is the event as JSON.
+func (server *Server) EnqueueWebhooks(event Event) (err error) {
+	if !slices.Contains(WebhookEvents, event.Type) {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return server.WebhookService.Enqueue(event.ListId, event.Type, payload, event.CreatedAt)
+}
+
+// DeliverWebhooks sends the queued deliveries that are due. Deliveries that
+// fail are retried with exponential backoff, up to maxWebhookAttempts times.
+func (server *Server) DeliverWebhooks(now time.Time) (err error) {
+	deliveries, err := server.WebhookService.Due(now, 100)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		err = server.deliverWebhook(delivery, now, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhook sends a delivery and logs the attempt. Unless retry is set, a
+// failed attempt fails the delivery for good.
+func (server *Server) deliverWebhook(delivery WebhookDelivery, now time.Time, retry bool) (err error) {
+	url, secret, err := server.WebhookService.Target(delivery.WebhookId)
+	if err != nil {
+		return err
+	}
+
+	status := DeliveryDelivered
+	errMessage := ""
+	responseStatus, err := server.Webhooks.Send(url, secret, delivery.Id, delivery.Event, delivery.Payload)
+	if err != nil {
+		errMessage = err.Error()
+		status = DeliveryFailed
+		if retry && delivery.Attempts+1 < maxWebhookAttempts {
+			status = DeliveryPending
+		}
+	}
+	next := now.Add(time.Minute << delivery.Attempts)
+	return server.WebhookService.Attempted(delivery.Id, status, responseStatus, errMessage, now, next)
+}
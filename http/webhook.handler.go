@@ -0,0 +1,315 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func (server *Server) GetWebhooks(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	success, err = requireRole(c, server, id, user.Id, RoleOwner)
+	if !success {
+		return err
+	}
+
+	webhooks, err := server.WebhookService.All(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load webhooks",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    webhooks,
+	})
+}
+
+// AddWebhook adds a webhook for the URL in the field 'url' to a list. The
+// optional field 'events' is a comma separated list of the WebhookEvents it
+// receives, all of them by default, and 'secret' the secret payloads are
+// signed with, which is generated if it is left out. The response is the only
+// time the secret is shown.
+func (server *Server) AddWebhook(c echo.Context) error {
+	user, success, err := verifySession(c, server)
+	if !success {
+		return err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+	}
+
+	values, success, err := getFormValues(c, "url")
+	if !success {
+		return err
+	}
+	webhook := Webhook{
+		ListId:    id,
+		URL:       values[0],
+		Secret:    c.FormValue("secret"),
+		Events:    splitEvents(c.FormValue("events")),
+		CreatedBy: user.Id,
+	}
+	success, err = requireRole(c, server, id, user.Id, RoleOwner)
+	if !success {
+		return err
+	}
+
+	success, err = server.checkWebhook(c, &webhook)
+	if !success {
+		return err
+	}
+
+	webhook, err = server.WebhookService.Add(webhook)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to add webhook",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully added webhook",
+		Data:    webhook,
+	})
+}
+
+// UpdateWebhook changes the fields 'url', 'events' and 'secret' of a webhook
+// that are sent. An empty 'events' subscribes it to all events.
+func (server *Server) UpdateWebhook(c echo.Context) error {
+	_, webhook, success, err := server.loadWebhook(c)
+	if !success {
+		return err
+	}
+
+	if urlStr, ok := getOptionalFormValue(c, "url"); ok {
+		webhook.URL = urlStr
+	}
+	webhook.Secret = c.FormValue("secret")
+	if events, ok := getOptionalFormValue(c, "events"); ok {
+		webhook.Events = splitEvents(events)
+	}
+	success, err = server.checkWebhook(c, &webhook)
+	if !success {
+		return err
+	}
+
+	_, err = server.WebhookService.Update(webhook)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to update webhook",
+		})
+	}
+	webhook, err = server.WebhookService.Get(webhook.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to load webhook",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully updated webhook",
+		Data:    webhook,
+	})
+}
+
+func (server *Server) DeleteWebhook(c echo.Context) error {
+	_, webhook, success, err := server.loadWebhook(c)
+	if !success {
+		return err
+	}
+
+	_, err = server.WebhookService.Delete(webhook.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to delete webhook",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "successfully deleted webhook",
+	})
+}
+
+// TestWebhook sends a webhook.test event to a webhook right away and responds
+// with the logged delivery. Test deliveries are not retried.
+func (server *Server) TestWebhook(c echo.Context) error {
+	user, webhook, success, err := server.loadWebhook(c)
+	if !success {
+		return err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(Event{
+		Type:      EventWebhookTest,
+		ListId:    webhook.ListId,
+		User:      User{Id: user.Id, Username: user.Username},
+		CreatedAt: now,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to create test event",
+		})
+	}
+	// the delivery is scheduled late enough that the delivery worker leaves it
+	// to this request
+	delivery, err := server.WebhookService.AddDelivery(webhook.Id, EventWebhookTest, payload, now.Add(time.Hour))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to queue test event",
+		})
+	}
+	err = server.deliverWebhook(delivery, now, false)
+	if err == nil {
+		delivery, err = server.WebhookService.Delivery(delivery.Id)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: "error: failed to log test delivery",
+		})
+	}
+
+	message := "successfully delivered test event"
+	if delivery.Status != DeliveryDelivered {
+		message = "failed to deliver test event"
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    delivery,
+	})
+}
+
+// GetWebhookDeliveries returns a page of the delivery log of a webhook,
+// newest first. The query parameter 'status' narrows it down to one of the
+// DeliveryStatuses.
+func (server *Server) GetWebhookDeliveries(c echo.Context) error {
+	_, webhook, success, err := server.loadWebhook(c)
+	if !success {
+		return err
+	}
+
+	filter, success, err := getFilter(c, SortCreated)
+	if !success {
+		return err
+	}
+	filter.Status = c.QueryParam("status")
+	if filter.Status != "" && !slices.Contains(DeliveryStatuses, filter.Status) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: query parameter 'status' must be one of '%s'", strings.Join(DeliveryStatuses, "', '")),
+		})
+	}
+
+	deliveries, next, err := server.WebhookService.Deliveries(webhook.Id, filter)
+	if err != nil {
+		return queryError(c, err, "error: failed to load webhook deliveries")
+	}
+	return pageResponse(c, deliveries, next)
+}
+
+// loadWebhook loads the webhook in the path parameter 'id', which only owners
+// of its list may see.
+func (server *Server) loadWebhook(c echo.Context) (user User, webhook Webhook, success bool, err error) {
+	user, success, err = verifySession(c, server)
+	if !success {
+		return user, webhook, false, err
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		err = c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: path parameter '%s' is not a valid integer", idStr),
+		})
+		return user, webhook, false, err
+	}
+
+	webhook, err = server.WebhookService.Get(id)
+	if err == nil {
+		var role string
+		role, err = server.ListService.Role(webhook.ListId, user.Id)
+		if err == nil && role != RoleOwner {
+			err = fmt.Errorf("error: user is not an owner of the list")
+		}
+	}
+	if err != nil {
+		err = c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("error: webhook %d does not exist", id),
+		})
+		return user, webhook, false, err
+	}
+	return user, webhook, true, nil
+}
+
+// checkWebhook checks the URL, secret and events of a webhook. Its URL must
+// not point into the network of the server.
+func (server *Server) checkWebhook(c echo.Context, webhook *Webhook) (success bool, err error) {
+	badRequest := func(message string) (bool, error) {
+		return false, c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: message,
+		})
+	}
+
+	err = server.Webhooks.CheckURL(c.Request().Context(), webhook.URL)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+	if webhook.Secret != "" && len(webhook.Secret) < 16 {
+		return badRequest("error: field 'secret' must be at least 16 characters long")
+	}
+	for _, event := range webhook.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return badRequest(fmt.Sprintf("error: field 'events' must be a comma separated list of '%s'", strings.Join(WebhookEvents, "', '")))
+		}
+	}
+	return true, nil
+}
+
+// splitEvents splits a comma separated list of event types. An empty list
+// stands for all events.
+func splitEvents(s string) (events []string) {
+	if s == "" {
+		return nil
+	}
+	for _, event := range strings.Split(s, ",") {
+		events = append(events, strings.TrimSpace(event))
+	}
+	return events
+}
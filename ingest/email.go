@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+)
+
+// ErrNoText is returned for mails without a plain text or HTML body.
+var ErrNoText = errors.New("error: mail has no text")
+
+// Email is the part of a mail items are taken from.
+type Email struct {
+	From    string
+	Subject string
+	Text    string
+}
+
+// ParseEmail reads a mail in the format of RFC 5322. Its text is the plain
+// text body, or the HTML body stripped of markup, without quoted replies and
+// the signature.
+func ParseEmail(r io.Reader) (email Email, err error) {
+	message, err := netmail.ReadMessage(r)
+	if err != nil {
+		return email, err
+	}
+	from, err := message.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return email, errors.New("error: mail has no sender")
+	}
+	email.From = strings.ToLower(from[0].Address)
+	email.Subject, err = new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		email.Subject = message.Header.Get("Subject")
+	}
+
+	text, err := body(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), message.Body)
+	if err != nil {
+		return email, err
+	}
+	email.Text = stripReply(text)
+	return email, nil
+}
+
+// body returns the text of a part with the given content type, preferring the
+// plain text alternative of multipart parts.
+func body(contentType, encoding string, r io.Reader) (text string, err error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var html string
+		parts := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := body(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if errors.Is(err, ErrNoText) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+				html = text
+				continue
+			}
+			return text, nil
+		}
+		if html != "" {
+			return html, nil
+		}
+		return "", ErrNoText
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", ErrNoText
+	}
+
+	switch strings.ToLower(encoding) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, &lineJoiner{r: r})
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	text = strings.ReplaceAll(string(data), "\r\n", "\n")
+	if mediaType == "text/html" {
+		text = stripTags(text)
+	}
+	return text, nil
+}
+
+// lineJoiner drops the line breaks base64 bodies are wrapped with.
+type lineJoiner struct {
+	r io.Reader
+}
+
+func (l *lineJoiner) Read(p []byte) (n int, err error) {
+	n, err = l.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+var (
+	blockTag = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h\d)\b[^>]*>`)
+	anyTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+	// hidden matches elements whose content is not shown.
+	hidden = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+)
+
+func stripTags(s string) string {
+	s = hidden.ReplaceAllString(s, "")
+	s = blockTag.ReplaceAllString(s, "\n")
+	s = anyTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+var (
+	// quoteHeader matches the line mail clients put above a quoted reply, like
+	// "On Mon, 1 Jan 2024, Alice <alice@example.com> wrote:".
+	quoteHeader = regexp.MustCompile(`^On .+ wrote:$`)
+	// forwardHeader matches the line above a forwarded mail, which is followed
+	// by its headers.
+	forwardHeader = regexp.MustCompile(`^-+ ?(Forwarded message|Original Message) ?-+$`)
+	headerLine    = regexp.MustCompile(`^[A-Z][A-Za-z-]*: `)
+)
+
+// stripReply removes quoted replies, the headers of forwarded mails and the
+// signature from the text of a mail.
+func stripReply(text string) string {
+	var lines []string
+	inHeaders := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case line == "-- " || trimmed == "--" || quoteHeader.MatchString(trimmed):
+			return strings.Join(lines, "\n")
+		case forwardHeader.MatchString(trimmed):
+			inHeaders = true
+			continue
+		case inHeaders && headerLine.MatchString(trimmed):
+			continue
+		case strings.HasPrefix(trimmed, ">"):
+			continue
+		}
+		inHeaders = false
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
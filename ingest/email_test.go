@@ -0,0 +1,159 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		mail    string
+		want    Email
+		wantErr error
+	}{
+		{
+			name: "plain text",
+			mail: "From: Alice <Alice@Example.com>\r\n" +
+				"Subject: shopping\r\n" +
+				"\r\n" +
+				"milk\r\neggs\r\n",
+			want: Email{From: "alice@example.com", Subject: "shopping", Text: "milk\neggs\n"},
+		},
+		{
+			name: "encoded subject and latin-1 sender name",
+			mail: "From: =?ISO-8859-1?Q?J=F6rg?= <joerg@example.com>\r\n" +
+				"Subject: =?UTF-8?B?RWlua2F1ZiDwn5uS?=\r\n" +
+				"\r\n" +
+				"Äpfel\r\n",
+			want: Email{From: "joerg@example.com", Subject: "Einkauf 🛒", Text: "Äpfel\n"},
+		},
+		{
+			name: "multipart alternative prefers the plain text",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: multipart/alternative; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>from html</p>\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"\r\n" +
+				"from text\r\n" +
+				"--b--\r\n",
+			want: Email{From: "alice@example.com", Text: "from text"},
+		},
+		{
+			name: "html only is stripped of markup",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<html><head><style>p { color: red; }</style></head>" +
+				"<body><p>milk &amp; honey</p><div>eggs<br>bread</div></body></html>",
+			want: Email{From: "alice@example.com", Text: "milk & honey\neggs\nbread\n"},
+		},
+		{
+			name: "nested multipart with attachment",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: multipart/mixed; boundary=outer\r\n" +
+				"\r\n" +
+				"--outer\r\n" +
+				"Content-Type: image/png\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"iVBORw0KGgo=\r\n" +
+				"--outer\r\n" +
+				"Content-Type: multipart/alternative; boundary=inner\r\n" +
+				"\r\n" +
+				"--inner\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"butter\r\n" +
+				"--inner--\r\n" +
+				"--outer--\r\n",
+			want: Email{From: "alice@example.com", Text: "butter"},
+		},
+		{
+			name: "base64 wrapped over lines",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"bWlsawpl\r\n" +
+				"Z2dzCg==\r\n",
+			want: Email{From: "alice@example.com", Text: "milk\neggs\n"},
+		},
+		{
+			name: "quoted-printable",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"K=C3=A4se and a very long line that is soft =\r\n" +
+				"wrapped\r\n",
+			want: Email{From: "alice@example.com", Text: "Käse and a very long line that is soft wrapped\n"},
+		},
+		{
+			name: "quoted reply and signature are removed",
+			mail: "From: alice@example.com\r\n" +
+				"\r\n" +
+				"milk\r\n" +
+				"\r\n" +
+				"On Mon, 1 Jan 2024, Bob <bob@example.com> wrote:\r\n" +
+				"> eggs\r\n",
+			want: Email{From: "alice@example.com", Text: "milk\n"},
+		},
+		{
+			name: "signature",
+			mail: "From: alice@example.com\r\n" +
+				"\r\n" +
+				"milk\r\n" +
+				"-- \r\n" +
+				"Alice\r\n",
+			want: Email{From: "alice@example.com", Text: "milk"},
+		},
+		{
+			name: "forwarded headers and quoted lines",
+			mail: "From: alice@example.com\r\n" +
+				"\r\n" +
+				"---------- Forwarded message ---------\r\n" +
+				"From: Bob <bob@example.com>\r\n" +
+				"Subject: list\r\n" +
+				"bread\r\n" +
+				"> not this\r\n",
+			want: Email{From: "alice@example.com", Text: "bread\n"},
+		},
+		{
+			name:    "no sender",
+			mail:    "Subject: shopping\r\n\r\nmilk\r\n",
+			wantErr: errors.New("error: mail has no sender"),
+		},
+		{
+			name: "no text",
+			mail: "From: alice@example.com\r\n" +
+				"Content-Type: image/png\r\n" +
+				"\r\n" +
+				"png",
+			wantErr: ErrNoText,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseEmail(strings.NewReader(test.mail))
+			if test.wantErr != nil {
+				if err == nil || err.Error() != test.wantErr.Error() {
+					t.Fatalf("err = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("ParseEmail() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
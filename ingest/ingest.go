@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// Item is an entry asked for in a message or pasted text.
+type Item struct {
+	Text     string    `json:"text"`
+	Note     string    `json:"note,omitempty"`
+	Quantity *Quantity `json:"quantity,omitempty"`
+}
+
+var (
+	// command matches requests like "add", "please buy" or "we need:" at the
+	// start of a line.
+	command = regexp.MustCompile(`(?i)^(please\s+)?(add|buy|get|grab|pick up|we need|need)\b:?\s*`)
+	// target matches "to the list" or "to our shopping list" at the end of a
+	// line.
+	target = regexp.MustCompile(`(?i)\s+(to|on)\s+(the\s+|my\s+|our\s+)?(\w+\s+)?list$`)
+	// bullet matches list markers, numbering and checkboxes like "- [ ]",
+	// "☐" or "✅" at the start of a line.
+	bullet = regexp.MustCompile(`^([-*+•·▪◦–]\s+|\d+[.)]\s+|\[[ xX✓✔]?\]\s*|[☐☑☒✅✔✓⬜]\x{FE0F}?\s*)`)
+	// chatPrefix matches the date, time and sender exported chats put before
+	// every message, like "[19.10.26, 17:30:12] Alice: " or
+	// "10/19/26, 5:30 PM - Alice: ".
+	chatPrefix = regexp.MustCompile(`^\[?\d{1,4}[./-]\d{1,2}[./-]\d{2,4},?\s+\d{1,2}:\d{2}(:\d{2})?(\s?[AaPp][Mm])?\]?\s+(-\s+)?[^:]{1,50}:\s+`)
+	// note matches remarks in parentheses, like "(optional)".
+	note = regexp.MustCompile(`\s*\(([^()]*)\)`)
+)
+
+// Parse parses a message or pasted text into the items it asks for: one per
+// line, or several separated by commas or semicolons. The last two items of
+// such a line may also be separated by "and", as in "add milk, eggs and
+// bread". A line of an item starting with a quantity and one more part after a
+// comma, like "2 onions, finely chopped" in the ingredients of a recipe, is an
+// item with a note. Bullets, numbering, checkboxes, the prefixes of exported
+// chats, headings like "Ingredients:" and the request around the items are
+// removed.
+func Parse(text string) (items []Item) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		line = chatPrefix.ReplaceAllString(line, "")
+		for {
+			stripped := bullet.ReplaceAllString(line, "")
+			if stripped == line {
+				break
+			}
+			line = stripped
+		}
+		if strings.HasSuffix(line, ":") {
+			continue
+		}
+		line = command.ReplaceAllString(line, "")
+		line = strings.TrimRight(line, ".!")
+		line = target.ReplaceAllString(line, "")
+
+		parts := split(line)
+		if len(parts) == 2 && !strings.Contains(line, ";") && isIngredient(parts[0]) && !isIngredient(parts[1]) {
+			if item, ok := parseItem(parts[0]); ok {
+				item.Note = joinNotes(item.Note, strings.TrimSpace(parts[1]))
+				items = append(items, item)
+			}
+			continue
+		}
+		if len(parts) > 1 {
+			last := parts[len(parts)-1]
+			if before, after, ok := strings.Cut(strings.TrimSpace(last), " and "); ok {
+				parts = append(parts[:len(parts)-1], before, after)
+			} else if after, ok := strings.CutPrefix(strings.TrimSpace(last), "and "); ok {
+				parts[len(parts)-1] = after
+			}
+		}
+
+		for _, part := range parts {
+			if item, ok := parseItem(part); ok {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// split splits a line at commas and semicolons, except for decimal commas like
+// in "1,5 kg".
+func split(line string) (parts []string) {
+	start := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] == ',' && i > 0 && i+1 < len(line) && isDigit(line[i-1]) && isDigit(line[i+1]) {
+			continue
+		}
+		if line[i] == ',' || line[i] == ';' {
+			parts = append(parts, line[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, line[start:])
+	return slices.DeleteFunc(parts, func(part string) bool {
+		return strings.TrimSpace(part) == ""
+	})
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+// parseItem parses the quantity and notes in parentheses of a single item.
+func parseItem(s string) (item Item, ok bool) {
+	s = note.ReplaceAllStringFunc(s, func(match string) string {
+		remark := strings.TrimSpace(note.FindStringSubmatch(match)[1])
+		if quantity, ok := onlyQuantity(remark); ok && item.Quantity == nil {
+			item.Quantity = quantity
+		} else {
+			item.Note = joinNotes(item.Note, remark)
+		}
+		return ""
+	})
+	s = strings.TrimSpace(s)
+
+	if quantity, rest, ok := leadingQuantity(s); ok && rest != "" {
+		item.Quantity, s = quantity, rest
+	} else if quantity, rest, ok := trailingQuantity(s); ok {
+		item.Quantity, s = quantity, rest
+	}
+	item.Text = strings.TrimSpace(s)
+	return item, item.Text != ""
+}
+
+// isIngredient reports whether s starts with a quantity, like the lines of the
+// ingredients of a recipe.
+func isIngredient(s string) bool {
+	_, rest, ok := leadingQuantity(s)
+	return ok && rest != ""
+}
+
+func joinNotes(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ", " + b
+}
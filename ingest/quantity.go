@@ -0,0 +1,181 @@
+package ingest
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// number matches amounts like "2", "1.5", "1,5", "1/2", "1 1/2", "½" or
+// "1½".
+const number = `(\d+\s+\d+/\d+|\d+/\d+|\d*[½⅓⅔¼¾⅛]|\d+(?:[.,]\d+)?)`
+
+var (
+	// leading matches an amount at the start of an item. Of ranges like "2-3"
+	// the upper bound is used, so enough is bought.
+	leading = regexp.MustCompile(`^(?:` + number + `\s*(?:-|–|to)\s*)?` + number)
+	// times matches the "x" of "2x milk" or "2 x milk".
+	times = regexp.MustCompile(`^\s*[x×](\s+|$)`)
+	// word matches the unit following an amount, like "g" in "200g" or "cups"
+	// in "2 cups of".
+	word = regexp.MustCompile(`^\s*(\pL+)\.?(\s+of\b)?(\s+|$)`)
+	// trailing matches an amount at the end of an item, like "milk x2",
+	// "eggs 6x" or "flour 500 g".
+	trailing = regexp.MustCompile(`^(.+?)\s+(?:[x×]\s*` + number + `|` + number + `\s*[x×]|` + number + `\s*(\pL+)\.?)$`)
+	// only matches an amount with an optional unit and nothing else, like "500
+	// ml".
+	only = regexp.MustCompile(`^` + number + `\s*(?:(\pL+)\.?)?$`)
+)
+
+var fractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4, '⅛': 1.0 / 8,
+}
+
+// units maps the spellings of units to the unit they are stored as. Pieces
+// are stored without a unit.
+var units = map[string]string{
+	"g": "g", "gr": "g", "gram": "g", "grams": "g", "gramm": "g",
+	"kg": "kg", "kilo": "kg", "kilos": "kg", "kilogram": "kg", "kilograms": "kg",
+	"mg": "mg",
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"cl": "cl", "dl": "dl",
+	"l": "l", "liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+	"tbsp": "tbsp", "tbs": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp", "el": "tbsp",
+	"tsp": "tsp", "teaspoon": "tsp", "teaspoons": "tsp", "tl": "tsp",
+	"cup": "cup", "cups": "cup",
+	"pinch": "pinch", "pinches": "pinch", "prise": "pinch",
+	"can": "can", "cans": "can", "tin": "can", "tins": "can", "dose": "can", "dosen": "can",
+	"jar": "jar", "jars": "jar", "glas": "jar",
+	"pack": "pack", "packs": "pack", "package": "pack", "packages": "pack", "packet": "pack",
+	"packets": "pack", "pkg": "pack", "pck": "pack", "pkt": "pack", "packung": "pack", "päckchen": "pack",
+	"bag": "bag", "bags": "bag", "beutel": "bag",
+	"box": "box", "boxes": "box",
+	"bottle": "bottle", "bottles": "bottle", "flasche": "bottle", "flaschen": "bottle",
+	"bunch": "bunch", "bunches": "bunch", "bund": "bunch",
+	"clove": "clove", "cloves": "clove", "zehe": "clove", "zehen": "clove",
+	"slice": "slice", "slices": "slice", "scheibe": "slice", "scheiben": "slice",
+	"piece": "", "pieces": "", "pc": "", "pcs": "", "stk": "", "stück": "",
+	"dozen": "dozen",
+}
+
+// leadingQuantity parses the amount and unit at the start of s and returns
+// the rest of s. A number only counts as amount if it is followed by a unit,
+// an "x" or a space, so items like "7up" are left alone.
+func leadingQuantity(s string) (quantity *Quantity, rest string, ok bool) {
+	match := leading.FindStringSubmatch(s)
+	if match == nil {
+		return nil, s, false
+	}
+	amount, ok := parseNumber(match[2])
+	if !ok {
+		return nil, s, false
+	}
+	rest = s[len(match[0]):]
+
+	if m := times.FindString(rest); m != "" {
+		return &Quantity{Amount: amount}, strings.TrimSpace(rest[len(m):]), true
+	}
+	// a unit without anything after it is the item itself, as in "2 bottles"
+	if m := word.FindStringSubmatch(rest); m != nil {
+		unit, found := units[strings.ToLower(m[1])]
+		if after := strings.TrimSpace(rest[len(m[0]):]); found && after != "" {
+			return unitQuantity(amount, unit), after, true
+		}
+	}
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return nil, s, false
+	}
+	return &Quantity{Amount: amount}, strings.TrimSpace(rest), true
+}
+
+// trailingQuantity parses an amount at the end of s, like "milk x2" or
+// "flour 500 g", and returns the rest of s.
+func trailingQuantity(s string) (quantity *Quantity, rest string, ok bool) {
+	match := trailing.FindStringSubmatch(s)
+	if match == nil {
+		return nil, s, false
+	}
+	unit := ""
+	numberStr := match[2] + match[3] + match[4]
+	if match[5] != "" {
+		var found bool
+		unit, found = units[strings.ToLower(match[5])]
+		if !found {
+			return nil, s, false
+		}
+	}
+	amount, ok := parseNumber(numberStr)
+	if !ok {
+		return nil, s, false
+	}
+	return unitQuantity(amount, unit), match[1], true
+}
+
+// onlyQuantity parses s if it is nothing but an amount and unit, like "500 ml"
+// in "olive oil (500 ml)".
+func onlyQuantity(s string) (quantity *Quantity, ok bool) {
+	match := only.FindStringSubmatch(s)
+	if match == nil {
+		return nil, false
+	}
+	unit, found := units[strings.ToLower(match[2])]
+	if match[2] != "" && !found {
+		return nil, false
+	}
+	amount, ok := parseNumber(match[1])
+	if !ok {
+		return nil, false
+	}
+	return unitQuantity(amount, unit), true
+}
+
+func unitQuantity(amount float64, unit string) *Quantity {
+	if unit == "dozen" {
+		return &Quantity{Amount: amount * 12}
+	}
+	return &Quantity{Amount: amount, Unit: unit}
+}
+
+// parseNumber parses an amount matched by number.
+func parseNumber(s string) (amount float64, ok bool) {
+	var whole string
+	if fields := strings.Fields(s); len(fields) == 2 {
+		whole, s = fields[0], fields[1]
+	}
+	for r, fraction := range fractions {
+		if before, found := strings.CutSuffix(s, string(r)); found {
+			whole, s, amount = before, "", fraction
+			break
+		}
+	}
+	if numerator, denominator, found := strings.Cut(s, "/"); found {
+		n, err1 := strconv.Atoi(numerator)
+		d, err2 := strconv.Atoi(denominator)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, false
+		}
+		amount = float64(n) / float64(d)
+	} else if s != "" {
+		value, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		amount = value
+	}
+	if whole != "" {
+		value, err := strconv.Atoi(whole)
+		if err != nil {
+			return 0, false
+		}
+		amount += float64(value)
+	}
+	if amount <= 0 {
+		return 0, false
+	}
+	return math.Round(amount*1000) / 1000, true
+}
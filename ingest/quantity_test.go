@@ -0,0 +1,152 @@
+package ingest
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s      string
+		amount float64
+		ok     bool
+	}{
+		{"2", 2, true},
+		{"1.5", 1.5, true},
+		{"1,5", 1.5, true},
+		{"1/2", 0.5, true},
+		{"1 1/2", 1.5, true},
+		{"½", 0.5, true},
+		{"1½", 1.5, true},
+		{"2⅓", 2.333, true},
+		{"1/0", 0, false},
+		{"0", 0, false},
+	}
+	for _, test := range tests {
+		amount, ok := parseNumber(test.s)
+		if amount != test.amount || ok != test.ok {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v, %v", test.s, amount, ok, test.amount, test.ok)
+		}
+	}
+}
+
+func TestParseItem(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Item
+	}{
+		{"milk", Item{Text: "milk"}},
+		{"2 milk", Item{Text: "milk", Quantity: &Quantity{Amount: 2}}},
+		{"2x milk", Item{Text: "milk", Quantity: &Quantity{Amount: 2}}},
+		{"2 x milk", Item{Text: "milk", Quantity: &Quantity{Amount: 2}}},
+		{"200g flour", Item{Text: "flour", Quantity: &Quantity{Amount: 200, Unit: "g"}}},
+		{"2 cups of sugar", Item{Text: "sugar", Quantity: &Quantity{Amount: 2, Unit: "cup"}}},
+		{"1,5 kg potatoes", Item{Text: "potatoes", Quantity: &Quantity{Amount: 1.5, Unit: "kg"}}},
+		{"1 1/2 tbsp. oil", Item{Text: "oil", Quantity: &Quantity{Amount: 1.5, Unit: "tbsp"}}},
+		{"½ l cream", Item{Text: "cream", Quantity: &Quantity{Amount: 0.5, Unit: "l"}}},
+		{"2-3 onions", Item{Text: "onions", Quantity: &Quantity{Amount: 3}}},
+		{"1 dozen eggs", Item{Text: "eggs", Quantity: &Quantity{Amount: 12}}},
+		{"3 pcs lemons", Item{Text: "lemons", Quantity: &Quantity{Amount: 3}}},
+		{"2 bottles", Item{Text: "bottles", Quantity: &Quantity{Amount: 2}}},
+		{"milk x2", Item{Text: "milk", Quantity: &Quantity{Amount: 2}}},
+		{"eggs 6x", Item{Text: "eggs", Quantity: &Quantity{Amount: 6}}},
+		{"flour 500 g", Item{Text: "flour", Quantity: &Quantity{Amount: 500, Unit: "g"}}},
+		{"olive oil (500 ml)", Item{Text: "olive oil", Quantity: &Quantity{Amount: 500, Unit: "ml"}}},
+		{"basil (fresh)", Item{Text: "basil", Note: "fresh"}},
+		{"7up", Item{Text: "7up"}},
+		{"2 7up", Item{Text: "7up", Quantity: &Quantity{Amount: 2}}},
+		{"size 42 shoes", Item{Text: "size 42 shoes"}},
+		{"bread 2 loaves", Item{Text: "bread 2 loaves"}},
+	}
+	for _, test := range tests {
+		got, ok := parseItem(test.s)
+		if !ok {
+			t.Errorf("parseItem(%q) found no item", test.s)
+			continue
+		}
+		if got.Text != test.want.Text || got.Note != test.want.Note || !sameQuantity(got.Quantity, test.want.Quantity) {
+			t.Errorf("parseItem(%q) = %s, want %s", test.s, formatItem(got), formatItem(test.want))
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Item
+	}{
+		{
+			name: "request with commas and and",
+			text: "Please add milk, 2 eggs and bread to the list!",
+			want: []Item{{Text: "milk"}, {Text: "eggs", Quantity: &Quantity{Amount: 2}}, {Text: "bread"}},
+		},
+		{
+			name: "decimal comma is not a separator",
+			text: "1,5 kg apples; pears",
+			want: []Item{{Text: "apples", Quantity: &Quantity{Amount: 1.5, Unit: "kg"}}, {Text: "pears"}},
+		},
+		{
+			name: "recipe ingredient with a note",
+			text: "Ingredients:\n- 2 onions, finely chopped\n- 1 tsp salt",
+			want: []Item{
+				{Text: "onions", Note: "finely chopped", Quantity: &Quantity{Amount: 2}},
+				{Text: "salt", Quantity: &Quantity{Amount: 1, Unit: "tsp"}},
+			},
+		},
+		{
+			name: "chat export with checkboxes",
+			text: "[19.10.26, 17:30:12] Alice: ☐ butter\n10/19/26, 5:30 PM - Bob: [x] 3x yoghurt",
+			want: []Item{{Text: "butter"}, {Text: "yoghurt", Quantity: &Quantity{Amount: 3}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Parse(test.text)
+			if len(got) != len(test.want) {
+				t.Fatalf("Parse() = %s, want %s", formatItems(got), formatItems(test.want))
+			}
+			for i := range got {
+				if got[i].Text != test.want[i].Text || got[i].Note != test.want[i].Note ||
+					!sameQuantity(got[i].Quantity, test.want[i].Quantity) {
+					t.Fatalf("Parse() = %s, want %s", formatItems(got), formatItems(test.want))
+				}
+			}
+		})
+	}
+}
+
+func sameQuantity(a, b *Quantity) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatItem(item Item) string {
+	s := item.Text
+	if item.Quantity != nil {
+		s = "[" + formatQuantity(*item.Quantity) + "] " + s
+	}
+	if item.Note != "" {
+		s += " (" + item.Note + ")"
+	}
+	return s
+}
+
+func formatItems(items []Item) string {
+	s := ""
+	for i, item := range items {
+		if i > 0 {
+			s += "; "
+		}
+		s += formatItem(item)
+	}
+	return "{" + s + "}"
+}
+
+func formatQuantity(q Quantity) string {
+	return strconv.FormatFloat(q.Amount, 'f', -1, 64) + q.Unit
+}
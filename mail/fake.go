@@ -0,0 +1,175 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeServer is an SMTP server for testing. It accepts every mail without
+// delivering it and keeps it so that it can be inspected.
+type FakeServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	mails []Received
+}
+
+// Received is a mail the FakeServer has accepted.
+type Received struct {
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Data       []byte    `json:"-"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// ListenFake starts a FakeServer at addr, e.g. "127.0.0.1:0" for a random
+// port.
+func ListenFake(addr string) (server *FakeServer, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server = &FakeServer{listener: listener}
+	go server.serve()
+	return server, nil
+}
+
+func (s *FakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *FakeServer) Close() error {
+	return s.listener.Close()
+}
+
+// Mails returns the mails the server has accepted, oldest first.
+func (s *FakeServer) Mails() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received{}, s.mails...)
+}
+
+func (s *FakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks just enough SMTP (RFC 5321) for net/smtp to send mails.
+func (s *FakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(line string) bool {
+		return text.PrintfLine("%s", line) == nil
+	}
+
+	var mail Received
+	if !reply("220 localhost fake SMTP") {
+		return
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			mail = Received{}
+			reply("250 localhost")
+		case "MAIL":
+			mail = Received{From: address(arg)}
+			reply("250 OK")
+		case "RCPT":
+			mail.To = append(mail.To, address(arg))
+			reply("250 OK")
+		case "DATA":
+			if mail.From == "" || len(mail.To) == 0 {
+				reply("503 bad sequence of commands")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			mail.Data, err = text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.ReceivedAt = time.Now()
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			mail = Received{}
+			reply("250 OK")
+		case "RSET":
+			mail = Received{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// address returns the address in the argument of MAIL or RCPT, e.g.
+// "FROM:<alice@example.com>".
+func address(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+	return strings.Trim(path, "<>")
+}
+
+// Message parses a received mail sent by SMTP.Send back into a Message.
+func (r Received) Message() (message Message, err error) {
+	mail, err := netmail.ReadMessage(bytes.NewReader(r.Data))
+	if err != nil {
+		return message, err
+	}
+	message.To = mail.Header.Get("To")
+	message.Subject, err = new(mime.WordDecoder).DecodeHeader(mail.Header.Get("Subject"))
+	if err != nil {
+		return message, err
+	}
+	message.Unsubscribe = strings.Trim(mail.Header.Get("List-Unsubscribe"), "<>")
+
+	_, params, err := mime.ParseMediaType(mail.Header.Get("Content-Type"))
+	if err != nil {
+		return message, err
+	}
+	parts := multipart.NewReader(mail.Body, params["boundary"])
+	for {
+		// quoted-printable parts are decoded by the reader
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return message, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return message, err
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			message.Text = string(content)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			message.HTML = string(content)
+		}
+	}
+	return message, nil
+}
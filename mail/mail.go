@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+// Message is a mail with a plain text and an HTML version of its body. If
+// Unsubscribe is set, the mail carries it as List-Unsubscribe header, so that
+// mail clients can offer to unsubscribe with one click (RFC 8058).
+type Message struct {
+	To          string `json:"to"`
+	Subject     string `json:"subject"`
+	Text        string `json:"text"`
+	HTML        string `json:"html"`
+	Unsubscribe string `json:"unsubscribe,omitempty"`
+}
+
+// Mailer sends mails.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// SMTP sends mails through an SMTP server. Username and Password are only
+// needed if the server requires authentication, which net/smtp only performs
+// over TLS or with a server on localhost.
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(message Message) (err error) {
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := netmail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+	data, err := message.bytes(from, to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, data)
+}
+
+// bytes formats the message as multipart/alternative mail.
+func (m Message) bytes(from, to *netmail.Address, now time.Time) (data []byte, err error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	header := []string{
+		"From", from.String(),
+		"To", to.String(),
+		"Subject", mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date", now.Format(time.RFC1123Z),
+		"Message-ID", fmt.Sprintf("<%s@%s>", crypto.GenerateToken(16), domain(from.Address)),
+		"MIME-Version", "1.0",
+		"Content-Type", "multipart/alternative; boundary=" + body.Boundary(),
+	}
+	if m.Unsubscribe != "" {
+		header = append(header,
+			"List-Unsubscribe", "<"+m.Unsubscribe+">",
+			"List-Unsubscribe-Post", "List-Unsubscribe=One-Click",
+		)
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(header); i += 2 {
+		fmt.Fprintf(&out, "%s: %s\r\n", header[i], header[i+1])
+	}
+	out.WriteString("\r\n")
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, part := range parts {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
+
+func domain(address string) string {
+	_, host, _ := strings.Cut(address, "@")
+	return host
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templates, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/*.html"))
+)
+
+// Render executes the plain text and HTML template of a mail with data, e.g.
+// templates/invitation.txt and templates/invitation.html for "invitation".
+// The templates share a "header" and "footer", which take the Subject and
+// Unsubscribe fields of data; the unsubscribe link is left out if it is empty.
+func Render(name string, data any) (text, html string, err error) {
+	var textBuf, htmlBuf bytes.Buffer
+	err = textTemplates.ExecuteTemplate(&textBuf, name+".txt", data)
+	if err != nil {
+		return "", "", err
+	}
+	err = htmlTemplates.ExecuteTemplate(&htmlBuf, name+".html", data)
+	if err != nil {
+		return "", "", err
+	}
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// RenderPage executes the HTML template of a page linked from mails, like
+// templates/unsubscribe.html for "unsubscribe". Pages share the "header" and
+// "footer" of mails.
+func RenderPage(name string, data any) (html string, err error) {
+	var buf bytes.Buffer
+	err = htmlTemplates.ExecuteTemplate(&buf, name+".html", data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
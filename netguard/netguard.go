@@ -0,0 +1,63 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for hosts on loopback, private, link-local
+// or unspecified addresses, which requests made on behalf of users, to
+// webhooks and push services, must not reach.
+var ErrForbiddenAddress = errors.New("error: host must not be a loopback, private or link-local address")
+
+// NewClient returns a client that only connects to public addresses, unless
+// allowPrivate is set, and does not follow redirects. The address is checked
+// when connecting, after the host is resolved, so a host that resolves to a
+// public address when it is checked cannot rebind to a private one later.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); !allowPrivate && (ip == nil || forbidden(ip)) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckHost checks that a host only resolves to public addresses.
+func CheckHost(ctx context.Context, host string) (err error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("error: host '%s' cannot be resolved", host)
+	}
+	for _, addr := range addrs {
+		if forbidden(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// forbidden reports whether an address is not on the public internet.
+func forbidden(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
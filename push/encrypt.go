@@ -0,0 +1,145 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	recordSize = 4096
+	// MaxMessageSize is the size of the largest message that fits into the
+	// 4096 bytes every push service has to accept, with the header and the
+	// authentication tag of the encryption.
+	MaxMessageSize = recordSize - headerSize - 16 - 1
+	headerSize     = 16 + 4 + 1 + 65
+)
+
+var (
+	ErrTooLarge = errors.New("error: push message is too large")
+	ErrInvalid  = errors.New("error: push message cannot be decrypted")
+)
+
+// Encrypt encrypts a message for a subscription, given its P-256 public key
+// and authentication secret, with the aes128gcm content coding of RFC 8291.
+func Encrypt(p256dh, auth, message []byte) (body []byte, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	return encrypt(p256dh, auth, message, key, salt)
+}
+
+func encrypt(p256dh, auth, message []byte, key *ecdh.PrivateKey, salt []byte) (body []byte, err error) {
+	if len(message) > MaxMessageSize {
+		return nil, ErrTooLarge
+	}
+	subscriptionKey, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := key.ECDH(subscriptionKey)
+	if err != nil {
+		return nil, err
+	}
+	serverKey := key.PublicKey().Bytes()
+
+	gcm, nonce, err := contentKey(secret, auth, p256dh, serverKey, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	// the whole message is a single record, ended by the delimiter 2
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(serverKey)))
+	body = append(body, serverKey...)
+	return gcm.Seal(body, nonce, append(bytes.Clone(message), 2), nil), nil
+}
+
+// Decrypt decrypts a message encrypted by Encrypt for the subscription with
+// the given private key and authentication secret.
+func Decrypt(key *ecdh.PrivateKey, auth, body []byte) (message []byte, err error) {
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		return nil, ErrInvalid
+	}
+	salt, keyLength := body[:16], int(body[20])
+	serverKey, ciphertext := body[21:21+keyLength], body[21+keyLength:]
+
+	publicKey, err := ecdh.P256().NewPublicKey(serverKey)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	secret, err := key.ECDH(publicKey)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	gcm, nonce, err := contentKey(secret, auth, key.PublicKey().Bytes(), serverKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 2 {
+		return nil, ErrInvalid
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+// contentKey derives the content encryption key and nonce from the ECDH
+// secret of the subscription and server keys, as in section 3.4 of RFC 8291.
+func contentKey(secret, auth, subscriptionKey, serverKey, salt []byte) (gcm cipher.AEAD, nonce []byte, err error) {
+	info := append([]byte("WebPush: info\x00"), subscriptionKey...)
+	info = append(info, serverKey...)
+	ikm, err := expand(hkdf.Extract(sha256.New, secret, auth), info, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err = expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, nonce, nil
+}
+
+func expand(prk, info []byte, length int) (key []byte, err error) {
+	key = make([]byte, length)
+	_, err = io.ReadFull(hkdf.Expand(sha256.New, prk, info), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
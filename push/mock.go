@@ -0,0 +1,90 @@
+package push
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+// Mock is a push service for testing. It hands out subscriptions, checks the
+// VAPID authorization of the messages sent to them and keeps the decrypted
+// messages so that they can be inspected.
+type Mock struct {
+	mu            sync.Mutex
+	subscriptions map[string]*mockSubscription
+}
+
+type mockSubscription struct {
+	key      *ecdh.PrivateKey
+	auth     []byte
+	status   int
+	messages [][]byte
+}
+
+func NewMock() *Mock {
+	return &Mock{
+		subscriptions: map[string]*mockSubscription{},
+	}
+}
+
+// Subscribe creates a subscription and returns its token and keys. A status
+// other than 0 makes the mock respond to every message with that status
+// instead of accepting it, to simulate failing push services.
+func (m *Mock) Subscribe(status int) (token string, p256dh, auth []byte, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	auth = make([]byte, 16)
+	_, err = rand.Read(auth)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	token = crypto.GenerateToken(24)
+	m.mu.Lock()
+	m.subscriptions[token] = &mockSubscription{key: key, auth: auth, status: status}
+	m.mu.Unlock()
+	return token, key.PublicKey().Bytes(), auth, nil
+}
+
+// Receive accepts a message for the subscription with the given token, sent
+// to the mock at origin, and returns the status to respond with.
+func (m *Mock) Receive(token, origin, authorization string, body []byte) (status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscription, ok := m.subscriptions[token]
+	if !ok {
+		return http.StatusGone
+	}
+	if subscription.status != 0 {
+		return subscription.status
+	}
+	if verifyAuthorization(authorization, origin, time.Now()) != nil {
+		return http.StatusUnauthorized
+	}
+	message, err := Decrypt(subscription.key, subscription.auth, body)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+
+	subscription.messages = append(subscription.messages, message)
+	return http.StatusCreated
+}
+
+// Messages returns the messages a subscription has received, oldest first.
+func (m *Mock) Messages(token string) (messages [][]byte, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscription, ok := m.subscriptions[token]
+	if !ok {
+		return nil, false
+	}
+	return subscription.messages, true
+}
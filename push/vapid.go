@@ -0,0 +1,246 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slh335/shoppinglistserver/netguard"
+)
+
+// ErrGone is returned when the push service reports that a subscription has
+// expired or was unsubscribed, so that it can be dropped.
+var ErrGone = errors.New("error: push subscription is gone")
+
+// StatusError is returned when the push service rejects a message for another
+// reason. Messages that failed with a server error or because of rate limiting
+// may succeed when retried.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error: push service responded with status %d", e.StatusCode)
+}
+
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Sender sends push messages, identifying itself to push services with its
+// VAPID key (RFC 8292). Subject is a mailto: or https: URL push services can
+// contact the operator at.
+type Sender struct {
+	Key     *ecdsa.PrivateKey
+	Subject string
+	Client  *http.Client
+	// AllowPrivate allows push services on private addresses, for development.
+	AllowPrivate bool
+}
+
+// NewSender returns a sender whose client only connects to public addresses,
+// unless allowPrivate is set, and does not follow redirects, since endpoints
+// are chosen by users.
+func NewSender(key *ecdsa.PrivateKey, subject string, timeout time.Duration, allowPrivate bool) *Sender {
+	return &Sender{
+		Key:          key,
+		Subject:      subject,
+		Client:       netguard.NewClient(timeout, allowPrivate),
+		AllowPrivate: allowPrivate,
+	}
+}
+
+// CheckEndpoint checks that the host of a subscription endpoint only resolves
+// to public addresses.
+func (s *Sender) CheckEndpoint(ctx context.Context, endpoint string) (err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if s.AllowPrivate {
+		return nil
+	}
+	return netguard.CheckHost(ctx, u.Hostname())
+}
+
+// LoadKey reads a VAPID key from a PEM file, which is created with a new key
+// if it does not exist yet. Subscriptions are bound to the key, so it must not
+// change.
+func LoadKey(path string) (key *ecdsa.PrivateKey, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		return key, os.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("error: %s does not contain an EC private key", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// PublicKey returns the public key of the sender as an uncompressed P-256
+// point in URL-safe base64, which browsers take as applicationServerKey.
+func (s *Sender) PublicKey() string {
+	key, err := s.Key.PublicKey.ECDH()
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes())
+}
+
+// Send encrypts a message for a subscription and hands it to its push
+// service, which keeps it for at most ttl while the device is offline.
+func (s *Sender) Send(endpoint string, p256dh, auth, message []byte, ttl time.Duration) (err error) {
+	body, err := Encrypt(p256dh, auth, message)
+	if err != nil {
+		return err
+	}
+	authorization, err := s.authorization(endpoint, time.Now().Add(12*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+
+	res, err := s.Client.Do(req)
+	// the endpoint can never be reached, so the subscription is dropped
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return ErrGone
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return ErrGone
+	default:
+		return &StatusError{StatusCode: res.StatusCode}
+	}
+}
+
+type claims struct {
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	Subject   string `json:"sub,omitempty"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+
+// authorization returns the Authorization header for a request to the push
+// service of endpoint: a JWT signed with the VAPID key, and the key itself.
+func (s *Sender) authorization(endpoint string, expiresAt time.Time) (header string, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims{
+		Audience:  u.Scheme + "://" + u.Host,
+		ExpiresAt: expiresAt.Unix(),
+		Subject:   s.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(unsigned))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.Key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	ss.FillBytes(signature[32:])
+
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, s.PublicKey()), nil
+}
+
+// verifyAuthorization checks that an Authorization header is a valid VAPID
+// authorization for the push service at origin.
+func verifyAuthorization(header, origin string, now time.Time) (err error) {
+	var token, publicKey string
+	for _, param := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			publicKey = value
+		}
+	}
+	invalid := errors.New("error: invalid VAPID authorization")
+
+	keyBytes, err := base64.RawURLEncoding.DecodeString(publicKey)
+	if err != nil {
+		return invalid
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), keyBytes)
+	if x == nil {
+		return invalid
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return invalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return invalid
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, hash[:], r, s) {
+		return invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return invalid
+	}
+	var c claims
+	err = json.Unmarshal(payload, &c)
+	if err != nil || c.Audience != origin || now.Unix() >= c.ExpiresAt {
+		return invalid
+	}
+	return nil
+}
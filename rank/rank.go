@@ -0,0 +1,62 @@
+package rank
+
+import "strings"
+
+// digits are ordered by their byte value, so keys compare correctly as plain
+// strings, including in SQL ORDER BY clauses.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// Between returns a key that sorts strictly between prev and next. An empty
+// prev stands for the start and an empty next for the end of the sequence.
+// prev must sort before next, otherwise the result is meaningless.
+func Between(prev, next string) (key string) {
+	buf := []byte{}
+	bounded := next != ""
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(prev) {
+			lo = strings.IndexByte(digits, prev[i])
+		}
+		hi := base
+		if bounded && i < len(next) {
+			hi = strings.IndexByte(digits, next[i])
+		}
+
+		if hi-lo > 1 {
+			buf = append(buf, digits[(lo+hi)/2])
+			return string(buf)
+		}
+		buf = append(buf, digits[lo])
+		if hi-lo == 1 {
+			bounded = false
+		}
+	}
+}
+
+// Valid reports whether prev and next can be passed to Between.
+func Valid(prev, next string) (valid bool) {
+	return next == "" || prev < next
+}
+
+// Spread returns n evenly spaced keys in ascending order, leaving room for
+// insertions before, between and after them.
+func Spread(n int) (keys []string) {
+	width, space := 1, base
+	for space <= n+1 {
+		width++
+		space *= base
+	}
+
+	for i := 1; i <= n; i++ {
+		value := i * space / (n + 1)
+		buf := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = digits[value%base]
+			value /= base
+		}
+		keys = append(keys, strings.TrimRight(string(buf), "0"))
+	}
+	return keys
+}
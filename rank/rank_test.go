@@ -0,0 +1,125 @@
+package rank
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       string
+	}{
+		{"", "", "V"},
+		{"V", "", "k"},
+		{"", "V", "F"},
+		{"F", "V", "N"},
+		{"V", "W", "VV"},
+		{"V", "V1", "V0V"},
+		{"V0V", "V1", "V0k"},
+		{"Vz", "W", "VzV"},
+		{"z", "", "zV"},
+		{"", "1", "0V"},
+	}
+	for _, test := range tests {
+		got := Between(test.prev, test.next)
+		if got != test.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", test.prev, test.next, got, test.want)
+		}
+	}
+}
+
+// TestBetweenRepeated inserts keys at the same place over and over, like
+// entries that are always dropped right after the first one. One bound stays
+// fixed while the other moves to the new key.
+func TestBetweenRepeated(t *testing.T) {
+	tests := []struct {
+		name     string
+		prev     string
+		next     string
+		movePrev bool
+	}{
+		{"right after an entry", "F", "V", false},
+		{"right before an entry", "F", "V", true},
+		{"at the start", "", "V", false},
+		{"at the end", "V", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prev, next := test.prev, test.next
+			for i := 0; i < 500; i++ {
+				key := Between(prev, next)
+				if key <= prev || (next != "" && key >= next) {
+					t.Fatalf("insertion %d: %q does not sort between %q and %q", i, key, prev, next)
+				}
+				if test.movePrev {
+					prev = key
+				} else {
+					next = key
+				}
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       bool
+	}{
+		{"", "", true},
+		{"V", "", true},
+		{"", "V", true},
+		{"F", "V", true},
+		{"V", "V", false},
+		{"V", "F", false},
+	}
+	for _, test := range tests {
+		got := Valid(test.prev, test.next)
+		if got != test.want {
+			t.Errorf("Valid(%q, %q) = %v, want %v", test.prev, test.next, got, test.want)
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		n     int
+		first string
+		width int
+	}{
+		{0, "", 0},
+		{1, "V", 1},
+		{2, "K", 1},
+		{60, "1", 1},
+		{61, "1", 2},
+		{1000, "03", 2},
+	}
+	for _, test := range tests {
+		keys := Spread(test.n)
+		if len(keys) != test.n {
+			t.Fatalf("Spread(%d) returned %d keys", test.n, len(keys))
+		}
+		if test.n == 0 {
+			continue
+		}
+		if keys[0] != test.first {
+			t.Errorf("Spread(%d)[0] = %q, want %q", test.n, keys[0], test.first)
+		}
+		if !sort.StringsAreSorted(keys) {
+			t.Errorf("Spread(%d) is not in ascending order", test.n)
+		}
+		for i, key := range keys {
+			if len(key) > test.width || key == "" {
+				t.Errorf("Spread(%d)[%d] = %q, want at most %d digits", test.n, i, key, test.width)
+			}
+			if i > 0 && key == keys[i-1] {
+				t.Errorf("Spread(%d) has %q twice", test.n, key)
+			}
+		}
+		// there is room before the first and after the last key
+		if Between("", keys[0]) >= keys[0] || Between(keys[len(keys)-1], "") <= keys[len(keys)-1] {
+			t.Errorf("Spread(%d) leaves no room at the ends", test.n)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package recipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/ingest"
+)
+
+// ErrNoRecipe is returned for documents without a schema.org Recipe.
+var ErrNoRecipe = errors.New("error: document does not contain a recipe")
+
+var (
+	// script matches the JSON-LD blocks of an HTML page.
+	script = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	tag    = regexp.MustCompile(`(?s)<[^>]*>`)
+	space  = regexp.MustCompile(`\s+`)
+	digits = regexp.MustCompile(`\d+`)
+)
+
+// Parse reads the first schema.org Recipe from an HTML page with JSON-LD
+// blocks or from a JSON-LD document. Only its name, yield, ingredients and URL
+// are used. Recipes without a yield are taken to be for one serving.
+func Parse(data []byte) (recipe Recipe, err error) {
+	var blocks [][]byte
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+		blocks = append(blocks, trimmed)
+	} else {
+		for _, match := range script.FindAllSubmatch(data, -1) {
+			blocks = append(blocks, match[1])
+		}
+	}
+
+	for _, block := range blocks {
+		var document any
+		if json.Unmarshal(block, &document) != nil {
+			continue
+		}
+		node := find(document)
+		if node == nil {
+			continue
+		}
+
+		recipe.Name = clean(str(node["name"]))
+		if recipe.Name == "" {
+			recipe.Name = "Recipe"
+		}
+		recipe.Servings = servings(node["recipeYield"])
+		recipe.URL = str(node["url"])
+		if recipe.URL == "" {
+			recipe.URL = str(node["mainEntityOfPage"])
+		}
+		lines := strs(node["recipeIngredient"])
+		if len(lines) == 0 {
+			lines = strs(node["ingredients"])
+		}
+		recipe.Ingredients = Ingredients(lines)
+		return recipe, nil
+	}
+	return recipe, ErrNoRecipe
+}
+
+// Ingredients parses lines of ingredients like "2 onions, finely chopped".
+// Lines with several items, like "salt, pepper", become several ingredients
+// of the same line.
+func Ingredients(lines []string) (ingredients []Ingredient) {
+	ingredients = []Ingredient{}
+	for _, line := range lines {
+		line = clean(line)
+		for _, item := range ingest.Parse(line) {
+			ingredients = append(ingredients, Ingredient{
+				Line:     line,
+				Text:     item.Text,
+				Note:     item.Note,
+				Quantity: item.Quantity,
+			})
+		}
+	}
+	return ingredients
+}
+
+// find returns the first node of type Recipe, looking into arrays, @graph and
+// mainEntity.
+func find(v any) map[string]any {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if node := find(item); node != nil {
+				return node
+			}
+		}
+	case map[string]any:
+		types := strs(v["@type"])
+		if slices.Contains(types, "Recipe") || slices.Contains(types, "schema:Recipe") {
+			return v
+		}
+		for _, key := range []string{"@graph", "mainEntity"} {
+			if node := find(v[key]); node != nil {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// servings returns the number of servings of a yield like 4, "4", "4
+// servings" or ["4", "4 servings"].
+func servings(yield any) int {
+	for _, s := range strs(yield) {
+		if n, err := strconv.Atoi(digits.FindString(s)); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// str returns a string value, or the @id of an object value.
+func str(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		return str(v["@id"])
+	}
+	return ""
+}
+
+// strs returns a string, number or array of them as strings.
+func strs(v any) (values []string) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		for _, item := range v {
+			values = append(values, strs(item)...)
+		}
+	}
+	return values
+}
+
+// clean strips markup, entities and extra whitespace from a text.
+func clean(s string) string {
+	s = html.UnescapeString(tag.ReplaceAllString(s, " "))
+	return strings.TrimSpace(space.ReplaceAllString(s, " "))
+}
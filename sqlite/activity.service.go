@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type ActivityService struct {
+	DB *sql.DB
+}
+
+var activitySorts = map[string]sortOrder[Activity]{
+	SortCreated: {
+		{expr: "entry_history.id", desc: true, value: func(a Activity) any { return a.Id }},
+	},
+}
+
+// List returns a page of the changes to entries of a list, newest first. Only
+// the CreatedSince and CreatedBy filters apply to activity, the latter
+// selecting the changes a user made.
+func (m *ActivityService) List(listId int, filter Filter) (activities []Activity, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCreated
+	}
+	order, ok := lookupSort(activitySorts, sortName)
+	if !ok {
+		return activities, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("(list_id=? OR source_list_id=?)", listId, listId)
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(created_at)>=?", filter.CreatedSince.Unix())
+	}
+	if filter.CreatedBy != 0 {
+		s.where("user_id=?", filter.CreatedBy)
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
+	if err != nil {
+		return activities, "", err
+	}
+
+	stmt := `
+		SELECT entry_history.id, entry_id, list_id, users.id, users.username, action, before, after, created_at
+		FROM entry_history
+		INNER JOIN users ON entry_history.user_id=users.id` + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
+	if err != nil {
+		return activities, "", err
+	}
+	activities, err = scanActivities(rows)
+	if err != nil {
+		return activities, "", err
+	}
+	activities, next = page(order, sortName, activities, filter.Limit)
+	return activities, next, nil
+}
+
+// EntryList returns the list an entry was on at its latest change, or
+// sql.ErrNoRows if it has no history.
+func (m *ActivityService) EntryList(entryId int) (listId int, err error) {
+	stmt := "SELECT list_id FROM entry_history WHERE entry_id=? ORDER BY id DESC LIMIT 1"
+	err = m.DB.QueryRow(stmt, entryId).Scan(&listId)
+	return listId, err
+}
+
+// Entry returns the history of an entry on a list, oldest first: the changes
+// made while it was on the list, and its moves to or from the list. Changes
+// made on other lists before or after a move are left out.
+func (m *ActivityService) Entry(entryId, listId int) (activities []Activity, err error) {
+	stmt := `
+		SELECT entry_history.id, entry_id, list_id, users.id, users.username, action, before, after, created_at
+		FROM entry_history
+		INNER JOIN users ON entry_history.user_id=users.id
+		WHERE entry_id=? AND (list_id=? OR source_list_id=?)
+		ORDER BY entry_history.id`
+	rows, err := m.DB.Query(stmt, entryId, listId, listId)
+	if err != nil {
+		return activities, err
+	}
+	return scanActivities(rows)
+}
+
+func scanActivities(rows *sql.Rows) (activities []Activity, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var activity Activity
+		var beforeJson sql.NullString
+		var afterJson, createdAtStr string
+		err = rows.Scan(
+			&activity.Id, &activity.EntryId, &activity.ListId,
+			&activity.User.Id, &activity.User.Username,
+			&activity.Action, &beforeJson, &afterJson, &createdAtStr,
+		)
+		if err != nil {
+			return activities, err
+		}
+
+		if beforeJson.Valid {
+			err = json.Unmarshal([]byte(beforeJson.String), &activity.Before)
+			if err != nil {
+				return activities, err
+			}
+		}
+		err = json.Unmarshal([]byte(afterJson), &activity.After)
+		if err != nil {
+			return activities, err
+		}
+		activity.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return activities, err
+		}
+
+		activities = append(activities, activity)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return activities, err
+	}
+	return activities, nil
+}
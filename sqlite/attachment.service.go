@@ -0,0 +1,113 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type AttachmentService struct {
+	DB *sql.DB
+}
+
+const attachmentColumns = `
+	attachments.id, attachments.entry_id, attachments.key, attachments.thumbnail_key,
+	attachments.content_type, attachments.size, attachments.width, attachments.height,
+	attachments.created_at`
+
+func scanAttachment(row scanner) (attachment Attachment, err error) {
+	var createdAtStr string
+	err = row.Scan(
+		&attachment.Id, &attachment.EntryId, &attachment.Key, &attachment.ThumbnailKey,
+		&attachment.ContentType, &attachment.Size, &attachment.Width, &attachment.Height,
+		&createdAtStr,
+	)
+	if err != nil {
+		return attachment, err
+	}
+	attachment.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return attachment, err
+	}
+	return attachment, nil
+}
+
+func (m *AttachmentService) Get(id int) (attachment Attachment, err error) {
+	stmt := "SELECT" + attachmentColumns + " FROM attachments WHERE id=?"
+	row := m.DB.QueryRow(stmt, id)
+
+	return scanAttachment(row)
+}
+
+func (m *AttachmentService) Add(attachment Attachment) (Attachment, error) {
+	attachment.CreatedAt = time.Now()
+	stmt := `
+		INSERT INTO attachments (entry_id, key, thumbnail_key, content_type, size, width, height, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := m.DB.Exec(stmt,
+		attachment.EntryId, attachment.Key, attachment.ThumbnailKey, attachment.ContentType,
+		attachment.Size, attachment.Width, attachment.Height, attachment.CreatedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	attachment.Id = int(lastInsertId)
+	return attachment, nil
+}
+
+func (m *AttachmentService) Delete(id int) (deleted bool, err error) {
+	stmt := "DELETE FROM attachments WHERE id=?"
+	res, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+func entryAttachments(db *sql.DB, entryId int) (attachments []Attachment, err error) {
+	stmt := "SELECT" + attachmentColumns + " FROM attachments WHERE entry_id=? ORDER BY id"
+	rows, err := db.Query(stmt, entryId)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return attachments, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// listAttachments returns the attachments of all entries of a list, keyed by
+// entry id.
+func listAttachments(db *sql.DB, listId int) (attachments map[int][]Attachment, err error) {
+	stmt := "SELECT" + attachmentColumns + `
+		FROM attachments
+		INNER JOIN entries ON attachments.entry_id=entries.id
+		WHERE entries.list_id=?
+		ORDER BY attachments.id`
+	rows, err := db.Query(stmt, listId)
+	if err != nil {
+		return attachments, err
+	}
+	defer rows.Close()
+
+	attachments = map[int][]Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return attachments, err
+		}
+		attachments[attachment.EntryId] = append(attachments[attachment.EntryId], attachment)
+	}
+	return attachments, rows.Err()
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,10 @@ import (
 	"github.com/slh335/shoppinglistserver/crypto"
 )
 
+// ErrResetTokenInvalid is returned when resetting a password with a token
+// that does not exist, has expired or was used already.
+var ErrResetTokenInvalid = errors.New("error: password reset token is invalid or has expired")
+
 type AuthService struct {
 	DB *sql.DB
 }
@@ -115,3 +120,65 @@ func (s *AuthService) VerifySession(token string) (session Session, err error) {
 
 	return session, nil
 }
+
+// NewPasswordReset returns a token the user can set a new password with until
+// expiresAt.
+func (m *AuthService) NewPasswordReset(userId int, expiresAt time.Time) (token string, err error) {
+	token = crypto.GenerateToken(32)
+	stmt := "INSERT INTO password_resets (token, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)"
+	_, err = m.DB.Exec(stmt, token, userId, time.Now().UTC().Format(time.RFC3339),
+		expiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword sets a new password for the user a reset token was made for.
+// All reset tokens and sessions of the user are dropped, so that whoever knew
+// the old password is logged out.
+func (m *AuthService) ResetPassword(token, password string, now time.Time) (user User, err error) {
+	passwordHash, err := crypto.HashPassword(password)
+	if err != nil {
+		return user, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		SELECT users.id, users.username
+		FROM password_resets
+		INNER JOIN users ON password_resets.user_id=users.id
+		WHERE password_resets.token=? AND unixepoch(password_resets.expires_at)>?`
+	err = tx.QueryRow(stmt, token, now.Unix()).Scan(&user.Id, &user.Username)
+	if err == sql.ErrNoRows {
+		return user, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return user, err
+	}
+
+	_, err = tx.Exec("UPDATE users SET password_hash=? WHERE id=?", passwordHash, user.Id)
+	if err != nil {
+		return user, err
+	}
+	_, err = tx.Exec("DELETE FROM password_resets WHERE user_id=?", user.Id)
+	if err != nil {
+		return user, err
+	}
+	_, err = tx.Exec("DELETE FROM sessions WHERE user_id=?", user.Id)
+	if err != nil {
+		return user, err
+	}
+	return user, tx.Commit()
+}
+
+// PruneResets deletes the password reset tokens that expired before now.
+func (m *AuthService) PruneResets(now time.Time) (err error) {
+	_, err = m.DB.Exec("DELETE FROM password_resets WHERE unixepoch(expires_at)<=?", now.Unix())
+	return err
+}
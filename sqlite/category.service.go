@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/category"
+)
+
+type CategoryService struct {
+	DB *sql.DB
+}
+
+const categoryRuleColumns = "id, list_id, keyword, category, created_at"
+
+func scanCategoryRule(row scanner) (rule CategoryRule, err error) {
+	var createdAtStr string
+	err = row.Scan(&rule.Id, &rule.ListId, &rule.Keyword, &rule.Category, &createdAtStr)
+	if err != nil {
+		return rule, err
+	}
+	rule.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+func (m *CategoryService) GetRule(id int) (rule CategoryRule, err error) {
+	stmt := "SELECT " + categoryRuleColumns + " FROM category_rules WHERE id=?"
+	row := m.DB.QueryRow(stmt, id)
+
+	return scanCategoryRule(row)
+}
+
+func (m *CategoryService) Rules(listId int) (rules []CategoryRule, err error) {
+	stmt := "SELECT " + categoryRuleColumns + " FROM category_rules WHERE list_id=? ORDER BY keyword"
+	rows, err := m.DB.Query(stmt, listId)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := scanCategoryRule(rows)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// SetRule adds a rule to a list, replacing the category of an existing rule
+// with the same keyword.
+func (m *CategoryService) SetRule(listId int, keyword, category string) (rule CategoryRule, err error) {
+	stmt := `
+		INSERT INTO category_rules (list_id, keyword, category, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (list_id, keyword) DO UPDATE SET category=excluded.category`
+	_, err = m.DB.Exec(stmt, listId, keyword, category, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return rule, err
+	}
+
+	stmt = "SELECT " + categoryRuleColumns + " FROM category_rules WHERE list_id=? AND keyword=?"
+	row := m.DB.QueryRow(stmt, listId, keyword)
+	return scanCategoryRule(row)
+}
+
+func (m *CategoryService) DeleteRule(id int) (deleted bool, err error) {
+	stmt := "DELETE FROM category_rules WHERE id=?"
+	res, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Infer picks a category for a new entry of a list. The rules of the list are
+// tried first, then the category the same item was last put into on that list,
+// then the built-in dictionary. If nothing matches it returns category.Other.
+func (m *CategoryService) Infer(listId int, text string) (inferred string, err error) {
+	rules, err := m.Rules(listId)
+	if err != nil {
+		return "", err
+	}
+	words := " " + normalizeWords(text) + " "
+	best := ""
+	for _, rule := range rules {
+		keyword := normalizeWords(rule.Keyword)
+		// the longest matching keyword is the most specific one
+		if keyword != "" && len(keyword) > len(best) && strings.Contains(words, " "+keyword+" ") {
+			best, inferred = keyword, rule.Category
+		}
+	}
+	if best != "" {
+		return inferred, nil
+	}
+
+	stmt := `
+		SELECT category
+		FROM entries
+		WHERE list_id=? AND text=? COLLATE NOCASE AND category!=''
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`
+	err = m.DB.QueryRow(stmt, listId, strings.TrimSpace(text)).Scan(&inferred)
+	if err == nil {
+		return inferred, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	inferred, ok := category.Infer(text)
+	if ok {
+		return inferred, nil
+	}
+	return category.Other, nil
+}
+
+// normalizeWords lowercases text and separates its words by single spaces, so
+// that keywords match regardless of punctuation.
+func normalizeWords(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+type EmailService struct {
+	DB *sql.DB
+}
+
+const emailSettingsColumns = `
+	users.id, users.username, email_settings.email, email_settings.notifications,
+	email_settings.digest, email_settings.digest_sent_at, email_settings.unsubscribe_token,
+	email_settings.verified_at, email_settings.verification_token`
+
+func scanEmailSettings(row scanner) (settings EmailSettings, err error) {
+	var digestSentAtStr, verifiedAtStr, verificationToken sql.NullString
+	err = row.Scan(
+		&settings.User.Id, &settings.User.Username, &settings.Email, &settings.Notifications,
+		&settings.Digest, &digestSentAtStr, &settings.UnsubscribeToken,
+		&verifiedAtStr, &verificationToken,
+	)
+	if err != nil {
+		return settings, err
+	}
+	settings.Verified = verifiedAtStr.Valid
+	settings.VerificationToken = verificationToken.String
+	if digestSentAtStr.Valid {
+		digestSentAt, err := time.Parse(time.RFC3339, digestSentAtStr.String)
+		if err != nil {
+			return settings, err
+		}
+		settings.DigestSentAt = &digestSentAt
+	}
+	return settings, nil
+}
+
+// Settings returns the email settings of a user, or sql.ErrNoRows if they
+// have not given an email address.
+func (m *EmailService) Settings(userId int) (settings EmailSettings, err error) {
+	stmt := `
+		SELECT ` + emailSettingsColumns + `
+		FROM email_settings
+		INNER JOIN users ON email_settings.user_id=users.id
+		WHERE email_settings.user_id=?`
+	return scanEmailSettings(m.DB.QueryRow(stmt, userId))
+}
+
+// SetSettings saves the email settings of a user. The unsubscribe token is
+// created the first time and kept afterwards, so that links in mails that
+// were already sent keep working. A new address is unverified and gets a new
+// verification token.
+func (m *EmailService) SetSettings(settings EmailSettings) (_ EmailSettings, err error) {
+	stmt := `
+		INSERT INTO email_settings (user_id, email, notifications, digest, unsubscribe_token, verification_token)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email=excluded.email, notifications=excluded.notifications, digest=excluded.digest,
+			verified_at=CASE WHEN email=excluded.email THEN verified_at END,
+			verification_token=CASE
+				WHEN email=excluded.email AND (verified_at IS NOT NULL OR verification_token IS NOT NULL) THEN verification_token
+				ELSE excluded.verification_token
+			END`
+	_, err = m.DB.Exec(stmt, settings.User.Id, settings.Email, settings.Notifications, settings.Digest,
+		crypto.GenerateToken(32), crypto.GenerateToken(32))
+	if err != nil {
+		return settings, err
+	}
+	return m.Settings(settings.User.Id)
+}
+
+// Verify marks the address with the given verification token as verified.
+func (m *EmailService) Verify(token string) (settings EmailSettings, err error) {
+	stmt := "UPDATE email_settings SET verified_at=?, verification_token=NULL WHERE verification_token=? RETURNING user_id"
+	var userId int
+	err = m.DB.QueryRow(stmt, time.Now().UTC().Format(time.RFC3339), token).Scan(&userId)
+	if err != nil {
+		return settings, err
+	}
+	return m.Settings(userId)
+}
+
+func (m *EmailService) RemoveSettings(userId int) (removed bool, err error) {
+	res, err := m.DB.Exec("DELETE FROM email_settings WHERE user_id=?", userId)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Unsubscribe turns off notifications and the digest for the user with the
+// given unsubscribe token.
+func (m *EmailService) Unsubscribe(token string) (settings EmailSettings, err error) {
+	stmt := "UPDATE email_settings SET notifications=FALSE, digest=? WHERE unsubscribe_token=? RETURNING user_id"
+	var userId int
+	err = m.DB.QueryRow(stmt, DigestOff, token).Scan(&userId)
+	if err != nil {
+		return settings, err
+	}
+	return m.Settings(userId)
+}
+
+// DueDigests returns the settings of the users with a verified address whose
+// daily or weekly digest is due at now.
+func (m *EmailService) DueDigests(now time.Time) (due []EmailSettings, err error) {
+	stmt := `
+		SELECT ` + emailSettingsColumns + `
+		FROM email_settings
+		INNER JOIN users ON email_settings.user_id=users.id
+		WHERE email_settings.verified_at IS NOT NULL AND (
+			(email_settings.digest=? AND (email_settings.digest_sent_at IS NULL OR unixepoch(email_settings.digest_sent_at)<=?))
+			OR (email_settings.digest=? AND (email_settings.digest_sent_at IS NULL OR unixepoch(email_settings.digest_sent_at)<=?))
+		)
+		ORDER BY users.id`
+	rows, err := m.DB.Query(stmt,
+		DigestDaily, now.Add(-24*time.Hour).Unix(),
+		DigestWeekly, now.Add(-7*24*time.Hour).Unix(),
+	)
+	if err != nil {
+		return due, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		settings, err := scanEmailSettings(rows)
+		if err != nil {
+			return due, err
+		}
+		due = append(due, settings)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return due, err
+	}
+	return due, nil
+}
+
+func (m *EmailService) DigestSent(userId int, at time.Time) (err error) {
+	stmt := "UPDATE email_settings SET digest_sent_at=? WHERE user_id=?"
+	_, err = m.DB.Exec(stmt, at.UTC().Format(time.RFC3339), userId)
+	return err
+}
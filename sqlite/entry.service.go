@@ -2,156 +2,905 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"time"
 
 	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+	"github.com/slh335/shoppinglistserver/rank"
 )
 
 type EntryService struct {
 	DB *sql.DB
 }
 
-func (m *EntryService) Get(id int) (entry Entry, err error) {
-	stmt := "SELECT * FROM entries WHERE id=? ORDER BY created_at"
-	row := m.DB.QueryRow(stmt, id)
+const entryColumns = `
+	id, list_id, text, category, note, price, currency, rank, completed,
+	created_at, created_by, updated_at, completed_by, completed_at, deleted_at,
+	quantity, unit`
 
-	var createdAtStr string
-	err = row.Scan(&entry.Id, &entry.ListId, &entry.Text, &entry.Category, &entry.OrderIndex, &entry.Completed, &createdAtStr)
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEntry(row scanner) (entry Entry, err error) {
+	var createdAtStr, updatedAtStr string
+	var price, createdBy, completedBy sql.NullInt64
+	var currency, completedAtStr, deletedAtStr, unit sql.NullString
+	var quantity sql.NullFloat64
+	err = row.Scan(
+		&entry.Id, &entry.ListId, &entry.Text, &entry.Category, &entry.Note, &price, &currency,
+		&entry.Rank, &entry.Completed,
+		&createdAtStr, &createdBy, &updatedAtStr, &completedBy, &completedAtStr, &deletedAtStr,
+		&quantity, &unit,
+	)
 	if err != nil {
 		return entry, err
 	}
+	if price.Valid {
+		entry.Price = &Price{Amount: int(price.Int64), Currency: currency.String}
+	}
+	if quantity.Valid {
+		entry.Quantity = &Quantity{Amount: quantity.Float64, Unit: unit.String}
+	}
+	entry.CreatedBy = int(createdBy.Int64)
+	entry.CompletedBy = int(completedBy.Int64)
 
-	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+	entry.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
 	if err != nil {
 		return entry, err
 	}
-	entry.CreatedAt = createdAt
+	entry.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	if err != nil {
+		return entry, err
+	}
+	if completedAtStr.Valid {
+		completedAt, err := time.Parse(time.RFC3339, completedAtStr.String)
+		if err != nil {
+			return entry, err
+		}
+		entry.CompletedAt = &completedAt
+	}
+	if deletedAtStr.Valid {
+		deletedAt, err := time.Parse(time.RFC3339, deletedAtStr.String)
+		if err != nil {
+			return entry, err
+		}
+		entry.DeletedAt = &deletedAt
+	}
+	return entry, nil
+}
+
+func (m *EntryService) Get(id int) (entry Entry, err error) {
+	stmt := "SELECT" + entryColumns + " FROM entries WHERE id=? AND deleted_at IS NULL"
+	row := m.DB.QueryRow(stmt, id)
 
+	entry, err = scanEntry(row)
+	if err != nil {
+		return entry, err
+	}
+	entry.Attachments, err = entryAttachments(m.DB, id)
+	if err != nil {
+		return entry, err
+	}
 	return entry, nil
 }
 
 func (m *EntryService) All(listId int) (entries []Entry, err error) {
-	stmt := "SELECT * FROM entries WHERE list_id=? ORDER BY category, order_index"
-	rows, err := m.DB.Query(stmt, listId)
+	entries, _, err = m.Query(listId, Filter{})
+	return entries, err
+}
+
+var entrySorts = map[string]sortOrder[Entry]{
+	SortCategory: {
+		{expr: "category", value: func(e Entry) any { return e.Category }},
+		{expr: "rank", value: func(e Entry) any { return e.Rank }},
+		{expr: "id", value: func(e Entry) any { return e.Id }},
+	},
+	SortText: {
+		{expr: "text COLLATE NOCASE", value: func(e Entry) any { return e.Text }},
+		{expr: "id", value: func(e Entry) any { return e.Id }},
+	},
+	SortCreated: {
+		{expr: "unixepoch(created_at)", value: func(e Entry) any { return e.CreatedAt.Unix() }},
+		{expr: "id", value: func(e Entry) any { return e.Id }},
+	},
+	SortUpdated: {
+		{expr: "unixepoch(updated_at)", value: func(e Entry) any { return e.UpdatedAt.Unix() }},
+		{expr: "id", value: func(e Entry) any { return e.Id }},
+	},
+}
+
+// Query returns a page of the entries of a list, sorted by category and rank
+// by default.
+func (m *EntryService) Query(listId int, filter Filter) (entries []Entry, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCategory
+	}
+	order, ok := lookupSort(entrySorts, sortName)
+	if !ok {
+		return entries, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("list_id=?", listId)
+	s.where("deleted_at IS NULL")
+	if filter.Completed != nil {
+		s.where("completed=?", *filter.Completed)
+	}
+	if filter.Category != nil {
+		s.where("category=?", *filter.Category)
+	}
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(created_at)>=?", filter.CreatedSince.Unix())
+	}
+	if filter.CreatedBy != 0 {
+		s.where("created_by=?", filter.CreatedBy)
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
 	if err != nil {
-		return entries, err
+		return entries, "", err
+	}
+
+	stmt := "SELECT" + entryColumns + " FROM entries" + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
+	if err != nil {
+		return entries, "", err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var entry Entry
-		var createdAtStr string
-		err = rows.Scan(&entry.Id, &entry.ListId, &entry.Text, &entry.Category, &entry.OrderIndex, &entry.Completed, &createdAtStr)
-		if err != nil {
-			return entries, err
-		}
-
-		createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+		entry, err := scanEntry(rows)
 		if err != nil {
-			return entries, err
+			return entries, "", err
 		}
-		entry.CreatedAt = createdAt
-
 		entries = append(entries, entry)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return entries, err
+		return entries, "", err
 	}
-	return entries, nil
+	entries, next = page(order, sortName, entries, filter.Limit)
+
+	attachments, err := listAttachments(m.DB, listId)
+	if err != nil {
+		return entries, "", err
+	}
+	for i := range entries {
+		entries[i].Attachments = attachments[entries[i].Id]
+	}
+	return entries, next, nil
 }
 
-func (m *EntryService) Complete(id int, completed bool) (updated bool, err error) {
-	stmt := "UPDATE entries SET completed=? WHERE id=?"
-	res, err := m.DB.Exec(stmt, completed, id)
+// changeEntry applies change to an entry that is not in the trash and records
+// the entry before and after the change in its history. It reports false if
+// the entry does not exist.
+func changeEntry(tx *sql.Tx, userId, id int, action string, change func() error) (changed bool, err error) {
+	stmt := "SELECT" + entryColumns + " FROM entries WHERE id=?"
+	before, err := scanEntry(tx.QueryRow(stmt, id))
+	if err == sql.ErrNoRows || (err == nil && before.DeletedAt != nil && action != ActionRestored) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
-	rowsAffected, _ := res.RowsAffected()
-	return rowsAffected > 0, nil
+	err = change()
+	if err != nil {
+		return false, err
+	}
+
+	stmt = "UPDATE entries SET updated_at=? WHERE id=?"
+	_, err = tx.Exec(stmt, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	stmt = "SELECT" + entryColumns + " FROM entries WHERE id=?"
+	after, err := scanEntry(tx.QueryRow(stmt, id))
+	if err != nil {
+		return false, err
+	}
+
+	return true, recordChange(tx, userId, action, &before, &after)
 }
 
-func (m *EntryService) Move(listId int, category string, oldIndex, newIndex int) (updated bool, err error) {
-	if oldIndex == newIndex {
-		return true, nil
+// recordChange adds a change of an entry to the activity of its list. Moves to
+// another list show up in the activity of both lists.
+func recordChange(tx *sql.Tx, userId int, action string, before, after *Entry) (err error) {
+	var beforeJson sql.NullString
+	sourceListId := sql.NullInt64{}
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		beforeJson = sql.NullString{String: string(data), Valid: true}
+		if before.ListId != after.ListId {
+			sourceListId = sql.NullInt64{Int64: int64(before.ListId), Valid: true}
+		}
+	}
+	afterJson, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO entry_history (entry_id, list_id, source_list_id, user_id, action, before, after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(stmt, after.Id, after.ListId, sourceListId, userId, action, beforeJson, string(afterJson), time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (m *EntryService) Complete(userId, id int, completed bool) (updated bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
 	}
+	defer tx.Rollback()
 
-	var res sql.Result
-	if oldIndex < newIndex {
-		stmt := `UPDATE entries
-			SET order_index = CASE
-				WHEN order_index=? THEN ?
-				WHEN order_index>? AND order_index<? THEN order_index-1
-			END
-			WHERE list_id=? AND category=? AND order_index>=? AND order_index<?`
-		res, err = m.DB.Exec(stmt, oldIndex, newIndex-1, oldIndex, newIndex, listId, category, oldIndex, newIndex)
-	} else {
-		stmt := `UPDATE entries
-			SET order_index = CASE
-				WHEN order_index=? THEN ?
-				WHEN order_index>=? AND order_index<? THEN order_index+1
-			END
-			WHERE list_id=? AND category=? AND order_index>=? AND order_index<=?`
-		res, err = m.DB.Exec(stmt, oldIndex, newIndex, newIndex, oldIndex, listId, category, newIndex, oldIndex)
+	action := ActionCompleted
+	if !completed {
+		action = ActionUncompleted
 	}
+	updated, err = changeEntry(tx, userId, id, action, func() error {
+		return completeEntry(tx, userId, id, completed)
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Reopen uncompletes an entry because it is needed again, like a staple that
+// is due. Unlike uncompleting it with Complete, what the entry added to the
+// pantry when it was completed stays there, as that purchase did happen.
+func (m *EntryService) Reopen(userId, id int) (updated bool, err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return false, err
 	}
+	defer tx.Rollback()
+
+	updated, err = changeEntry(tx, userId, id, ActionUncompleted, func() error {
+		err := keepRestock(tx, id)
+		if err != nil {
+			return err
+		}
+		return completeEntry(tx, userId, id, false)
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// keepRestock forgets that an entry restocked the pantry, so that its stock
+// is not taken back when the entry is uncompleted.
+func keepRestock(tx *sql.Tx, id int) (err error) {
+	_, err = tx.Exec("DELETE FROM pantry_restocks WHERE entry_id=?", id)
+	return err
+}
+
+func priceColumns(price *Price) (amount sql.NullInt64, currency sql.NullString) {
+	if price == nil {
+		return amount, currency
+	}
+	return sql.NullInt64{Int64: int64(price.Amount), Valid: true}, sql.NullString{String: price.Currency, Valid: true}
+}
+
+func quantityColumns(quantity *Quantity) (amount sql.NullFloat64, unit sql.NullString) {
+	if quantity == nil {
+		return amount, unit
+	}
+	return sql.NullFloat64{Float64: quantity.Amount, Valid: true}, sql.NullString{String: quantity.Unit, Valid: true}
+}
+
+func completeEntry(tx *sql.Tx, userId, id int, completed bool) (err error) {
+	var completedBy sql.NullInt64
+	var completedAt sql.NullString
+	if completed {
+		completedBy = sql.NullInt64{Int64: int64(userId), Valid: true}
+		completedAt = sql.NullString{String: time.Now().Format(time.RFC3339), Valid: true}
+	}
+	stmt := "UPDATE entries SET completed=?, completed_by=?, completed_at=? WHERE id=?"
+	_, err = tx.Exec(stmt, completed, completedBy, completedAt, id)
+	return err
+}
+
+// Move places the entry directly after the entry afterId in the target list
+// and category, or at the top of the category if afterId is 0. Only the moved
+// entry is written, unless its neighbours' ranks need to be repaired first.
+func (m *EntryService) Move(userId, id, listId int, category string, afterId int) (entry Entry, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return entry, err
+	}
+	defer tx.Rollback()
+
+	moved, err := changeEntry(tx, userId, id, ActionMoved, func() error {
+		return moveEntry(tx, id, listId, category, afterId)
+	})
+	if err != nil {
+		return entry, err
+	}
+	if !moved {
+		return entry, fmt.Errorf("error: entry %d does not exist", id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return entry, err
+	}
+	return m.Get(id)
+}
+
+// moveEntry ranks the entry between afterId and its successor in the target
+// category. An afterId of -1 appends the entry to the end of the category.
+func moveEntry(tx *sql.Tx, id, listId int, category string, afterId int) (err error) {
+	key, err := rankAfter(tx, id, listId, category, afterId)
+	if err != nil {
+		return err
+	}
 
+	stmt := "UPDATE entries SET list_id=?, category=?, rank=? WHERE id=? AND deleted_at IS NULL"
+	res, err := tx.Exec(stmt, listId, category, key, id)
+	if err != nil {
+		return err
+	}
 	rowsAffected, _ := res.RowsAffected()
-	return rowsAffected > 0, nil
+	if rowsAffected == 0 {
+		return fmt.Errorf("error: entry %d does not exist", id)
+	}
+	return nil
+}
+
+func rankAfter(tx *sql.Tx, id, listId int, category string, afterId int) (key string, err error) {
+	var prev, next string
+	var duplicates int
+	for attempt := 0; attempt < 2; attempt++ {
+		prev, next, duplicates = "", "", 0
+		switch afterId {
+		case -1:
+			stmt := "SELECT IFNULL(MAX(rank), '') FROM entries WHERE list_id=? AND category=? AND id!=? AND deleted_at IS NULL"
+			err = tx.QueryRow(stmt, listId, category, id).Scan(&prev)
+		case 0:
+			stmt := "SELECT IFNULL(MIN(rank), '') FROM entries WHERE list_id=? AND category=? AND id!=? AND deleted_at IS NULL"
+			err = tx.QueryRow(stmt, listId, category, id).Scan(&next)
+		default:
+			stmt := "SELECT rank FROM entries WHERE id=? AND list_id=? AND category=? AND deleted_at IS NULL"
+			err = tx.QueryRow(stmt, afterId, listId, category).Scan(&prev)
+			if err == sql.ErrNoRows {
+				return "", fmt.Errorf("error: entry %d is not in category '%s' of list %d", afterId, category, listId)
+			}
+			if err != nil {
+				return "", err
+			}
+			stmt = "SELECT IFNULL(MIN(rank), '') FROM entries WHERE list_id=? AND category=? AND id!=? AND rank>? AND deleted_at IS NULL"
+			err = tx.QueryRow(stmt, listId, category, id, prev).Scan(&next)
+			if err != nil {
+				return "", err
+			}
+			stmt = "SELECT COUNT(*) FROM entries WHERE list_id=? AND category=? AND rank=? AND id NOT IN (?, ?) AND deleted_at IS NULL"
+			err = tx.QueryRow(stmt, listId, category, prev, id, afterId).Scan(&duplicates)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// duplicate or empty keys leave no room in between, so the list is
+		// repaired once before trying again
+		if rank.Valid(prev, next) && duplicates == 0 && (afterId <= 0 || prev != "") {
+			return rank.Between(prev, next), nil
+		}
+		err = rerank(tx, listId, "rank, id")
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("error: failed to rank entry %d", id)
+}
+
+// Rerank repairs the ordering of a list by giving all entries fresh, evenly
+// spaced rank keys while keeping their current order.
+func (m *EntryService) Rerank(listId int) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = rerank(tx, listId, "rank, id")
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *EntryService) Add(listId int, text, category string) (entry Entry, err error) {
-	createdAt := time.Now()
-	stmt := `INSERT INTO entries (list_id, text, category, order_index, created_at)
-		VALUES (?, ?, ?, (SELECT IFNULL(MAX(order_index), -1) + 1 FROM entries WHERE list_id=? AND category=?), ?)`
-	res, err := m.DB.Exec(stmt, listId, text, category, listId, category, createdAt.Format(time.RFC3339))
+// rerank assigns evenly spaced rank keys to all entries of a list, category by
+// category, in the given order. Entries in the trash are ranked as well, so
+// that they return to their place when restored, and so that migrateEntryRanks,
+// which runs before the trash exists, can use it.
+func rerank(tx *sql.Tx, listId int, order string) (err error) {
+	stmt := "SELECT id, category FROM entries WHERE list_id=? ORDER BY category, " + order
+	rows, err := tx.Query(stmt, listId)
+	if err != nil {
+		return err
+	}
+	categories := map[string][]int{}
+	for rows.Next() {
+		var id int
+		var category string
+		err = rows.Scan(&id, &category)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		categories[category] = append(categories[category], id)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, ids := range categories {
+		keys := rank.Spread(len(ids))
+		for i, id := range ids {
+			_, err = tx.Exec("UPDATE entries SET rank=? WHERE id=?", keys[i], id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *EntryService) Add(userId, listId int, text, category, note string, price *Price, quantity *Quantity) (entry Entry, err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return entry, err
 	}
-	lastInsertId, _ := res.LastInsertId()
+	defer tx.Rollback()
 
-	stmt = "SELECT IFNULL(MAX(order_index), 0) FROM entries WHERE list_id=? AND category=?"
-	row := m.DB.QueryRow(stmt, listId, category)
-	var orderIndex int
-	err = row.Scan(&orderIndex)
+	key, err := rankAfter(tx, 0, listId, category, -1)
 	if err != nil {
 		return entry, err
 	}
 
-	entry = Entry{
-		Id:         int(lastInsertId),
-		ListId:     listId,
-		Text:       text,
-		Category:   category,
-		OrderIndex: orderIndex,
-		Completed:  false,
-		CreatedAt:  createdAt,
+	entry, err = insertEntry(tx, userId, Entry{
+		ListId:   listId,
+		Text:     text,
+		Category: category,
+		Note:     note,
+		Price:    price,
+		Quantity: quantity,
+		Rank:     key,
+	})
+	if err != nil {
+		return entry, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return entry, err
 	}
 	return entry, nil
 }
 
-func (m *EntryService) Update(id int, text, category string) (updated bool, err error) {
-	stmt := "UPDATE entries SET text=?, category=? WHERE id=?"
-	res, err := m.DB.Exec(stmt, text, category, id)
+// AddMany adds entries to the end of their categories of a list, all or none
+// of them. Only the text, category, note, price and quantity of the entries
+// are used.
+func (m *EntryService) AddMany(userId, listId int, entries []Entry) (added []Entry, err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
-		return false, err
+		return added, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := res.RowsAffected()
-	return rowsAffected > 0, nil
+	for _, entry := range entries {
+		entry.ListId = listId
+		entry.Rank, err = rankAfter(tx, 0, listId, entry.Category, -1)
+		if err != nil {
+			return added, err
+		}
+		entry, err = insertEntry(tx, userId, entry)
+		if err != nil {
+			return added, err
+		}
+		added = append(added, entry)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return added, err
+	}
+	return added, nil
+}
+
+// Merge adds entries to a list like AddMany, unless the list has an entry with
+// the same text already. The quantity of such an entry is increased by the
+// quantity of the merged one, or replaced by it if the entry was completed,
+// which reopens it like Reopen. Entries whose units cannot be added to the
+// quantity of any entry with the same text are added on their own. Entries
+// changed by a merge are returned as updated, and the ids of those it reopened
+// as reopened.
+func (m *EntryService) Merge(userId, listId int, entries []Entry) (added, updated []Entry, reopened []int, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return added, updated, reopened, err
+	}
+	defer tx.Rollback()
+
+	var changed []int
+	for _, entry := range entries {
+		stmt := "SELECT" + entryColumns + `
+			FROM entries
+			WHERE list_id=? AND text=? COLLATE NOCASE AND deleted_at IS NULL
+			ORDER BY completed, id`
+		candidates, err := queryEntries(tx, stmt, listId, entry.Text)
+		if err != nil {
+			return added, updated, reopened, err
+		}
+
+		// the entry is merged into the first entry with the same text whose
+		// quantity can take it, and added on its own if there is none
+		var existing *Entry
+		var quantity *Quantity
+		matched := false
+		for i, candidate := range candidates {
+			quantity = candidate.Quantity
+			switch {
+			case candidate.Completed || (quantity == nil && entry.Quantity != nil):
+				quantity = entry.Quantity
+				existing = &candidates[i]
+			case quantity != nil && entry.Quantity != nil:
+				sum, ok := quantity.Add(*entry.Quantity)
+				if !ok {
+					continue
+				}
+				quantity = &sum
+				existing = &candidates[i]
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			entry.ListId = listId
+			entry.Rank, err = rankAfter(tx, 0, listId, entry.Category, -1)
+			if err != nil {
+				return added, updated, reopened, err
+			}
+			entry, err = insertEntry(tx, userId, entry)
+			if err != nil {
+				return added, updated, reopened, err
+			}
+			added = append(added, entry)
+			continue
+		}
+		if existing == nil {
+			continue
+		}
+
+		action := ActionEdited
+		if existing.Completed {
+			action = ActionUncompleted
+		}
+		_, err = changeEntry(tx, userId, existing.Id, action, func() error {
+			amount, unit := quantityColumns(quantity)
+			_, err := tx.Exec("UPDATE entries SET quantity=?, unit=? WHERE id=?", amount, unit, existing.Id)
+			if err != nil || !existing.Completed {
+				return err
+			}
+			err = keepRestock(tx, existing.Id)
+			if err != nil {
+				return err
+			}
+			return completeEntry(tx, userId, existing.Id, false)
+		})
+		if err != nil {
+			return added, updated, reopened, err
+		}
+		if !slices.Contains(changed, existing.Id) {
+			changed = append(changed, existing.Id)
+		}
+		if existing.Completed && !slices.Contains(reopened, existing.Id) {
+			reopened = append(reopened, existing.Id)
+		}
+	}
+
+	// entries added by the merge are returned as added, with the quantities
+	// merged into them
+	stmt := "SELECT" + entryColumns + " FROM entries WHERE id=?"
+	for i, entry := range added {
+		added[i], err = scanEntry(tx.QueryRow(stmt, entry.Id))
+		if err != nil {
+			return added, updated, reopened, err
+		}
+		changed = slices.DeleteFunc(changed, func(id int) bool { return id == entry.Id })
+	}
+	for _, id := range changed {
+		entry, err := scanEntry(tx.QueryRow(stmt, id))
+		if err != nil {
+			return added, updated, reopened, err
+		}
+		updated = append(updated, entry)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return added, updated, reopened, err
+	}
+	return added, updated, reopened, nil
 }
 
-func (m *EntryService) Delete(id int) (deleted bool, err error) {
-	stmt := "DELETE FROM entries WHERE id=?"
-	res, err := m.DB.Exec(stmt, id)
+// insertEntry creates an uncompleted entry with the list, text, category,
+// note, price, quantity and rank of entry and records its creation.
+func insertEntry(tx *sql.Tx, userId int, entry Entry) (Entry, error) {
+	createdAt := time.Now().Format(time.RFC3339)
+	amount, currency := priceColumns(entry.Price)
+	quantity, unit := quantityColumns(entry.Quantity)
+	stmt := `
+		INSERT INTO entries (list_id, text, category, note, price, currency, quantity, unit, rank, created_at, created_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.Exec(stmt, entry.ListId, entry.Text, entry.Category, entry.Note, amount, currency, quantity, unit,
+		entry.Rank, createdAt, userId, createdAt)
+	if err != nil {
+		return entry, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+
+	stmt = "SELECT" + entryColumns + " FROM entries WHERE id=?"
+	entry, err = scanEntry(tx.QueryRow(stmt, lastInsertId))
+	if err != nil {
+		return entry, err
+	}
+	err = recordChange(tx, userId, ActionCreated, nil, &entry)
+	if err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+func (m *EntryService) Update(userId, id int, text, category, note string, price *Price, quantity *Quantity) (updated bool, err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return false, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := res.RowsAffected()
-	return rowsAffected > 0, nil
+	updated, err = changeEntry(tx, userId, id, ActionEdited, func() error {
+		var listId int
+		var oldCategory string
+		stmt := "SELECT list_id, category FROM entries WHERE id=?"
+		err := tx.QueryRow(stmt, id).Scan(&listId, &oldCategory)
+		if err != nil {
+			return err
+		}
+
+		if category != oldCategory {
+			err = moveEntry(tx, id, listId, category, -1)
+			if err != nil {
+				return err
+			}
+		}
+
+		amount, currency := priceColumns(price)
+		quantityAmount, unit := quantityColumns(quantity)
+		stmt = "UPDATE entries SET text=?, note=?, price=?, currency=?, quantity=?, unit=? WHERE id=?"
+		_, err = tx.Exec(stmt, text, note, amount, currency, quantityAmount, unit, id)
+		return err
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Delete moves an entry to the trash of its list. The returned token can be
+// used to undo the deletion until the trash is purged.
+func (m *EntryService) Delete(userId, id int) (deleted bool, token string, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, "", err
+	}
+	defer tx.Rollback()
+
+	token = crypto.GenerateToken(32)
+	deleted, err = changeEntry(tx, userId, id, ActionDeleted, func() error {
+		return deleteEntry(tx, id, token)
+	})
+	if err != nil || !deleted {
+		return false, "", err
+	}
+	return true, token, tx.Commit()
+}
+
+func deleteEntry(tx *sql.Tx, id int, token string) (err error) {
+	stmt := "UPDATE entries SET deleted_at=?, deletion_token=? WHERE id=?"
+	_, err = tx.Exec(stmt, time.Now().UTC().Format(time.RFC3339), token, id)
+	return err
+}
+
+// ClearCompleted moves all completed entries of a list to the trash.
+func (m *EntryService) ClearCompleted(userId, listId int) (ids []int, token string, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return ids, "", err
+	}
+	defer tx.Rollback()
+
+	stmt := "SELECT id FROM entries WHERE list_id=? AND completed=TRUE AND deleted_at IS NULL"
+	ids, err = queryIds(tx, stmt, listId)
+	if err != nil {
+		return ids, "", err
+	}
+
+	token = crypto.GenerateToken(32)
+	for _, id := range ids {
+		_, err = changeEntry(tx, userId, id, ActionDeleted, func() error {
+			return deleteEntry(tx, id, token)
+		})
+		if err != nil {
+			return ids, "", err
+		}
+	}
+	return ids, token, tx.Commit()
+}
+
+// CompleteAll marks all entries of a list, or of one of its categories if
+// category is not empty, as completed or uncompleted.
+func (m *EntryService) CompleteAll(userId, listId int, category string, completed bool) (ids []int, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return ids, err
+	}
+	defer tx.Rollback()
+
+	stmt := "SELECT id FROM entries WHERE list_id=? AND completed!=? AND (?='' OR category=?) AND deleted_at IS NULL"
+	ids, err = queryIds(tx, stmt, listId, completed, category, category)
+	if err != nil {
+		return ids, err
+	}
+
+	action := ActionCompleted
+	if !completed {
+		action = ActionUncompleted
+	}
+	for _, id := range ids {
+		_, err = changeEntry(tx, userId, id, action, func() error {
+			return completeEntry(tx, userId, id, completed)
+		})
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// DeleteMany moves the given entries of a list to the trash. Either all of
+// them are deleted or none, if any of the entries is not part of the list.
+func (m *EntryService) DeleteMany(userId, listId int, ids []int) (token string, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	err = requireEntries(tx, listId, ids)
+	if err != nil {
+		return "", err
+	}
+
+	token = crypto.GenerateToken(32)
+	for _, id := range ids {
+		_, err = changeEntry(tx, userId, id, ActionDeleted, func() error {
+			return deleteEntry(tx, id, token)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return token, tx.Commit()
+}
+
+// MoveMany moves the given entries of a list after the entry afterId in the
+// target list and category, keeping the order in which the ids are given.
+func (m *EntryService) MoveMany(userId, listId int, ids []int, targetListId int, category string, afterId int) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireEntries(tx, listId, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err = changeEntry(tx, userId, id, ActionMoved, func() error {
+			return moveEntry(tx, id, targetListId, category, afterId)
+		})
+		if err != nil {
+			return err
+		}
+		afterId = id
+	}
+	return tx.Commit()
+}
+
+// requireEntries fails unless all given entries are part of the list and not
+// in its trash.
+func requireEntries(tx *sql.Tx, listId int, ids []int) (err error) {
+	for _, id := range ids {
+		var member bool
+		stmt := "SELECT EXISTS(SELECT 1 FROM entries WHERE id=? AND list_id=? AND deleted_at IS NULL)"
+		err = tx.QueryRow(stmt, id, listId).Scan(&member)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return fmt.Errorf("error: entry %d is not part of list %d", id, listId)
+		}
+	}
+	return nil
+}
+
+func queryIds(tx *sql.Tx, stmt string, args ...any) (ids []int, err error) {
+	rows, err := tx.Query(stmt, args...)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func queryEntries(tx *sql.Tx, stmt string, args ...any) (entries []Entry, err error) {
+	rows, err := tx.Query(stmt, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Find returns the entry of a list with the given text, ignoring case. found
+// is false if the list has no such entry.
+func (m *EntryService) Find(listId int, text string) (entry Entry, found bool, err error) {
+	stmt := "SELECT" + entryColumns + `
+		FROM entries
+		WHERE list_id=? AND text=? COLLATE NOCASE AND deleted_at IS NULL
+		ORDER BY completed, id
+		LIMIT 1`
+	row := m.DB.QueryRow(stmt, listId, text)
+
+	entry, err = scanEntry(row)
+	if err == sql.ErrNoRows {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	return entry, true, nil
 }
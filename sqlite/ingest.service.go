@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+// ErrDuplicateAlias is returned when adding an alias for a sender that has a
+// confirmed one already, or one of the same user waiting for confirmation.
+var ErrDuplicateAlias = errors.New("error: sender already has an alias")
+
+type IngestService struct {
+	DB *sql.DB
+}
+
+const ingestAliasColumns = `
+	ingest_aliases.id, ingest_aliases.user_id, ingest_aliases.sender, lists.id, lists.name,
+	ingest_aliases.code, ingest_aliases.confirmed_at, ingest_aliases.created_at`
+
+const ingestAliasTables = `
+	FROM ingest_aliases
+	INNER JOIN lists ON ingest_aliases.list_id=lists.id`
+
+func scanIngestAlias(row scanner) (alias IngestAlias, err error) {
+	var code, confirmedAt sql.NullString
+	var createdAtStr string
+	err = row.Scan(
+		&alias.Id, &alias.UserId, &alias.Sender, &alias.List.Id, &alias.List.Name,
+		&code, &confirmedAt, &createdAtStr,
+	)
+	if err != nil {
+		return alias, err
+	}
+	alias.Code = code.String
+	alias.Confirmed = confirmedAt.Valid
+	alias.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return alias, err
+	}
+	return alias, nil
+}
+
+func (m *IngestService) Get(id int) (alias IngestAlias, err error) {
+	stmt := "SELECT" + ingestAliasColumns + ingestAliasTables + " WHERE ingest_aliases.id=?"
+	return scanIngestAlias(m.DB.QueryRow(stmt, id))
+}
+
+// Lookup returns the confirmed alias of a sender. Senders are compared
+// ignoring case, and aliases of deleted lists are ignored.
+func (m *IngestService) Lookup(sender string) (alias IngestAlias, err error) {
+	stmt := "SELECT" + ingestAliasColumns + ingestAliasTables + `
+		WHERE ingest_aliases.sender=? AND ingest_aliases.confirmed_at IS NOT NULL AND lists.deleted_at IS NULL`
+	return scanIngestAlias(m.DB.QueryRow(stmt, strings.ToLower(sender)))
+}
+
+func (m *IngestService) All(userId int) (aliases []IngestAlias, err error) {
+	stmt := "SELECT" + ingestAliasColumns + ingestAliasTables + " WHERE ingest_aliases.user_id=? ORDER BY ingest_aliases.id"
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return aliases, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		alias, err := scanIngestAlias(rows)
+		if err != nil {
+			return aliases, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return aliases, err
+	}
+	return aliases, nil
+}
+
+// Add maps a sender to a user and list. The alias waits for confirmation
+// until the sender sends back its code, see Confirm. Every sender can only
+// have one confirmed alias.
+func (m *IngestService) Add(userId, listId int, sender string) (alias IngestAlias, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return alias, err
+	}
+	defer tx.Rollback()
+
+	sender = strings.ToLower(sender)
+	var taken bool
+	stmt := "SELECT EXISTS(SELECT 1 FROM ingest_aliases WHERE sender=? AND (confirmed_at IS NOT NULL OR user_id=?))"
+	err = tx.QueryRow(stmt, sender, userId).Scan(&taken)
+	if err != nil {
+		return alias, err
+	}
+	if taken {
+		return alias, ErrDuplicateAlias
+	}
+
+	stmt = "INSERT INTO ingest_aliases (user_id, list_id, sender, code, created_at) VALUES (?, ?, ?, ?, ?)"
+	res, err := tx.Exec(stmt, userId, listId, sender, crypto.GenerateToken(6), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return alias, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return alias, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+	return m.Get(int(lastInsertId))
+}
+
+// Confirm confirms the alias of a sender whose code is contained in text, and
+// deletes the other aliases of the sender that wait for confirmation. It
+// returns sql.ErrNoRows if text contains no code of the sender.
+func (m *IngestService) Confirm(sender, text string) (alias IngestAlias, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return alias, err
+	}
+	defer tx.Rollback()
+
+	sender = strings.ToLower(sender)
+	stmt := "SELECT id, code FROM ingest_aliases WHERE sender=? AND confirmed_at IS NULL ORDER BY id"
+	rows, err := tx.Query(stmt, sender)
+	if err != nil {
+		return alias, err
+	}
+	id := 0
+	for rows.Next() {
+		var candidate int
+		var code string
+		err = rows.Scan(&candidate, &code)
+		if err != nil {
+			rows.Close()
+			return alias, err
+		}
+		if id == 0 && code != "" && strings.Contains(text, code) {
+			id = candidate
+		}
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return alias, err
+	}
+	if id == 0 {
+		return alias, sql.ErrNoRows
+	}
+
+	stmt = "UPDATE ingest_aliases SET code=NULL, confirmed_at=? WHERE id=?"
+	_, err = tx.Exec(stmt, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return alias, err
+	}
+	_, err = tx.Exec("DELETE FROM ingest_aliases WHERE sender=? AND confirmed_at IS NULL", sender)
+	if err != nil {
+		return alias, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return alias, err
+	}
+	return m.Get(id)
+}
+
+func (m *IngestService) Delete(id int) (deleted bool, err error) {
+	res, err := m.DB.Exec("DELETE FROM ingest_aliases WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
@@ -2,7 +2,8 @@ package sqlite
 
 import (
 	"database/sql"
-	"fmt"
+	"errors"
+	"time"
 
 	. "github.com/slh335/shoppinglistserver"
 	"github.com/slh335/shoppinglistserver/crypto"
@@ -12,82 +13,264 @@ type InvitationService struct {
 	DB *sql.DB
 }
 
-func (m *InvitationService) GetInvitation(token string) (invitation Invitation, err error) {
-	stmt := `
-		SELECT invitations.token, inviter.id, inviter.username, invitee.id, invitee.username, lists.id, lists.name
-		FROM invitations
-		INNER JOIN users inviter ON invitations.inviter_id=inviter.id
-		INNER JOIN users invitee ON invitations.invitee_id=invitee.id
-		INNER JOIN lists ON invitations.list_id=lists.id
-		WHERE invitations.token=?`
-	row := m.DB.QueryRow(stmt, token)
+var (
+	// ErrDuplicateInvitation is returned when inviting a user to a list they
+	// already have a pending invitation to.
+	ErrDuplicateInvitation = errors.New("error: user already has a pending invitation to the list")
+	// ErrInvitationNotPending is returned when responding to an invitation
+	// that has already been responded to, revoked or has expired.
+	ErrInvitationNotPending = errors.New("error: invitation is no longer pending")
+)
+
+// invitationStatus is the status of an invitation, taking into account that
+// pending invitations expire before Expire gets to them.
+const invitationStatus = `
+	CASE WHEN invitations.status='pending' AND invitations.expires_at<=strftime('%Y-%m-%dT%H:%M:%SZ', 'now')
+	THEN 'expired' ELSE invitations.status END`
+
+const invitationColumns = `
+	invitations.token, inviter.id, inviter.username, invitee.id, invitee.username,
+	lists.id, lists.name, ` + invitationStatus + `,
+	invitations.created_at, invitations.expires_at, invitations.responded_at`
 
+const invitationTables = `
+	FROM invitations
+	INNER JOIN users inviter ON invitations.inviter_id=inviter.id
+	INNER JOIN users invitee ON invitations.invitee_id=invitee.id
+	INNER JOIN lists ON invitations.list_id=lists.id`
+
+func scanInvitation(row scanner) (invitation Invitation, err error) {
+	var createdAtStr, expiresAtStr string
+	var respondedAtStr sql.NullString
 	err = row.Scan(
 		&invitation.Token,
 		&invitation.Inviter.Id, &invitation.Inviter.Username,
 		&invitation.Invitee.Id, &invitation.Invitee.Username,
-		&invitation.List.Id, &invitation.List.Name,
+		&invitation.List.Id, &invitation.List.Name, &invitation.Status,
+		&createdAtStr, &expiresAtStr, &respondedAtStr,
 	)
 	if err != nil {
 		return invitation, err
 	}
+	invitation.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return invitation, err
+	}
+	invitation.ExpiresAt, err = time.Parse(time.RFC3339, expiresAtStr)
+	if err != nil {
+		return invitation, err
+	}
+	if respondedAtStr.Valid {
+		respondedAt, err := time.Parse(time.RFC3339, respondedAtStr.String)
+		if err != nil {
+			return invitation, err
+		}
+		invitation.RespondedAt = &respondedAt
+	}
 	return invitation, nil
 }
 
+func (m *InvitationService) GetInvitation(token string) (invitation Invitation, err error) {
+	stmt := "SELECT" + invitationColumns + invitationTables + " WHERE invitations.token=?"
+	row := m.DB.QueryRow(stmt, token)
+
+	return scanInvitation(row)
+}
+
 func (m *InvitationService) GetInvitations(userId int) (invitations []Invitation, err error) {
-	stmt := `
-		SELECT invitations.token, inviter.id, inviter.username, invitee.id, invitee.username, lists.id, lists.name
-		FROM invitations
-		INNER JOIN users inviter ON invitations.inviter_id=inviter.id
-		INNER JOIN users invitee ON invitations.invitee_id=invitee.id
-		INNER JOIN lists ON invitations.list_id=lists.id
-		WHERE inviter.id=? OR invitee.id=?`
-	rows, err := m.DB.Query(stmt, userId, userId)
+	invitations, _, err = m.Query(userId, Filter{})
+	return invitations, err
+}
+
+var invitationSorts = map[string]sortOrder[Invitation]{
+	SortCreated: {
+		{expr: "unixepoch(invitations.created_at)", value: func(i Invitation) any { return i.CreatedAt.Unix() }},
+		{expr: "invitations.token", value: func(i Invitation) any { return i.Token }},
+	},
+	SortName: {
+		{expr: "lists.name COLLATE NOCASE", value: func(i Invitation) any { return i.List.Name }},
+		{expr: "invitations.token", value: func(i Invitation) any { return i.Token }},
+	},
+}
+
+// Query returns a page of the invitations a user has sent or received, sorted
+// by creation by default. The sort order SortName sorts by list name, and
+// CreatedBy filters by inviter. Only the Status, CreatedSince and CreatedBy
+// filters apply to invitations.
+func (m *InvitationService) Query(userId int, filter Filter) (invitations []Invitation, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCreated
+	}
+	order, ok := lookupSort(invitationSorts, sortName)
+	if !ok {
+		return invitations, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("(inviter.id=? OR invitee.id=?)", userId, userId)
+	if filter.Status != "" {
+		s.where(invitationStatus+"=?", filter.Status)
+	}
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(invitations.created_at)>=?", filter.CreatedSince.Unix())
+	}
+	if filter.CreatedBy != 0 {
+		s.where("inviter.id=?", filter.CreatedBy)
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
 	if err != nil {
-		return []Invitation{}, err
+		return invitations, "", err
+	}
+
+	stmt := "SELECT" + invitationColumns + invitationTables + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
+	if err != nil {
+		return []Invitation{}, "", err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var invitation Invitation
-		err = rows.Scan(
-			&invitation.Token,
-			&invitation.Inviter.Id, &invitation.Inviter.Username,
-			&invitation.Invitee.Id, &invitation.Invitee.Username,
-			&invitation.List.Id, &invitation.List.Name,
-		)
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return invitations, "", err
+		}
 		invitations = append(invitations, invitation)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return invitations, err
+		return invitations, "", err
 	}
-	return invitations, nil
+	invitations, next = page(order, sortName, invitations, filter.Limit)
+	return invitations, next, nil
 }
 
-func (m *InvitationService) AddInvitation(inviterId, inviteeId, listId int) (Invitation, error) {
-	token := crypto.GenerateToken(64)
+// AddInvitation invites a user to a list until expiresAt, unless they have a
+// pending invitation to it already.
+func (m *InvitationService) AddInvitation(inviterId, inviteeId, listId int, expiresAt time.Time) (invitation Invitation, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return invitation, err
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	stmt := `
+		SELECT EXISTS(
+			SELECT 1 FROM invitations WHERE invitee_id=? AND list_id=? AND ` + invitationStatus + `='pending'
+		)`
+	err = tx.QueryRow(stmt, inviteeId, listId).Scan(&pending)
+	if err != nil {
+		return invitation, err
+	}
+	if pending {
+		return invitation, ErrDuplicateInvitation
+	}
 
-	stmt := "INSERT INTO invitations (token, inviter_id, invitee_id, list_id) VALUES (?, ?, ?, ?)"
-	_, err := m.DB.Exec(stmt, token, inviterId, inviteeId, listId)
+	token := crypto.GenerateToken(64)
+	stmt = `
+		INSERT INTO invitations (token, inviter_id, invitee_id, list_id, status, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(stmt, token, inviterId, inviteeId, listId, InvitationPending,
+		time.Now().UTC().Format(time.RFC3339), expiresAt.UTC().Format(time.RFC3339))
 	if err != nil {
-		return Invitation{}, err
+		return invitation, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return invitation, err
+	}
 	return m.GetInvitation(token)
 }
 
-func (m *InvitationService) DeleteInvitation(token string) error {
-	stmt := "DELETE FROM invitations WHERE token=?"
-	res, err := m.DB.Exec(stmt, token)
+// Accept adds the invitee to the list of a pending invitation as an editor.
+// joined is false if the invitee had joined the list in another way in the
+// meantime. Invitations to deleted lists stay pending and fail with
+// ErrListDeleted, so that they can be accepted once the list is restored.
+func (m *InvitationService) Accept(token string) (joined bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	stmt := `
+		SELECT lists.deleted_at IS NOT NULL
+		FROM invitations
+		INNER JOIN lists ON invitations.list_id=lists.id
+		WHERE invitations.token=?`
+	err = tx.QueryRow(stmt, token).Scan(&deleted)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		return false, ErrListDeleted
+	}
+
+	err = respond(tx, token, InvitationAccepted)
+	if err != nil {
+		return false, err
+	}
+	stmt = `
+		INSERT OR IGNORE INTO list_members (list_id, user_id, role, joined_at)
+		SELECT list_id, invitee_id, ?, ? FROM invitations WHERE token=?`
+	res, err := tx.Exec(stmt, RoleEditor, time.Now().UTC().Format(time.RFC3339), token)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, tx.Commit()
+}
+
+func (m *InvitationService) Decline(token string) (err error) {
+	return m.respondTo(token, InvitationDeclined)
+}
+
+func (m *InvitationService) Revoke(token string) (err error) {
+	return m.respondTo(token, InvitationRevoked)
+}
+
+func (m *InvitationService) respondTo(token, status string) (err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	err = respond(tx, token, status)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// respond moves a pending invitation into status, and fails with
+// ErrInvitationNotPending if it is not pending anymore.
+func respond(tx *sql.Tx, token, status string) (err error) {
+	stmt := "UPDATE invitations SET status=?, responded_at=? WHERE token=? AND " + invitationStatus + "='pending'"
+	res, err := tx.Exec(stmt, status, time.Now().UTC().Format(time.RFC3339), token)
+	if err != nil {
+		return err
+	}
+
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("error: failed to delete invitation")
+		return ErrInvitationNotPending
 	}
-
 	return nil
 }
+
+// Expire marks the pending invitations that have expired at now as expired.
+func (m *InvitationService) Expire(now time.Time) (expired int, err error) {
+	stmt := "UPDATE invitations SET status=? WHERE status=? AND expires_at<=?"
+	res, err := m.DB.Exec(stmt, InvitationExpired, InvitationPending, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return int(rowsAffected), nil
+}
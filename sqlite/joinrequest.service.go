@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+var (
+	// ErrDuplicateJoinRequest is returned when asking to join a list while an
+	// earlier request to join it is still pending.
+	ErrDuplicateJoinRequest = errors.New("error: user has already asked to join the list")
+	// ErrJoinRequestNotPending is returned when responding to a join request
+	// that has already been approved or rejected.
+	ErrJoinRequestNotPending = errors.New("error: join request is no longer pending")
+)
+
+type JoinRequestService struct {
+	DB *sql.DB
+}
+
+const joinRequestColumns = `
+	join_requests.id, lists.id, lists.name, users.id, users.username, join_requests.message,
+	join_requests.status, responders.id, responders.username, join_requests.created_at,
+	join_requests.responded_at`
+
+const joinRequestTables = `
+	FROM join_requests
+	INNER JOIN lists ON join_requests.list_id=lists.id
+	INNER JOIN users ON join_requests.user_id=users.id
+	LEFT JOIN users AS responders ON join_requests.responder_id=responders.id`
+
+func scanJoinRequest(row scanner) (request JoinRequest, err error) {
+	var responderId sql.NullInt64
+	var responderUsername, respondedAtStr sql.NullString
+	var createdAtStr string
+	err = row.Scan(
+		&request.Id, &request.List.Id, &request.List.Name, &request.User.Id, &request.User.Username,
+		&request.Message, &request.Status, &responderId, &responderUsername, &createdAtStr,
+		&respondedAtStr,
+	)
+	if err != nil {
+		return request, err
+	}
+
+	request.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return request, err
+	}
+	if responderId.Valid {
+		request.Responder = &User{Id: int(responderId.Int64), Username: responderUsername.String}
+	}
+	if respondedAtStr.Valid {
+		respondedAt, err := time.Parse(time.RFC3339, respondedAtStr.String)
+		if err != nil {
+			return request, err
+		}
+		request.RespondedAt = &respondedAt
+	}
+	return request, nil
+}
+
+func (m *JoinRequestService) Get(id int) (request JoinRequest, err error) {
+	stmt := "SELECT" + joinRequestColumns + joinRequestTables + " WHERE join_requests.id=?"
+	return scanJoinRequest(m.DB.QueryRow(stmt, id))
+}
+
+// Pending returns the pending requests to join a list, oldest first.
+func (m *JoinRequestService) Pending(listId int) (requests []JoinRequest, err error) {
+	stmt := "SELECT" + joinRequestColumns + joinRequestTables + `
+		WHERE join_requests.list_id=? AND join_requests.status=?
+		ORDER BY join_requests.created_at, join_requests.id`
+	return m.query(stmt, listId, JoinRequestPending)
+}
+
+// Sent returns the requests a user has made to join lists that have not been
+// deleted, newest first, so that they learn whether they were approved.
+func (m *JoinRequestService) Sent(userId int) (requests []JoinRequest, err error) {
+	stmt := "SELECT" + joinRequestColumns + joinRequestTables + `
+		WHERE join_requests.user_id=? AND lists.deleted_at IS NULL
+		ORDER BY join_requests.created_at DESC, join_requests.id DESC`
+	return m.query(stmt, userId)
+}
+
+func (m *JoinRequestService) query(stmt string, args ...any) (requests []JoinRequest, err error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return requests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		request, err := scanJoinRequest(rows)
+		if err != nil {
+			return requests, err
+		}
+		requests = append(requests, request)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return requests, err
+	}
+	return requests, nil
+}
+
+// Add asks for a user to join a list, unless they are a member already or
+// have asked before and are still waiting for an answer.
+func (m *JoinRequestService) Add(userId, listId int, message string) (request JoinRequest, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return request, err
+	}
+	defer tx.Rollback()
+
+	var member, pending bool
+	stmt := `
+		SELECT
+			EXISTS(SELECT 1 FROM list_members WHERE list_id=? AND user_id=?),
+			EXISTS(SELECT 1 FROM join_requests WHERE list_id=? AND user_id=? AND status=?)`
+	err = tx.QueryRow(stmt, listId, userId, listId, userId, JoinRequestPending).Scan(&member, &pending)
+	if err != nil {
+		return request, err
+	}
+	if member {
+		return request, ErrAlreadyMember
+	}
+	if pending {
+		return request, ErrDuplicateJoinRequest
+	}
+
+	stmt = `
+		INSERT INTO join_requests (list_id, user_id, message, status, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+	res, err := tx.Exec(stmt, listId, userId, message, JoinRequestPending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return request, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return request, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return request, err
+	}
+	return m.Get(int(id))
+}
+
+// Approve adds the user of a pending join request to its list with the given
+// role. joined is false if the user had joined the list in another way in the
+// meantime. Join requests to deleted lists stay pending and fail with
+// ErrListDeleted.
+func (m *JoinRequestService) Approve(id, responderId int, role string) (joined bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	stmt := `
+		SELECT lists.deleted_at IS NOT NULL
+		FROM join_requests
+		INNER JOIN lists ON join_requests.list_id=lists.id
+		WHERE join_requests.id=?`
+	err = tx.QueryRow(stmt, id).Scan(&deleted)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		return false, ErrListDeleted
+	}
+
+	err = respondToJoinRequest(tx, id, responderId, JoinRequestApproved)
+	if err != nil {
+		return false, err
+	}
+	stmt = `
+		INSERT OR IGNORE INTO list_members (list_id, user_id, role, joined_at)
+		SELECT list_id, user_id, ?, ? FROM join_requests WHERE id=?`
+	res, err := tx.Exec(stmt, role, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, tx.Commit()
+}
+
+func (m *JoinRequestService) Reject(id, responderId int) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = respondToJoinRequest(tx, id, responderId, JoinRequestRejected)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// respondToJoinRequest moves a pending join request into status, and fails
+// with ErrJoinRequestNotPending if it is not pending anymore.
+func respondToJoinRequest(tx *sql.Tx, id, responderId int, status string) (err error) {
+	stmt := "UPDATE join_requests SET status=?, responder_id=?, responded_at=? WHERE id=? AND status=?"
+	res, err := tx.Exec(stmt, status, responderId, time.Now().UTC().Format(time.RFC3339), id, JoinRequestPending)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrJoinRequestNotPending
+	}
+	return nil
+}
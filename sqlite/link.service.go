@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+var (
+	// ErrLinkUnusable is returned when redeeming a link that has expired, has
+	// been revoked, has no uses left or whose creator may no longer invite
+	// members.
+	ErrLinkUnusable = errors.New("error: invitation link can no longer be used")
+	// ErrAlreadyMember is returned when a user joins a list they are already a
+	// member of.
+	ErrAlreadyMember = errors.New("error: user is already a member of the list")
+)
+
+type LinkService struct {
+	DB *sql.DB
+}
+
+const linkColumns = `
+	invite_links.token, lists.id, lists.name, users.id, users.username, invite_links.role,
+	invite_links.max_uses, invite_links.uses, invite_links.expires_at, invite_links.revoked_at,
+	invite_links.created_at`
+
+const linkTables = `
+	FROM invite_links
+	INNER JOIN lists ON invite_links.list_id=lists.id
+	INNER JOIN users ON invite_links.creator_id=users.id`
+
+func scanLink(row scanner) (link InviteLink, err error) {
+	var maxUses sql.NullInt64
+	var expiresAtStr, createdAtStr string
+	var revokedAtStr sql.NullString
+	err = row.Scan(
+		&link.Token, &link.List.Id, &link.List.Name, &link.Creator.Id, &link.Creator.Username, &link.Role,
+		&maxUses, &link.Uses, &expiresAtStr, &revokedAtStr, &createdAtStr,
+	)
+	if err != nil {
+		return link, err
+	}
+	link.MaxUses = int(maxUses.Int64)
+
+	link.ExpiresAt, err = time.Parse(time.RFC3339, expiresAtStr)
+	if err != nil {
+		return link, err
+	}
+	link.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return link, err
+	}
+	if revokedAtStr.Valid {
+		revokedAt, err := time.Parse(time.RFC3339, revokedAtStr.String)
+		if err != nil {
+			return link, err
+		}
+		link.RevokedAt = &revokedAt
+	}
+	return link, nil
+}
+
+// Get returns a link of a list that has not been deleted.
+func (m *LinkService) Get(token string) (link InviteLink, err error) {
+	stmt := "SELECT" + linkColumns + linkTables + " WHERE invite_links.token=? AND lists.deleted_at IS NULL"
+	return scanLink(m.DB.QueryRow(stmt, token))
+}
+
+// Outstanding returns the links of a list that can still be used, newest
+// first.
+func (m *LinkService) Outstanding(listId int) (links []InviteLink, err error) {
+	stmt := "SELECT" + linkColumns + linkTables + `
+		WHERE invite_links.list_id=? AND invite_links.revoked_at IS NULL AND invite_links.expires_at>?
+			AND (invite_links.max_uses IS NULL OR invite_links.uses<invite_links.max_uses)
+		ORDER BY invite_links.created_at DESC`
+	rows, err := m.DB.Query(stmt, listId, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return links, err
+		}
+		links = append(links, link)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return links, err
+	}
+	return links, nil
+}
+
+func (m *LinkService) Add(creatorId, listId int, role string, expiresAt time.Time, maxUses int) (link InviteLink, err error) {
+	token := crypto.GenerateToken(24)
+	maxUsesColumn := sql.NullInt64{Int64: int64(maxUses), Valid: maxUses > 0}
+	stmt := `
+		INSERT INTO invite_links (token, list_id, creator_id, role, max_uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = m.DB.Exec(stmt, token, listId, creatorId, role, maxUsesColumn,
+		expiresAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return link, err
+	}
+
+	return m.Get(token)
+}
+
+func (m *LinkService) Revoke(token string) (revoked bool, err error) {
+	stmt := "UPDATE invite_links SET revoked_at=? WHERE token=? AND revoked_at IS NULL"
+	res, err := m.DB.Exec(stmt, time.Now().UTC().Format(time.RFC3339), token)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Redeem adds a user to the list of a link with the link's role and counts the
+// use.
+func (m *LinkService) Redeem(token string, userId int) (link InviteLink, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return link, err
+	}
+	defer tx.Rollback()
+
+	stmt := "SELECT" + linkColumns + linkTables + " WHERE invite_links.token=? AND lists.deleted_at IS NULL"
+	link, err = scanLink(tx.QueryRow(stmt, token))
+	if err != nil {
+		return link, err
+	}
+	if !link.Usable(time.Now()) {
+		return link, ErrLinkUnusable
+	}
+
+	var creatorRole string
+	stmt = "SELECT role FROM list_members WHERE list_id=? AND user_id=?"
+	err = tx.QueryRow(stmt, link.List.Id, link.Creator.Id).Scan(&creatorRole)
+	if err != nil && err != sql.ErrNoRows {
+		return link, err
+	}
+	if creatorRole != RoleOwner && creatorRole != RoleEditor {
+		return link, ErrLinkUnusable
+	}
+
+	var member bool
+	stmt = "SELECT EXISTS(SELECT 1 FROM list_members WHERE list_id=? AND user_id=?)"
+	err = tx.QueryRow(stmt, link.List.Id, userId).Scan(&member)
+	if err != nil {
+		return link, err
+	}
+	if member {
+		return link, ErrAlreadyMember
+	}
+
+	stmt = "INSERT INTO list_members (list_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)"
+	_, err = tx.Exec(stmt, link.List.Id, userId, link.Role, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return link, err
+	}
+	stmt = "UPDATE invite_links SET uses=uses+1 WHERE token=?"
+	_, err = tx.Exec(stmt, token)
+	if err != nil {
+		return link, err
+	}
+	link.Uses++
+
+	return link, tx.Commit()
+}
@@ -2,30 +2,63 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 
 	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
 )
 
+// ErrNotMember is returned when changing the membership of a user who is not a
+// member of the list.
+var ErrNotMember = errors.New("error: user is not a member of the list")
+
+// ErrListDeleted is returned when joining a list that is in the trash.
+var ErrListDeleted = errors.New("error: list has been deleted")
+
 type ListService struct {
 	DB *sql.DB
 }
 
-func (m *ListService) Get(id int) (list List, err error) {
-	stmt := `
-		SELECT lists.id, lists.name, users.id, users.username
-		FROM lists
-		INNER JOIN users ON lists.creator_id=users.id
-		WHERE lists.id=?`
-	row := m.DB.QueryRow(stmt, id)
+const listColumns = `
+	lists.id, lists.name, lists.description, lists.color, lists.icon, lists.emoji,
+	users.id, users.username, lists.created_at, lists.archived_at`
 
-	err = row.Scan(&list.Id, &list.Name, &list.Creator.Id, &list.Creator.Username)
+func scanList(row scanner) (list List, err error) {
+	var createdAtStr string
+	var archivedAtStr sql.NullString
+	err = row.Scan(
+		&list.Id, &list.Name, &list.Description, &list.Color, &list.Icon, &list.Emoji,
+		&list.Creator.Id, &list.Creator.Username, &createdAtStr, &archivedAtStr,
+	)
 	if err != nil {
 		return list, err
 	}
-
+	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return list, err
+	}
+	list.CreatedAt = &createdAt
+	if archivedAtStr.Valid {
+		archivedAt, err := time.Parse(time.RFC3339, archivedAtStr.String)
+		if err != nil {
+			return list, err
+		}
+		list.ArchivedAt = &archivedAt
+	}
 	return list, nil
 }
 
+func (m *ListService) Get(id int) (list List, err error) {
+	stmt := "SELECT" + listColumns + `
+		FROM lists
+		INNER JOIN users ON lists.creator_id=users.id
+		WHERE lists.id=? AND lists.deleted_at IS NULL`
+	row := m.DB.QueryRow(stmt, id)
+
+	return scanList(row)
+}
+
 func (m *ListService) Members(id int) (members []User, err error) {
 	stmt := `
 		SELECT users.id, users.username
@@ -51,82 +84,417 @@ func (m *ListService) Members(id int) (members []User, err error) {
 	return members, nil
 }
 
-func (m *ListService) All(userId int) (lists []List, err error) {
+// MemberRoles returns the members of a list with their roles, in the order
+// they joined.
+func (m *ListService) MemberRoles(listId int) (members []Member, err error) {
+	stmt := `
+		SELECT users.id, users.username, list_members.role
+		FROM list_members
+		INNER JOIN users ON list_members.user_id=users.id
+		WHERE list_members.list_id=?
+		ORDER BY list_members.joined_at, list_members.rowid`
+	rows, err := m.DB.Query(stmt, listId)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member Member
+		err = rows.Scan(&member.Id, &member.Username, &member.Role)
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return members, err
+	}
+	return members, nil
+}
+
+func (m *ListService) IsMember(listId, userId int) (member bool, err error) {
 	stmt := `
-		SELECT lists.id, lists.name, users.id, users.username
+		SELECT EXISTS(
+			SELECT 1
+			FROM list_members
+			INNER JOIN lists ON list_members.list_id=lists.id
+			WHERE list_id=? AND user_id=? AND lists.deleted_at IS NULL
+		)`
+	row := m.DB.QueryRow(stmt, listId, userId)
+
+	err = row.Scan(&member)
+	if err != nil {
+		return false, err
+	}
+	return member, nil
+}
+
+// Role returns the role of a member of a list, or "" if the user is not a
+// member.
+func (m *ListService) Role(listId, userId int) (role string, err error) {
+	stmt := `
+		SELECT list_members.role
+		FROM list_members
+		INNER JOIN lists ON list_members.list_id=lists.id
+		WHERE list_id=? AND user_id=? AND lists.deleted_at IS NULL`
+	row := m.DB.QueryRow(stmt, listId, userId)
+
+	err = row.Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+func (m *ListService) All(userId int) (lists []List, err error) {
+	lists, _, err = m.Query(userId, Filter{})
+	return lists, err
+}
+
+var listSorts = map[string]sortOrder[List]{
+	SortCreated: {
+		{expr: "unixepoch(lists.created_at)", value: func(l List) any { return l.CreatedAt.Unix() }},
+		{expr: "lists.id", value: func(l List) any { return l.Id }},
+	},
+	SortName: {
+		{expr: "lists.name COLLATE NOCASE", value: func(l List) any { return l.Name }},
+		{expr: "lists.id", value: func(l List) any { return l.Id }},
+	},
+}
+
+// Query returns a page of the lists a user is a member of, sorted by creation
+// by default. Only the Archived, CreatedSince and CreatedBy filters apply to
+// lists.
+func (m *ListService) Query(userId int, filter Filter) (lists []List, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCreated
+	}
+	order, ok := lookupSort(listSorts, sortName)
+	if !ok {
+		return lists, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("list_members.user_id=?", userId)
+	s.where("lists.deleted_at IS NULL")
+	if filter.Archived != nil {
+		s.where("(lists.archived_at IS NOT NULL)=?", *filter.Archived)
+	}
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(lists.created_at)>=?", filter.CreatedSince.Unix())
+	}
+	if filter.CreatedBy != 0 {
+		s.where("lists.creator_id=?", filter.CreatedBy)
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
+	if err != nil {
+		return lists, "", err
+	}
+
+	stmt := "SELECT" + listColumns + `
 		FROM lists
 		INNER JOIN list_members ON lists.id=list_members.list_id
-		INNER JOIN users ON lists.creator_id=users.id
-		WHERE list_members.user_id=?`
-	rows, err := m.DB.Query(stmt, userId)
+		INNER JOIN users ON lists.creator_id=users.id` + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
 	if err != nil {
-		return []List{}, err
+		return []List{}, "", err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var list List
-		err = rows.Scan(&list.Id, &list.Name, &list.Creator.Id, &list.Creator.Username)
+		list, err := scanList(rows)
 		if err != nil {
-			return lists, err
+			return lists, "", err
 		}
 		lists = append(lists, list)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return lists, err
+		return lists, "", err
 	}
-	return lists, nil
+	lists, next = page(order, sortName, lists, filter.Limit)
+	return lists, next, nil
 }
 
 func (m *ListService) Add(creator User, name string) (list List, err error) {
-	stmt := "INSERT INTO lists (name, creator_id) VALUES (?, ?)"
-	res, err := m.DB.Exec(stmt, name, creator.Id)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return list, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertList(tx, creator.Id, List{Name: name})
+	if err != nil {
+		return list, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return list, err
 	}
+	return m.Get(id)
+}
 
+// insertList creates a list with the name and appearance of list, owned by
+// its creator.
+func insertList(tx *sql.Tx, creatorId int, list List) (id int, err error) {
+	stmt := `
+		INSERT INTO lists (name, description, color, icon, emoji, creator_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.Exec(stmt, list.Name, list.Description, list.Color, list.Icon, list.Emoji,
+		creatorId, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
 	lastInsertId, _ := res.LastInsertId()
-	list = List{
-		Id:   int(lastInsertId),
-		Name: name,
-		Creator: User{
-			Id:       creator.Id,
-			Username: creator.Username,
-		},
+
+	stmt = "INSERT INTO list_members (list_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)"
+	_, err = tx.Exec(stmt, lastInsertId, creatorId, RoleOwner, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
 	}
+	return int(lastInsertId), nil
+}
 
-	err = m.Join(list.Id, creator.Id)
+// Duplicate copies a list with its appearance, category rules and uncompleted
+// entries into a new list owned by userId.
+func (m *ListService) Duplicate(userId, listId int, name string) (list List, err error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return list, err
 	}
-	return list, nil
+	defer tx.Rollback()
+
+	stmt := "SELECT" + listColumns + `
+		FROM lists
+		INNER JOIN users ON lists.creator_id=users.id
+		WHERE lists.id=? AND lists.deleted_at IS NULL`
+	source, err := scanList(tx.QueryRow(stmt, listId))
+	if err != nil {
+		return list, err
+	}
+	source.Name = name
+	id, err := insertList(tx, userId, source)
+	if err != nil {
+		return list, err
+	}
+
+	stmt = `
+		INSERT INTO category_rules (list_id, keyword, category, created_at)
+		SELECT ?, keyword, category, ? FROM category_rules WHERE list_id=?`
+	_, err = tx.Exec(stmt, id, time.Now().Format(time.RFC3339), listId)
+	if err != nil {
+		return list, err
+	}
+
+	stmt = "SELECT" + entryColumns + `
+		FROM entries
+		WHERE list_id=? AND deleted_at IS NULL AND NOT completed
+		ORDER BY category, rank, id`
+	entries, err := queryEntries(tx, stmt, listId)
+	if err != nil {
+		return list, err
+	}
+	for _, entry := range entries {
+		entry.ListId = id
+		_, err = insertEntry(tx, userId, entry)
+		if err != nil {
+			return list, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return list, err
+	}
+	return m.Get(id)
 }
 
-func (m *ListService) Delete(listId int) (err error) {
-	stmt := "DELETE FROM lists WHERE id=?"
-	_, err = m.DB.Exec(stmt, listId)
+// Archive archives or unarchives a list. Archived lists are left out of Query
+// unless asked for.
+func (m *ListService) Archive(listId int, archived bool) (changed bool, err error) {
+	stmt := "UPDATE lists SET archived_at=? WHERE id=? AND deleted_at IS NULL AND (archived_at IS NULL)=?"
+	archivedAt := sql.NullString{}
+	if archived {
+		archivedAt = sql.NullString{String: time.Now().UTC().Format(time.RFC3339), Valid: true}
+	}
+	res, err := m.DB.Exec(stmt, archivedAt, listId, archived)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Update changes the name and appearance of a list.
+func (m *ListService) Update(list List) (updated bool, err error) {
+	stmt := `
+		UPDATE lists SET name=?, description=?, color=?, icon=?, emoji=?
+		WHERE id=? AND deleted_at IS NULL`
+	res, err := m.DB.Exec(stmt, list.Name, list.Description, list.Color, list.Icon, list.Emoji, list.Id)
+	if err != nil {
+		return false, err
 	}
-	return nil
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
 }
 
-func (m *ListService) Join(listId, userId int) (err error) {
-	stmt := "INSERT INTO list_members (list_id, user_id) VALUES (?, ?)"
-	_, err = m.DB.Exec(stmt, listId, userId)
+// Delete moves a list to the trash. Its entries and members are kept until
+// the trash is purged, so the returned token can be used to undo the deletion.
+func (m *ListService) Delete(listId int) (token string, err error) {
+	token = crypto.GenerateToken(32)
+	stmt := "UPDATE lists SET deleted_at=?, deletion_token=? WHERE id=? AND deleted_at IS NULL"
+	_, err = m.DB.Exec(stmt, time.Now().UTC().Format(time.RFC3339), token, listId)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return token, nil
 }
 
-func (m *ListService) Leave(listId, userId int) (err error) {
-	stmt := "DELETE FROM list_members WHERE list_id=? AND user_id=?"
-	_, err = m.DB.Exec(stmt, listId, userId)
+// RemoveMember takes a user out of a list, which keeps at least one owner: if
+// the user was its last owner, the member who joined first becomes the owner
+// in their place and is returned as successor. The ingest aliases, staples
+// and webhooks the user set up on the list are deleted with them, and their
+// invite links and pending invitations to the list are revoked. The last
+// member leaving a list deletes it instead, like Delete does, so that they can
+// restore it from the trash.
+func (m *ListService) RemoveMember(listId, userId int) (successor *Member, deletionToken string, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var role string
+	var owners, members int
+	stmt := `
+		SELECT
+			list_members.role,
+			(SELECT COUNT(*) FROM list_members WHERE list_id=? AND role=?),
+			(SELECT COUNT(*) FROM list_members WHERE list_id=?)
+		FROM list_members
+		INNER JOIN lists ON list_members.list_id=lists.id
+		WHERE list_members.list_id=? AND list_members.user_id=? AND lists.deleted_at IS NULL`
+	err = tx.QueryRow(stmt, listId, RoleOwner, listId, listId, userId).Scan(&role, &owners, &members)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotMember
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if members == 1 {
+		deletionToken = crypto.GenerateToken(32)
+		stmt = "UPDATE lists SET deleted_at=?, deletion_token=? WHERE id=?"
+		_, err = tx.Exec(stmt, time.Now().UTC().Format(time.RFC3339), deletionToken, listId)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, deletionToken, tx.Commit()
+	}
+
+	// what the member set up to act on the list on their behalf goes with them
+	stmts := []string{
+		"DELETE FROM list_members WHERE list_id=? AND user_id=?",
+		"DELETE FROM ingest_aliases WHERE list_id=? AND user_id=?",
+		"DELETE FROM staples WHERE list_id=? AND created_by=?",
+		"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE list_id=? AND created_by=?)",
+		"DELETE FROM webhooks WHERE list_id=? AND created_by=?",
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt, listId, userId)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	// and so do the ways they handed out to join it
+	now := time.Now().UTC().Format(time.RFC3339)
+	stmt = "UPDATE invite_links SET revoked_at=? WHERE list_id=? AND creator_id=? AND revoked_at IS NULL"
+	_, err = tx.Exec(stmt, now, listId, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	stmt = "UPDATE invitations SET status=?, responded_at=? WHERE list_id=? AND inviter_id=? AND status=?"
+	_, err = tx.Exec(stmt, InvitationRevoked, now, listId, userId, InvitationPending)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == RoleOwner && owners == 1 {
+		stmt = `
+			SELECT users.id, users.username
+			FROM list_members
+			INNER JOIN users ON list_members.user_id=users.id
+			WHERE list_members.list_id=?
+			ORDER BY list_members.joined_at, list_members.rowid
+			LIMIT 1`
+		successor = &Member{Role: RoleOwner}
+		err = tx.QueryRow(stmt, listId).Scan(&successor.Id, &successor.Username)
+		if err != nil {
+			return nil, "", err
+		}
+		stmt = "UPDATE list_members SET role=? WHERE list_id=? AND user_id=?"
+		_, err = tx.Exec(stmt, RoleOwner, listId, successor.Id)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	err = reassignCreator(tx, listId)
+	if err != nil {
+		return nil, "", err
+	}
+	return successor, "", tx.Commit()
+}
+
+// TransferOwnership makes a member the owner of a list in place of a current
+// owner, who stays on as an editor.
+func (m *ListService) TransferOwnership(listId, ownerId, memberId int) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := "UPDATE list_members SET role=? WHERE list_id=? AND user_id=?"
+	res, err := tx.Exec(stmt, RoleOwner, listId, memberId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotMember
+	}
+	_, err = tx.Exec(stmt, RoleEditor, listId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	stmt = "UPDATE lists SET creator_id=? WHERE id=?"
+	_, err = tx.Exec(stmt, memberId, listId)
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+// reassignCreator hands a list whose creator is not one of its owners anymore
+// to the owner who joined first, since the trash and deletion of lists go by
+// their creator.
+func reassignCreator(tx *sql.Tx, listId int) (err error) {
+	stmt := `
+		UPDATE lists SET creator_id=(
+			SELECT user_id FROM list_members WHERE list_id=lists.id AND role=? ORDER BY joined_at, rowid LIMIT 1
+		)
+		WHERE id=? AND creator_id NOT IN (SELECT user_id FROM list_members WHERE list_id=lists.id AND role=?)`
+	_, err = tx.Exec(stmt, RoleOwner, listId, RoleOwner)
+	return err
 }
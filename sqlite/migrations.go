@@ -0,0 +1,401 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+var migrations = []func(tx *sql.Tx) error{
+	execMigration(`
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS sessions (
+			token TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			created_at TEXT NOT NULL,
+			expires_at TEXT
+		);
+		CREATE TABLE IF NOT EXISTS lists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			creator_id INTEGER NOT NULL REFERENCES users(id)
+		);
+		CREATE TABLE IF NOT EXISTS list_members (
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			PRIMARY KEY (list_id, user_id)
+		);
+		CREATE TABLE IF NOT EXISTS invitations (
+			token TEXT PRIMARY KEY,
+			inviter_id INTEGER NOT NULL REFERENCES users(id),
+			invitee_id INTEGER NOT NULL REFERENCES users(id),
+			list_id INTEGER NOT NULL REFERENCES lists(id)
+		);
+		CREATE TABLE IF NOT EXISTS entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			text TEXT NOT NULL,
+			category TEXT NOT NULL,
+			order_index INTEGER NOT NULL,
+			completed BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TEXT NOT NULL
+		);`),
+	migrateEntryRanks,
+	execMigration(`
+		ALTER TABLE entries ADD COLUMN deleted_at TEXT;
+		ALTER TABLE entries ADD COLUMN deletion_token TEXT;
+		ALTER TABLE lists ADD COLUMN deleted_at TEXT;
+		ALTER TABLE lists ADD COLUMN deletion_token TEXT;
+		CREATE INDEX entries_deletion_token ON entries (deletion_token);
+		CREATE INDEX lists_deletion_token ON lists (deletion_token);`),
+	execMigration(`
+		ALTER TABLE entries ADD COLUMN created_by INTEGER REFERENCES users(id);
+		ALTER TABLE entries ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ADD COLUMN completed_by INTEGER REFERENCES users(id);
+		ALTER TABLE entries ADD COLUMN completed_at TEXT;
+		UPDATE entries SET updated_at=created_at;
+		CREATE TABLE entry_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_id INTEGER NOT NULL,
+			list_id INTEGER NOT NULL,
+			source_list_id INTEGER,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			action TEXT NOT NULL,
+			before TEXT,
+			after TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX entry_history_entry ON entry_history (entry_id, id);
+		CREATE INDEX entry_history_list ON entry_history (list_id, id);
+		CREATE INDEX entry_history_source_list ON entry_history (source_list_id, id);`),
+	execMigration(`
+		ALTER TABLE entries ADD COLUMN note TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ADD COLUMN price INTEGER;
+		ALTER TABLE entries ADD COLUMN currency TEXT;
+		CREATE TABLE attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_id INTEGER NOT NULL REFERENCES entries(id),
+			key TEXT NOT NULL,
+			thumbnail_key TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX attachments_entry ON attachments (entry_id);`),
+	execMigration(`
+		CREATE TABLE staples (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			text TEXT NOT NULL,
+			category TEXT NOT NULL,
+			every_days INTEGER,
+			weekday INTEGER,
+			next_at TEXT NOT NULL,
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX staples_list ON staples (list_id);
+		CREATE INDEX staples_next_at ON staples (next_at);`),
+	execMigration(`
+		CREATE TABLE category_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			keyword TEXT NOT NULL COLLATE NOCASE,
+			category TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			UNIQUE (list_id, keyword)
+		);`),
+	execMigration(`
+		ALTER TABLE lists ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+		ALTER TABLE invitations ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+		UPDATE lists SET created_at=strftime('%Y-%m-%dT%H:%M:%SZ', 'now');
+		UPDATE invitations SET created_at=strftime('%Y-%m-%dT%H:%M:%SZ', 'now');`),
+	execMigration(`
+		ALTER TABLE lists ADD COLUMN description TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN color TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+		ALTER TABLE lists ADD COLUMN emoji TEXT NOT NULL DEFAULT '';
+		ALTER TABLE list_members ADD COLUMN role TEXT NOT NULL DEFAULT 'editor';
+		UPDATE list_members SET role='owner'
+		WHERE user_id=(SELECT creator_id FROM lists WHERE lists.id=list_members.list_id);`),
+	execMigration(`
+		ALTER TABLE lists ADD COLUMN archived_at TEXT;
+		CREATE TABLE templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL,
+			color TEXT NOT NULL,
+			icon TEXT NOT NULL,
+			emoji TEXT NOT NULL,
+			creator_id INTEGER NOT NULL REFERENCES users(id),
+			created_at TEXT NOT NULL
+		);
+		CREATE TABLE template_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			template_id INTEGER NOT NULL REFERENCES templates(id),
+			text TEXT NOT NULL,
+			category TEXT NOT NULL,
+			note TEXT NOT NULL,
+			price INTEGER,
+			currency TEXT,
+			rank TEXT NOT NULL
+		);
+		CREATE INDEX templates_creator ON templates (creator_id);
+		CREATE INDEX template_entries_template ON template_entries (template_id);`),
+	execMigration(`
+		CREATE TABLE invite_links (
+			token TEXT PRIMARY KEY,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			creator_id INTEGER NOT NULL REFERENCES users(id),
+			role TEXT NOT NULL,
+			max_uses INTEGER,
+			uses INTEGER NOT NULL DEFAULT 0,
+			expires_at TEXT NOT NULL,
+			revoked_at TEXT,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX invite_links_list ON invite_links (list_id);`),
+	execMigration(`
+		ALTER TABLE invitations ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+		ALTER TABLE invitations ADD COLUMN expires_at TEXT NOT NULL DEFAULT '';
+		ALTER TABLE invitations ADD COLUMN responded_at TEXT;
+		UPDATE invitations SET expires_at=strftime('%Y-%m-%dT%H:%M:%SZ', created_at, '+14 days');
+		CREATE INDEX invitations_invitee_list ON invitations (invitee_id, list_id, status);`),
+	execMigration(`
+		CREATE TABLE join_requests (
+			id INTEGER PRIMARY KEY,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			message TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'pending',
+			responder_id INTEGER REFERENCES users(id),
+			created_at TEXT NOT NULL,
+			responded_at TEXT
+		);
+		CREATE INDEX join_requests_list ON join_requests (list_id, status);
+		CREATE UNIQUE INDEX join_requests_pending ON join_requests (list_id, user_id) WHERE status='pending';`),
+	execMigration(`
+		CREATE TABLE notifications (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			type TEXT NOT NULL,
+			list_id INTEGER,
+			actor_id INTEGER NOT NULL REFERENCES users(id),
+			data TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			read_at TEXT
+		);
+		CREATE INDEX notifications_user ON notifications (user_id, read_at);
+		CREATE TABLE notification_preferences (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			type TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			PRIMARY KEY (user_id, type)
+		);`),
+	execMigration(`
+		CREATE TABLE push_subscriptions (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			endpoint TEXT NOT NULL UNIQUE,
+			p256dh TEXT NOT NULL,
+			auth TEXT NOT NULL,
+			device TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX push_subscriptions_user ON push_subscriptions (user_id);
+		CREATE TABLE push_deliveries (
+			id INTEGER PRIMARY KEY,
+			subscription_id INTEGER NOT NULL REFERENCES push_subscriptions(id),
+			batch_key TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX push_deliveries_due ON push_deliveries (next_attempt_at);
+		CREATE INDEX push_deliveries_batch ON push_deliveries (subscription_id, batch_key);`),
+	execMigration(`
+		CREATE TABLE email_settings (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id),
+			email TEXT NOT NULL,
+			notifications BOOLEAN NOT NULL DEFAULT TRUE,
+			digest TEXT NOT NULL DEFAULT 'off',
+			digest_sent_at TEXT,
+			unsubscribe_token TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE password_resets (
+			token TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);
+		CREATE INDEX password_resets_user ON password_resets (user_id);`),
+	execMigration(`
+		CREATE TABLE webhooks (
+			id INTEGER PRIMARY KEY,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '',
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX webhooks_list ON webhooks (list_id);
+		CREATE TABLE webhook_deliveries (
+			id INTEGER PRIMARY KEY,
+			webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			next_attempt_at TEXT,
+			delivered_at TEXT
+		);
+		CREATE INDEX webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+		CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);`),
+	execMigration(`
+		CREATE TABLE ingest_aliases (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			sender TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX ingest_aliases_user ON ingest_aliases (user_id);`),
+	execMigration(`
+		ALTER TABLE entries ADD COLUMN quantity REAL;
+		ALTER TABLE entries ADD COLUMN unit TEXT;
+		ALTER TABLE template_entries ADD COLUMN quantity REAL;
+		ALTER TABLE template_entries ADD COLUMN unit TEXT;`),
+	execMigration(`
+		CREATE TABLE recipes (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			name TEXT NOT NULL,
+			servings INTEGER NOT NULL,
+			url TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX recipes_user ON recipes (user_id);
+		CREATE TABLE recipe_ingredients (
+			recipe_id INTEGER NOT NULL REFERENCES recipes(id),
+			position INTEGER NOT NULL,
+			line TEXT NOT NULL,
+			text TEXT NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			quantity REAL,
+			unit TEXT,
+			PRIMARY KEY (recipe_id, position)
+		);
+		CREATE TABLE meals (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			recipe_id INTEGER NOT NULL REFERENCES recipes(id),
+			date TEXT NOT NULL,
+			servings INTEGER NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX meals_user_date ON meals (user_id, date);`),
+	execMigration(`
+		CREATE TABLE pantry_items (
+			id INTEGER PRIMARY KEY,
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			name TEXT NOT NULL,
+			stock REAL NOT NULL DEFAULT 0,
+			unit TEXT NOT NULL DEFAULT '',
+			minimum REAL,
+			expires_on TEXT,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+		CREATE UNIQUE INDEX pantry_items_list_name ON pantry_items (list_id, name COLLATE NOCASE);`),
+	execMigration(`
+		CREATE TABLE pantry_restocks (
+			entry_id INTEGER PRIMARY KEY REFERENCES entries(id),
+			item_id INTEGER NOT NULL REFERENCES pantry_items(id),
+			amount REAL NOT NULL
+		);`),
+	// aliases are confirmed by the sender sending back their code, only
+	// confirmed aliases are unique, and existing ones need to be confirmed
+	execMigration(`
+		CREATE TABLE ingest_aliases_new (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			list_id INTEGER NOT NULL REFERENCES lists(id),
+			sender TEXT NOT NULL,
+			code TEXT,
+			confirmed_at TEXT,
+			created_at TEXT NOT NULL
+		);
+		INSERT INTO ingest_aliases_new (id, user_id, list_id, sender, code, created_at)
+		SELECT id, user_id, list_id, sender, lower(hex(randomblob(4))), created_at FROM ingest_aliases;
+		DROP TABLE ingest_aliases;
+		ALTER TABLE ingest_aliases_new RENAME TO ingest_aliases;
+		CREATE INDEX ingest_aliases_user ON ingest_aliases (user_id);
+		CREATE INDEX ingest_aliases_sender ON ingest_aliases (sender);
+		CREATE UNIQUE INDEX ingest_aliases_confirmed_sender ON ingest_aliases (sender) WHERE confirmed_at IS NOT NULL;`),
+	// members that joined before are dated back to the creation of their list
+	execMigration(`
+		ALTER TABLE list_members ADD COLUMN joined_at TEXT;
+		UPDATE list_members SET joined_at=(SELECT created_at FROM lists WHERE lists.id=list_members.list_id);`),
+	// addresses given before have to be verified by saving them again
+	execMigration(`
+		ALTER TABLE email_settings ADD COLUMN verified_at TEXT;
+		ALTER TABLE email_settings ADD COLUMN verification_token TEXT;
+		CREATE UNIQUE INDEX email_settings_verification_token ON email_settings (verification_token);`),
+}
+
+func execMigration(stmt string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+}
+
+// migrateEntryRanks replaces the dense order_index of entries with rank keys,
+// keeping the existing order within each category.
+func migrateEntryRanks(tx *sql.Tx) (err error) {
+	_, err = tx.Exec("ALTER TABLE entries ADD COLUMN rank TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT DISTINCT list_id FROM entries")
+	if err != nil {
+		return err
+	}
+	var listIds []int
+	for rows.Next() {
+		var listId int
+		err = rows.Scan(&listId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		listIds = append(listIds, listId)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, listId := range listIds {
+		err = rerank(tx, listId, "order_index, id")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		ALTER TABLE entries DROP COLUMN order_index;
+		CREATE INDEX entries_list_category_rank ON entries (list_id, category, rank);`)
+	return err
+}
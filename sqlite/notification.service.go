@@ -0,0 +1,237 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type NotificationService struct {
+	DB *sql.DB
+}
+
+const notificationColumns = `
+	notifications.id, notifications.type, notifications.list_id, actors.id, actors.username,
+	notifications.data, notifications.created_at, notifications.read_at`
+
+const notificationTables = `
+	FROM notifications
+	INNER JOIN users AS actors ON notifications.actor_id=actors.id`
+
+func scanNotification(row scanner) (notification Notification, err error) {
+	var listId sql.NullInt64
+	var data, createdAtStr string
+	var readAtStr sql.NullString
+	err = row.Scan(
+		&notification.Id, &notification.Type, &listId, &notification.Actor.Id, &notification.Actor.Username,
+		&data, &createdAtStr, &readAtStr,
+	)
+	if err != nil {
+		return notification, err
+	}
+	notification.ListId = int(listId.Int64)
+	if data != "null" {
+		notification.Data = []byte(data)
+	}
+
+	notification.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return notification, err
+	}
+	if readAtStr.Valid {
+		readAt, err := time.Parse(time.RFC3339, readAtStr.String)
+		if err != nil {
+			return notification, err
+		}
+		notification.ReadAt = &readAt
+	}
+	return notification, nil
+}
+
+var notificationSorts = map[string]sortOrder[Notification]{
+	SortCreated: {
+		{expr: "notifications.id", desc: true, value: func(n Notification) any { return n.Id }},
+	},
+}
+
+// Query returns a page of the notifications of a user, newest first. Only the
+// Read and CreatedSince filters apply to notifications.
+func (m *NotificationService) Query(userId int, filter Filter) (notifications []Notification, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCreated
+	}
+	order, ok := lookupSort(notificationSorts, sortName)
+	if !ok {
+		return notifications, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("notifications.user_id=?", userId)
+	if filter.Read != nil {
+		s.where("(notifications.read_at IS NOT NULL)=?", *filter.Read)
+	}
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(notifications.created_at)>=?", filter.CreatedSince.Unix())
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
+	if err != nil {
+		return notifications, "", err
+	}
+
+	stmt := "SELECT" + notificationColumns + notificationTables + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
+	if err != nil {
+		return notifications, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return notifications, "", err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return notifications, "", err
+	}
+	notifications, next = page(order, sortName, notifications, filter.Limit)
+	return notifications, next, nil
+}
+
+func (m *NotificationService) Unread(userId int) (unread int, err error) {
+	stmt := "SELECT COUNT(*) FROM notifications WHERE user_id=? AND read_at IS NULL"
+	err = m.DB.QueryRow(stmt, userId).Scan(&unread)
+	if err != nil {
+		return 0, err
+	}
+	return unread, nil
+}
+
+// Add notifies each of the users who has not turned notifications of its type
+// off.
+func (m *NotificationService) Add(userIds []int, notification Notification) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	data := string(notification.Data)
+	if data == "" {
+		data = "null"
+	}
+	listId := sql.NullInt64{Int64: int64(notification.ListId), Valid: notification.ListId != 0}
+	stmt := `
+		INSERT INTO notifications (user_id, type, list_id, actor_id, data, created_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS(
+			SELECT 1 FROM notification_preferences WHERE user_id=? AND type=? AND NOT enabled
+		)`
+	createdAt := notification.CreatedAt.UTC().Format(time.RFC3339)
+	for _, userId := range userIds {
+		_, err = tx.Exec(stmt, userId, notification.Type, listId, notification.Actor.Id, data, createdAt,
+			userId, notification.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkRead marks notifications of a user as read, or all of them if no ids are
+// given. It returns how many of them were unread.
+func (m *NotificationService) MarkRead(userId int, ids []int) (marked int, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	readAt := time.Now().UTC().Format(time.RFC3339)
+	if len(ids) == 0 {
+		stmt := "UPDATE notifications SET read_at=? WHERE user_id=? AND read_at IS NULL"
+		res, err := tx.Exec(stmt, readAt, userId)
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, _ := res.RowsAffected()
+		return int(rowsAffected), tx.Commit()
+	}
+
+	stmt := "UPDATE notifications SET read_at=? WHERE id=? AND user_id=? AND read_at IS NULL"
+	for _, id := range ids {
+		res, err := tx.Exec(stmt, readAt, id, userId)
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, _ := res.RowsAffected()
+		marked += int(rowsAffected)
+	}
+	return marked, tx.Commit()
+}
+
+// Prune deletes the notifications that were read before the given time.
+func (m *NotificationService) Prune(before time.Time) (err error) {
+	stmt := "DELETE FROM notifications WHERE unixepoch(read_at)<?"
+	_, err = m.DB.Exec(stmt, before.Unix())
+	return err
+}
+
+// Preferences returns whether a user wants to be notified of each of the
+// NotificationTypes, which they do unless they turned it off.
+func (m *NotificationService) Preferences(userId int) (preferences map[string]bool, err error) {
+	preferences = map[string]bool{}
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = true
+	}
+
+	stmt := "SELECT type, enabled FROM notification_preferences WHERE user_id=?"
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return preferences, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		err = rows.Scan(&notificationType, &enabled)
+		if err != nil {
+			return preferences, err
+		}
+		if _, ok := preferences[notificationType]; ok {
+			preferences[notificationType] = enabled
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return preferences, err
+	}
+	return preferences, nil
+}
+
+// SetPreferences turns notifications of the given types on or off for a user.
+func (m *NotificationService) SetPreferences(userId int, preferences map[string]bool) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		INSERT INTO notification_preferences (user_id, type, enabled) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, type) DO UPDATE SET enabled=excluded.enabled`
+	for notificationType, enabled := range preferences {
+		_, err = tx.Exec(stmt, userId, notificationType, enabled)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
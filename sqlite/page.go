@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidSort is returned for sort orders a collection does not support.
+var ErrInvalidSort = errors.New("error: invalid sort order")
+
+// ErrInvalidCursor is returned for cursors that are malformed or belong to a
+// different sort order.
+var ErrInvalidCursor = errors.New("error: invalid cursor")
+
+// sortColumn is a column of a sort order. value reads the column from a row,
+// so that a cursor can be built from the last row of a page.
+type sortColumn[T any] struct {
+	expr  string
+	desc  bool
+	value func(row T) any
+}
+
+// sortOrder is a list of columns to sort by, the last of which must be unique
+// so that cursors point at exactly one row.
+type sortOrder[T any] []sortColumn[T]
+
+// lookupSort finds a sort order by name. A name prefixed with "-" reverses it.
+func lookupSort[T any](sorts map[string]sortOrder[T], name string) (order sortOrder[T], ok bool) {
+	order, ok = sorts[strings.TrimPrefix(name, "-")]
+	if !ok || !strings.HasPrefix(name, "-") {
+		return order, ok
+	}
+
+	reversed := make(sortOrder[T], len(order))
+	for i, column := range order {
+		column.desc = !column.desc
+		reversed[i] = column
+	}
+	return reversed, true
+}
+
+func (o sortOrder[T]) orderBy() string {
+	columns := make([]string, len(o))
+	for i, column := range o {
+		columns[i] = column.expr
+		if column.desc {
+			columns[i] += " DESC"
+		}
+	}
+	return "ORDER BY " + strings.Join(columns, ", ")
+}
+
+// after returns the condition selecting the rows that come after the row with
+// the given column values.
+func (o sortOrder[T]) after(values []any) (cond string, args []any) {
+	var alternatives []string
+	for i, column := range o {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, o[j].expr+"=?")
+			args = append(args, values[j])
+		}
+		if column.desc {
+			terms = append(terms, column.expr+"<?")
+		} else {
+			terms = append(terms, column.expr+">?")
+		}
+		args = append(args, values[i])
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// cursor encodes the position of row in the sort order with the given name.
+func (o sortOrder[T]) cursor(name string, row T) string {
+	values := []any{name}
+	for _, column := range o {
+		values = append(values, column.value(row))
+	}
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (o sortOrder[T]) decodeCursor(name, cursor string) (values []any, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return values, ErrInvalidCursor
+	}
+	err = json.Unmarshal(data, &values)
+	if err != nil || len(values) != len(o)+1 || values[0] != name {
+		return values, ErrInvalidCursor
+	}
+
+	values = values[1:]
+	for i, value := range values {
+		// all numeric sort columns are integers
+		if number, ok := value.(float64); ok {
+			values[i] = int64(number)
+		}
+	}
+	return values, nil
+}
+
+// selection collects the conditions of a WHERE clause and their arguments.
+type selection struct {
+	conditions []string
+	args       []any
+}
+
+func (s *selection) where(cond string, args ...any) {
+	s.conditions = append(s.conditions, cond)
+	s.args = append(s.args, args...)
+}
+
+func (s *selection) String() string {
+	if len(s.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(s.conditions, " AND ")
+}
+
+// paginate adds the cursor condition to s and returns the ORDER BY and LIMIT
+// clauses of a page with their arguments. One more row than the limit is
+// selected, to know whether there is a next page.
+func (o sortOrder[T]) paginate(s *selection, name, cursor string, limit int) (clauses string, args []any, err error) {
+	if cursor != "" {
+		values, err := o.decodeCursor(name, cursor)
+		if err != nil {
+			return "", args, err
+		}
+		cond, cursorArgs := o.after(values)
+		s.where(cond, cursorArgs...)
+	}
+
+	clauses = " " + o.orderBy()
+	if limit > 0 {
+		clauses += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+	return clauses, args, nil
+}
+
+// page trims rows to the limit and returns the cursor of the next page, or ""
+// if this is the last one.
+func page[T any](o sortOrder[T], name string, rows []T, limit int) (_ []T, next string) {
+	if limit <= 0 || len(rows) <= limit {
+		return rows, ""
+	}
+	rows = rows[:limit]
+	return rows, o.cursor(name, rows[limit-1])
+}
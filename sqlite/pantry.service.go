@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// ErrDuplicatePantryItem is returned when adding an item to a pantry that has
+// an item of the same name already.
+var ErrDuplicatePantryItem = errors.New("error: pantry already has an item of that name")
+
+type PantryService struct {
+	DB *sql.DB
+}
+
+const pantryItemColumns = "id, list_id, name, stock, unit, minimum, expires_on, created_at, updated_at"
+
+func scanPantryItem(row scanner) (item PantryItem, err error) {
+	var minimum sql.NullFloat64
+	var expiresOn sql.NullString
+	var createdAtStr, updatedAtStr string
+	err = row.Scan(
+		&item.Id, &item.ListId, &item.Name, &item.Stock, &item.Unit, &minimum, &expiresOn,
+		&createdAtStr, &updatedAtStr,
+	)
+	if err != nil {
+		return item, err
+	}
+	if minimum.Valid {
+		item.Minimum = &minimum.Float64
+	}
+	item.ExpiresOn = expiresOn.String
+	item.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return item, err
+	}
+	item.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr)
+	if err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+func (m *PantryService) Get(id int) (item PantryItem, err error) {
+	stmt := "SELECT " + pantryItemColumns + " FROM pantry_items WHERE id=?"
+	return scanPantryItem(m.DB.QueryRow(stmt, id))
+}
+
+// Find returns the item of a pantry with a name, ignoring case.
+func (m *PantryService) Find(listId int, name string) (item PantryItem, found bool, err error) {
+	stmt := "SELECT " + pantryItemColumns + " FROM pantry_items WHERE list_id=? AND name=? COLLATE NOCASE"
+	item, err = scanPantryItem(m.DB.QueryRow(stmt, listId, name))
+	if err == sql.ErrNoRows {
+		return item, false, nil
+	}
+	if err != nil {
+		return item, false, err
+	}
+	return item, true, nil
+}
+
+// All returns the items of the pantry of a list by name. If expiresBy is not
+// empty, only items that expire on or before that day are returned.
+func (m *PantryService) All(listId int, expiresBy string) (items []PantryItem, err error) {
+	stmt := "SELECT " + pantryItemColumns + " FROM pantry_items WHERE list_id=?"
+	args := []any{listId}
+	if expiresBy != "" {
+		stmt += " AND expires_on<=?"
+		args = append(args, expiresBy)
+	}
+	rows, err := m.DB.Query(stmt+" ORDER BY name COLLATE NOCASE", args...)
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanPantryItem(rows)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return items, err
+	}
+	return items, nil
+}
+
+func (m *PantryService) Add(item PantryItem) (added PantryItem, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return added, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	stmt := "SELECT EXISTS(SELECT 1 FROM pantry_items WHERE list_id=? AND name=? COLLATE NOCASE)"
+	err = tx.QueryRow(stmt, item.ListId, item.Name).Scan(&taken)
+	if err != nil {
+		return added, err
+	}
+	if taken {
+		return added, ErrDuplicatePantryItem
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	stmt = `
+		INSERT INTO pantry_items (list_id, name, stock, unit, minimum, expires_on, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	minimum, expiresOn := pantryColumns(item)
+	res, err := tx.Exec(stmt, item.ListId, item.Name, item.Stock, item.Unit, minimum, expiresOn, now, now)
+	if err != nil {
+		return added, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return added, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+	return m.Get(int(lastInsertId))
+}
+
+// Update changes the name, stock, unit, minimum and expiry of an item.
+func (m *PantryService) Update(item PantryItem) (updated PantryItem, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return updated, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	stmt := "SELECT EXISTS(SELECT 1 FROM pantry_items WHERE list_id=? AND name=? COLLATE NOCASE AND id!=?)"
+	err = tx.QueryRow(stmt, item.ListId, item.Name, item.Id).Scan(&taken)
+	if err != nil {
+		return updated, err
+	}
+	if taken {
+		return updated, ErrDuplicatePantryItem
+	}
+
+	stmt = "UPDATE pantry_items SET name=?, stock=?, unit=?, minimum=?, expires_on=?, updated_at=? WHERE id=?"
+	minimum, expiresOn := pantryColumns(item)
+	_, err = tx.Exec(stmt, item.Name, item.Stock, item.Unit, minimum, expiresOn, time.Now().UTC().Format(time.RFC3339), item.Id)
+	if err != nil {
+		return updated, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return updated, err
+	}
+	return m.Get(item.Id)
+}
+
+// Adjust adds amount, which is negative for consumed stock, to the stock of an
+// item. The stock does not drop below zero.
+func (m *PantryService) Adjust(id int, amount float64) (item PantryItem, err error) {
+	stmt := "UPDATE pantry_items SET stock=MAX(ROUND(stock+?, 3), 0), updated_at=? WHERE id=? RETURNING " + pantryItemColumns
+	return scanPantryItem(m.DB.QueryRow(stmt, math.Round(amount*1000)/1000, time.Now().UTC().Format(time.RFC3339), id))
+}
+
+// Restock adds amount to the stock of an item for a completed entry and
+// records it, so that uncompleting the entry takes it back. An entry that
+// restocked an item already is not counted again.
+func (m *PantryService) Restock(itemId, entryId int, amount float64) (restocked bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	amount = math.Round(amount*1000) / 1000
+	res, err := tx.Exec("INSERT OR IGNORE INTO pantry_restocks (entry_id, item_id, amount) VALUES (?, ?, ?)", entryId, itemId, amount)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	err = adjustStock(tx, itemId, amount)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Unrestock takes back from the stock of an item what an entry added to it
+// when it was completed, if anything.
+func (m *PantryService) Unrestock(entryId int) (unrestocked bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var itemId int
+	var amount float64
+	stmt := "DELETE FROM pantry_restocks WHERE entry_id=? RETURNING item_id, amount"
+	err = tx.QueryRow(stmt, entryId).Scan(&itemId, &amount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = adjustStock(tx, itemId, -amount)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func adjustStock(tx *sql.Tx, id int, amount float64) (err error) {
+	stmt := "UPDATE pantry_items SET stock=MAX(ROUND(stock+?, 3), 0), updated_at=? WHERE id=?"
+	_, err = tx.Exec(stmt, amount, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func (m *PantryService) Delete(id int) (deleted bool, err error) {
+	res, err := m.DB.Exec("DELETE FROM pantry_items WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+func pantryColumns(item PantryItem) (minimum sql.NullFloat64, expiresOn sql.NullString) {
+	if item.Minimum != nil {
+		minimum = sql.NullFloat64{Float64: *item.Minimum, Valid: true}
+	}
+	if item.ExpiresOn != "" {
+		expiresOn = sql.NullString{String: item.ExpiresOn, Valid: true}
+	}
+	return minimum, expiresOn
+}
@@ -0,0 +1,233 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type PushService struct {
+	DB *sql.DB
+}
+
+const pushSubscriptionColumns = "id, user_id, endpoint, p256dh, auth, device, created_at"
+
+func scanPushSubscription(row scanner) (subscription PushSubscription, err error) {
+	var createdAtStr string
+	err = row.Scan(
+		&subscription.Id, &subscription.UserId, &subscription.Endpoint, &subscription.P256dh,
+		&subscription.Auth, &subscription.Device, &createdAtStr,
+	)
+	if err != nil {
+		return subscription, err
+	}
+	subscription.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return subscription, err
+	}
+	return subscription, nil
+}
+
+func (m *PushService) Get(id int) (subscription PushSubscription, err error) {
+	stmt := "SELECT " + pushSubscriptionColumns + " FROM push_subscriptions WHERE id=?"
+	return scanPushSubscription(m.DB.QueryRow(stmt, id))
+}
+
+func (m *PushService) Subscriptions(userId int) (subscriptions []PushSubscription, err error) {
+	stmt := "SELECT " + pushSubscriptionColumns + " FROM push_subscriptions WHERE user_id=? ORDER BY id"
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return subscriptions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription, err := scanPushSubscription(rows)
+		if err != nil {
+			return subscriptions, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return subscriptions, err
+	}
+	return subscriptions, nil
+}
+
+// Subscribe adds a subscription for a user. Subscribing with an endpoint that
+// is already known replaces that subscription, since browsers hand out new
+// keys when they subscribe again.
+func (m *PushService) Subscribe(subscription PushSubscription) (_ PushSubscription, err error) {
+	stmt := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, device, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (endpoint) DO UPDATE SET
+			user_id=excluded.user_id, p256dh=excluded.p256dh, auth=excluded.auth, device=excluded.device`
+	_, err = m.DB.Exec(stmt, subscription.UserId, subscription.Endpoint, subscription.P256dh,
+		subscription.Auth, subscription.Device, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return subscription, err
+	}
+
+	stmt = "SELECT " + pushSubscriptionColumns + " FROM push_subscriptions WHERE endpoint=?"
+	return scanPushSubscription(m.DB.QueryRow(stmt, subscription.Endpoint))
+}
+
+// Unsubscribe removes a subscription along with the messages queued for it.
+func (m *PushService) Unsubscribe(id int) (unsubscribed bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM push_deliveries WHERE subscription_id=?", id)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("DELETE FROM push_subscriptions WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, tx.Commit()
+}
+
+// Enqueue queues a message for every subscription of the given users who have
+// not turned notifications of its type off, to be sent at the given time. If
+// an unsent message with the same non-empty batch key is already queued for a
+// subscription, the message is merged into it instead.
+func (m *PushService) Enqueue(userIds []int, message PushMessage, batchKey string, at time.Time) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		SELECT id FROM push_subscriptions
+		WHERE user_id=? AND NOT EXISTS(
+			SELECT 1 FROM notification_preferences
+			WHERE notification_preferences.user_id=push_subscriptions.user_id AND type=? AND NOT enabled
+		)`
+	var subscriptionIds []int
+	for _, userId := range userIds {
+		ids, err := queryIds(tx, stmt, userId, message.Type)
+		if err != nil {
+			return err
+		}
+		subscriptionIds = append(subscriptionIds, ids...)
+	}
+
+	for _, subscriptionId := range subscriptionIds {
+		err = enqueue(tx, subscriptionId, message, batchKey, at)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func enqueue(tx *sql.Tx, subscriptionId int, message PushMessage, batchKey string, at time.Time) (err error) {
+	if batchKey != "" {
+		var id int
+		var data []byte
+		stmt := "SELECT id, message FROM push_deliveries WHERE subscription_id=? AND batch_key=? AND attempts=0"
+		err = tx.QueryRow(stmt, subscriptionId, batchKey).Scan(&id, &data)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			var batched PushMessage
+			err = json.Unmarshal(data, &batched)
+			if err != nil {
+				return err
+			}
+			data, err = json.Marshal(batched.Merge(message))
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("UPDATE push_deliveries SET message=? WHERE id=?", string(data), id)
+			return err
+		}
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	stmt := `
+		INSERT INTO push_deliveries (subscription_id, batch_key, message, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err = tx.Exec(stmt, subscriptionId, batchKey, string(data), at.UTC().Format(time.RFC3339),
+		time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// Due returns up to limit queued messages that are due to be sent at now,
+// oldest first.
+func (m *PushService) Due(now time.Time, limit int) (deliveries []PushDelivery, err error) {
+	stmt := `
+		SELECT
+			push_deliveries.id, push_deliveries.message, push_deliveries.attempts,
+			push_subscriptions.id, push_subscriptions.user_id, push_subscriptions.endpoint,
+			push_subscriptions.p256dh, push_subscriptions.auth, push_subscriptions.device,
+			push_subscriptions.created_at
+		FROM push_deliveries
+		INNER JOIN push_subscriptions ON push_deliveries.subscription_id=push_subscriptions.id
+		WHERE unixepoch(push_deliveries.next_attempt_at)<=?
+		ORDER BY push_deliveries.next_attempt_at, push_deliveries.id
+		LIMIT ?`
+	rows, err := m.DB.Query(stmt, now.Unix(), limit)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery PushDelivery
+		var data, createdAtStr string
+		err = rows.Scan(
+			&delivery.Id, &data, &delivery.Attempts,
+			&delivery.Subscription.Id, &delivery.Subscription.UserId, &delivery.Subscription.Endpoint,
+			&delivery.Subscription.P256dh, &delivery.Subscription.Auth, &delivery.Subscription.Device,
+			&createdAtStr,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+		delivery.Subscription.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return deliveries, err
+		}
+		err = json.Unmarshal([]byte(data), &delivery.Message)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return deliveries, err
+	}
+	return deliveries, nil
+}
+
+// Delivered removes a message from the queue, after it was sent or given up
+// on.
+func (m *PushService) Delivered(id int) (err error) {
+	_, err = m.DB.Exec("DELETE FROM push_deliveries WHERE id=?", id)
+	return err
+}
+
+// Retry counts a failed attempt to send a message and schedules the next one.
+func (m *PushService) Retry(id int, at time.Time) (err error) {
+	stmt := "UPDATE push_deliveries SET attempts=attempts+1, next_attempt_at=? WHERE id=?"
+	_, err = m.DB.Exec(stmt, at.UTC().Format(time.RFC3339), id)
+	return err
+}
@@ -0,0 +1,235 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type RecipeService struct {
+	DB *sql.DB
+}
+
+const recipeColumns = "id, user_id, name, servings, url, created_at"
+
+func scanRecipe(row scanner) (recipe Recipe, err error) {
+	var createdAtStr string
+	err = row.Scan(&recipe.Id, &recipe.UserId, &recipe.Name, &recipe.Servings, &recipe.URL, &createdAtStr)
+	if err != nil {
+		return recipe, err
+	}
+	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return recipe, err
+	}
+	recipe.CreatedAt = &createdAt
+	return recipe, nil
+}
+
+// Get returns a recipe with its ingredients.
+func (m *RecipeService) Get(id int) (recipe Recipe, err error) {
+	stmt := "SELECT " + recipeColumns + " FROM recipes WHERE id=?"
+	recipe, err = scanRecipe(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		return recipe, err
+	}
+
+	stmt = `
+		SELECT line, text, note, quantity, unit
+		FROM recipe_ingredients
+		WHERE recipe_id=?
+		ORDER BY position`
+	rows, err := m.DB.Query(stmt, id)
+	if err != nil {
+		return recipe, err
+	}
+	defer rows.Close()
+
+	recipe.Ingredients = []Ingredient{}
+	for rows.Next() {
+		var ingredient Ingredient
+		var quantity sql.NullFloat64
+		var unit sql.NullString
+		err = rows.Scan(&ingredient.Line, &ingredient.Text, &ingredient.Note, &quantity, &unit)
+		if err != nil {
+			return recipe, err
+		}
+		if quantity.Valid {
+			ingredient.Quantity = &Quantity{Amount: quantity.Float64, Unit: unit.String}
+		}
+		recipe.Ingredients = append(recipe.Ingredients, ingredient)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return recipe, err
+	}
+	return recipe, nil
+}
+
+// All returns the recipes of a user by name, without their ingredients.
+func (m *RecipeService) All(userId int) (recipes []Recipe, err error) {
+	stmt := "SELECT " + recipeColumns + " FROM recipes WHERE user_id=? ORDER BY name COLLATE NOCASE, id"
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return recipes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		recipe, err := scanRecipe(rows)
+		if err != nil {
+			return recipes, err
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return recipes, err
+	}
+	return recipes, nil
+}
+
+// Add adds a recipe with its ingredients for the user of the recipe.
+func (m *RecipeService) Add(recipe Recipe) (added Recipe, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return added, err
+	}
+	defer tx.Rollback()
+
+	stmt := "INSERT INTO recipes (user_id, name, servings, url, created_at) VALUES (?, ?, ?, ?, ?)"
+	res, err := tx.Exec(stmt, recipe.UserId, recipe.Name, recipe.Servings, recipe.URL, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return added, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+
+	stmt = `
+		INSERT INTO recipe_ingredients (recipe_id, position, line, text, note, quantity, unit)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for i, ingredient := range recipe.Ingredients {
+		quantity, unit := quantityColumns(ingredient.Quantity)
+		_, err = tx.Exec(stmt, lastInsertId, i, ingredient.Line, ingredient.Text, ingredient.Note, quantity, unit)
+		if err != nil {
+			return added, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return added, err
+	}
+	return m.Get(int(lastInsertId))
+}
+
+func (m *RecipeService) Update(id int, name string, servings int) (updated bool, err error) {
+	res, err := m.DB.Exec("UPDATE recipes SET name=?, servings=? WHERE id=?", name, servings, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Delete deletes a recipe with its ingredients and the meals it is planned
+// for.
+func (m *RecipeService) Delete(id int) (deleted bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recipe_ingredients WHERE recipe_id=?", id)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("DELETE FROM meals WHERE recipe_id=?", id)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("DELETE FROM recipes WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, tx.Commit()
+}
+
+const mealColumns = `
+	meals.id, meals.user_id, meals.date, recipes.id, recipes.name, recipes.servings,
+	meals.servings, meals.created_at`
+
+const mealTables = `
+	FROM meals
+	INNER JOIN recipes ON meals.recipe_id=recipes.id`
+
+func scanMeal(row scanner) (meal Meal, err error) {
+	var createdAtStr string
+	err = row.Scan(
+		&meal.Id, &meal.UserId, &meal.Date, &meal.Recipe.Id, &meal.Recipe.Name, &meal.Recipe.Servings,
+		&meal.Servings, &createdAtStr,
+	)
+	if err != nil {
+		return meal, err
+	}
+	meal.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return meal, err
+	}
+	return meal, nil
+}
+
+func (m *RecipeService) Meal(id int) (meal Meal, err error) {
+	stmt := "SELECT" + mealColumns + mealTables + " WHERE meals.id=?"
+	return scanMeal(m.DB.QueryRow(stmt, id))
+}
+
+// Meals returns the meals a user planned from the day from to the day to,
+// both in the format 2006-01-02 and included.
+func (m *RecipeService) Meals(userId int, from, to string) (meals []Meal, err error) {
+	stmt := "SELECT" + mealColumns + mealTables + `
+		WHERE meals.user_id=? AND meals.date BETWEEN ? AND ?
+		ORDER BY meals.date, meals.id`
+	rows, err := m.DB.Query(stmt, userId, from, to)
+	if err != nil {
+		return meals, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		meal, err := scanMeal(rows)
+		if err != nil {
+			return meals, err
+		}
+		meals = append(meals, meal)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return meals, err
+	}
+	return meals, nil
+}
+
+func (m *RecipeService) AddMeal(userId, recipeId int, date string, servings int) (meal Meal, err error) {
+	stmt := "INSERT INTO meals (user_id, recipe_id, date, servings, created_at) VALUES (?, ?, ?, ?, ?)"
+	res, err := m.DB.Exec(stmt, userId, recipeId, date, servings, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return meal, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+	return m.Meal(int(lastInsertId))
+}
+
+func (m *RecipeService) DeleteMeal(id int) (deleted bool, err error) {
+	res, err := m.DB.Exec("DELETE FROM meals WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,273 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+// SearchService searches entry texts, notes and list names. If SQLite was
+// built with FTS5 (the sqlite_fts5 build tag) it uses a full-text index ranked
+// by relevance, otherwise it falls back to substring matching.
+type SearchService struct {
+	DB *sql.DB
+
+	once sync.Once
+	fts  bool
+	err  error
+}
+
+// the highlight markers are control characters that cannot appear in the
+// escaped HTML, and are replaced with <mark> elements after escaping
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+var searchTriggers = []string{"entries_fts_insert", "entries_fts_delete", "entries_fts_update", "lists_fts_insert", "lists_fts_delete", "lists_fts_update"}
+
+func ftsAvailable(db *sql.DB) (available bool, err error) {
+	row := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')")
+	err = row.Scan(&available)
+	return available, err
+}
+
+func dropSearchTriggers(db *sql.DB) (err error) {
+	for _, trigger := range searchTriggers {
+		_, err = db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupSearch creates the full-text index and the triggers that maintain it if
+// FTS5 is available, and rebuilds it, as it is not maintained while the server
+// is not running or is built without FTS5.
+func setupSearch(db *sql.DB) (err error) {
+	available, err := ftsAvailable(db)
+	if err != nil || !available {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS entries_fts USING fts5 (
+			text, note, content='entries', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+		);
+		CREATE VIRTUAL TABLE IF NOT EXISTS lists_fts USING fts5 (
+			name, content='lists', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+		);
+
+		CREATE TRIGGER entries_fts_insert AFTER INSERT ON entries BEGIN
+			INSERT INTO entries_fts (rowid, text, note) VALUES (new.id, new.text, new.note);
+		END;
+		CREATE TRIGGER entries_fts_delete AFTER DELETE ON entries BEGIN
+			INSERT INTO entries_fts (entries_fts, rowid, text, note) VALUES ('delete', old.id, old.text, old.note);
+		END;
+		CREATE TRIGGER entries_fts_update AFTER UPDATE OF text, note ON entries BEGIN
+			INSERT INTO entries_fts (entries_fts, rowid, text, note) VALUES ('delete', old.id, old.text, old.note);
+			INSERT INTO entries_fts (rowid, text, note) VALUES (new.id, new.text, new.note);
+		END;
+
+		CREATE TRIGGER lists_fts_insert AFTER INSERT ON lists BEGIN
+			INSERT INTO lists_fts (rowid, name) VALUES (new.id, new.name);
+		END;
+		CREATE TRIGGER lists_fts_delete AFTER DELETE ON lists BEGIN
+			INSERT INTO lists_fts (lists_fts, rowid, name) VALUES ('delete', old.id, old.name);
+		END;
+		CREATE TRIGGER lists_fts_update AFTER UPDATE OF name ON lists BEGIN
+			INSERT INTO lists_fts (lists_fts, rowid, name) VALUES ('delete', old.id, old.name);
+			INSERT INTO lists_fts (rowid, name) VALUES (new.id, new.name);
+		END;
+
+		INSERT INTO entries_fts (entries_fts) VALUES ('rebuild');
+		INSERT INTO lists_fts (lists_fts) VALUES ('rebuild');`)
+	return err
+}
+
+// Search returns the entries and lists of the lists a user is a member of that
+// contain every word of query, including completed entries and entries in the
+// trash. Words match at the start of a word with FTS5 and anywhere otherwise.
+func (m *SearchService) Search(userId int, query string, offset, limit int) (page SearchPage, err error) {
+	terms := strings.Fields(query)
+	page.Results = []SearchResult{}
+	if len(terms) == 0 {
+		return page, nil
+	}
+
+	m.once.Do(func() {
+		m.fts, m.err = ftsAvailable(m.DB)
+	})
+	if m.err != nil {
+		return page, m.err
+	}
+
+	var rows *sql.Rows
+	if m.fts {
+		rows, err = m.queryIndex(userId, terms, offset, limit+1)
+	} else {
+		rows, err = m.queryTables(userId, terms, offset, limit+1)
+	}
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result SearchResult
+		var entryId sql.NullInt64
+		var first, second string
+		var score float64
+		err = rows.Scan(&result.Type, &result.ListId, &result.ListName, &entryId, &first, &second, &score)
+		if err != nil {
+			return page, err
+		}
+		if !m.fts {
+			first, second = markTerms(first, terms), markTerms(second, terms)
+		}
+
+		if result.Type == SearchResultList {
+			result.Highlights = []Highlight{{Field: "name", Text: formatHighlight(first)}}
+		} else {
+			result.Highlights = []Highlight{{Field: "text", Text: formatHighlight(first)}}
+			if strings.Contains(second, markStart) {
+				result.Highlights = append(result.Highlights, Highlight{Field: "note", Text: formatHighlight(second)})
+			}
+
+			row := m.DB.QueryRow("SELECT"+entryColumns+" FROM entries WHERE id=?", entryId.Int64)
+			entry, err := scanEntry(row)
+			if err != nil {
+				return page, err
+			}
+			result.Entry = &entry
+		}
+		page.Results = append(page.Results, result)
+	}
+	err = rows.Err()
+	if err != nil {
+		return page, err
+	}
+
+	if len(page.Results) > limit {
+		page.Results = page.Results[:limit]
+		page.NextOffset = offset + limit
+	}
+	return page, nil
+}
+
+// searchableLists selects the lists a user can search in.
+const searchableLists = `
+	SELECT list_id FROM list_members
+	INNER JOIN lists ON lists.id=list_members.list_id
+	WHERE list_members.user_id=? AND lists.deleted_at IS NULL`
+
+func (m *SearchService) queryIndex(userId int, terms []string, offset, limit int) (rows *sql.Rows, err error) {
+	// every term is quoted so that FTS5 operators in it are taken literally,
+	// and matches as a prefix
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	match := strings.Join(quoted, " ")
+
+	stmt := fmt.Sprintf(`
+		SELECT 'list', lists.id, lists.name, NULL,
+			highlight(lists_fts, 0, '%[1]s', '%[2]s'), '', bm25(lists_fts) AS score
+		FROM lists_fts
+		INNER JOIN lists ON lists.id=lists_fts.rowid
+		WHERE lists_fts MATCH ? AND lists.id IN (`+searchableLists+`)
+		UNION ALL
+		SELECT 'entry', lists.id, lists.name, entries.id,
+			highlight(entries_fts, 0, '%[1]s', '%[2]s'), highlight(entries_fts, 1, '%[1]s', '%[2]s'),
+			bm25(entries_fts, 2.0, 1.0) AS score
+		FROM entries_fts
+		INNER JOIN entries ON entries.id=entries_fts.rowid
+		INNER JOIN lists ON lists.id=entries.list_id
+		WHERE entries_fts MATCH ? AND entries.list_id IN (`+searchableLists+`)
+		ORDER BY score, 1 DESC, 4 DESC
+		LIMIT ? OFFSET ?`, markStart, markEnd)
+	return m.DB.Query(stmt, match, userId, match, userId, limit, offset)
+}
+
+func (m *SearchService) queryTables(userId int, terms []string, offset, limit int) (rows *sql.Rows, err error) {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	var listConditions, entryConditions []string
+	var listArgs, entryArgs []any
+	for _, term := range terms {
+		pattern := "%" + escape.Replace(term) + "%"
+		listConditions = append(listConditions, `lists.name LIKE ? ESCAPE '\'`)
+		listArgs = append(listArgs, pattern)
+		entryConditions = append(entryConditions, `(entries.text LIKE ? ESCAPE '\' OR entries.note LIKE ? ESCAPE '\')`)
+		entryArgs = append(entryArgs, pattern, pattern)
+	}
+
+	// without a relevance score lists come first, then entries that are still
+	// to be bought, then completed ones and the trash, newest first
+	stmt := `
+		SELECT 'list', lists.id, lists.name, NULL, lists.name, '', 0 AS score
+		FROM lists
+		WHERE ` + strings.Join(listConditions, " AND ") + ` AND lists.id IN (` + searchableLists + `)
+		UNION ALL
+		SELECT 'entry', lists.id, lists.name, entries.id, entries.text, entries.note,
+			1 + entries.completed + 2*(entries.deleted_at IS NOT NULL) AS score
+		FROM entries
+		INNER JOIN lists ON lists.id=entries.list_id
+		WHERE ` + strings.Join(entryConditions, " AND ") + ` AND entries.list_id IN (` + searchableLists + `)
+		ORDER BY score, 4 DESC, 2 DESC
+		LIMIT ? OFFSET ?`
+	args := append(listArgs, userId)
+	args = append(args, entryArgs...)
+	args = append(args, userId, limit, offset)
+	return m.DB.Query(stmt, args...)
+}
+
+// markTerms marks every case-insensitive occurrence of the terms in text the
+// way the FTS5 highlight function does.
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, term := range terms {
+			n := prefixFold(text[i:], term)
+			if n > matched {
+				matched = n
+			}
+		}
+		if matched > 0 {
+			b.WriteString(markStart + text[i:i+matched] + markEnd)
+			i += matched
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// prefixFold returns the length in bytes of the prefix of s that equals term
+// under case folding, or 0 if s does not start with term.
+func prefixFold(s, term string) int {
+	n := 0
+	for _, r := range term {
+		if n >= len(s) {
+			return 0
+		}
+		sr, size := utf8.DecodeRuneInString(s[n:])
+		if !strings.EqualFold(string(sr), string(r)) {
+			return 0
+		}
+		n += size
+	}
+	return n
+}
+
+func formatHighlight(marked string) string {
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(marked))
+}
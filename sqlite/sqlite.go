@@ -2,11 +2,66 @@ package sqlite
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func Open(dsn string) (db *sql.DB, err error) {
 	db, err = sql.Open("sqlite3", dsn)
-	return db, err
+	if err != nil {
+		return db, err
+	}
+
+	// the search index is kept up to date by triggers, which are dropped while
+	// migrating so that migrations can freely change the indexed tables
+	err = dropSearchTriggers(db)
+	if err != nil {
+		return db, err
+	}
+	err = migrate(db)
+	if err != nil {
+		return db, err
+	}
+	err = setupSearch(db)
+	if err != nil {
+		return db, err
+	}
+	return db, nil
+}
+
+// migrate applies every migration the database has not seen yet. The number
+// of applied migrations is kept in the user_version pragma.
+func migrate(db *sql.DB) (err error) {
+	var version int
+	row := db.QueryRow("PRAGMA user_version")
+	err = row.Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		err = migrations[i](tx)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error: migration %d failed: %w", i+1, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version=%d", i+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
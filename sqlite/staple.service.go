@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type StapleService struct {
+	DB *sql.DB
+}
+
+const stapleColumns = "id, list_id, text, category, every_days, weekday, next_at, created_by, created_at"
+
+func scanStaple(row scanner) (staple Staple, err error) {
+	var everyDays, weekday sql.NullInt64
+	var nextAtStr, createdAtStr string
+	err = row.Scan(
+		&staple.Id, &staple.ListId, &staple.Text, &staple.Category,
+		&everyDays, &weekday, &nextAtStr, &staple.CreatedBy, &createdAtStr,
+	)
+	if err != nil {
+		return staple, err
+	}
+
+	staple.Recurrence.Days = int(everyDays.Int64)
+	if weekday.Valid {
+		day := time.Weekday(weekday.Int64)
+		staple.Recurrence.Weekday = &day
+	}
+	staple.NextAt, err = time.Parse(time.RFC3339, nextAtStr)
+	if err != nil {
+		return staple, err
+	}
+	staple.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return staple, err
+	}
+	return staple, nil
+}
+
+func recurrenceColumns(recurrence Recurrence) (everyDays, weekday sql.NullInt64) {
+	if recurrence.Weekday != nil {
+		return everyDays, sql.NullInt64{Int64: int64(*recurrence.Weekday), Valid: true}
+	}
+	return sql.NullInt64{Int64: int64(recurrence.Days), Valid: true}, weekday
+}
+
+func (m *StapleService) Get(id int) (staple Staple, err error) {
+	stmt := "SELECT " + stapleColumns + " FROM staples WHERE id=?"
+	row := m.DB.QueryRow(stmt, id)
+
+	return scanStaple(row)
+}
+
+func (m *StapleService) All(listId int) (staples []Staple, err error) {
+	stmt := "SELECT " + stapleColumns + " FROM staples WHERE list_id=? ORDER BY next_at, id"
+	return m.query(stmt, listId)
+}
+
+// Due returns the staples of all lists that are due at t.
+func (m *StapleService) Due(t time.Time) (staples []Staple, err error) {
+	stmt := `
+		SELECT ` + stapleColumns + `
+		FROM staples
+		WHERE next_at<=? AND list_id IN (SELECT id FROM lists WHERE deleted_at IS NULL)
+		ORDER BY next_at, id`
+	return m.query(stmt, t.UTC().Format(time.RFC3339))
+}
+
+func (m *StapleService) query(stmt string, args ...any) (staples []Staple, err error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return staples, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		staple, err := scanStaple(rows)
+		if err != nil {
+			return staples, err
+		}
+		staples = append(staples, staple)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return staples, err
+	}
+	return staples, nil
+}
+
+func (m *StapleService) Add(userId, listId int, text, category string, recurrence Recurrence) (staple Staple, err error) {
+	createdAt := time.Now()
+	nextAt := recurrence.Next(createdAt)
+	everyDays, weekday := recurrenceColumns(recurrence)
+	stmt := `
+		INSERT INTO staples (list_id, text, category, every_days, weekday, next_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := m.DB.Exec(stmt, listId, text, category, everyDays, weekday,
+		nextAt.UTC().Format(time.RFC3339), userId, createdAt.Format(time.RFC3339))
+	if err != nil {
+		return staple, err
+	}
+
+	lastInsertId, _ := res.LastInsertId()
+	return m.Get(int(lastInsertId))
+}
+
+// Update changes a staple and schedules its next occurrence according to the
+// new recurrence.
+func (m *StapleService) Update(id int, text, category string, recurrence Recurrence) (updated bool, err error) {
+	nextAt := recurrence.Next(time.Now())
+	everyDays, weekday := recurrenceColumns(recurrence)
+	stmt := "UPDATE staples SET text=?, category=?, every_days=?, weekday=?, next_at=? WHERE id=?"
+	res, err := m.DB.Exec(stmt, text, category, everyDays, weekday, nextAt.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Reschedule sets the next occurrence of a staple after it has been added.
+func (m *StapleService) Reschedule(id int, nextAt time.Time) (err error) {
+	stmt := "UPDATE staples SET next_at=? WHERE id=?"
+	_, err = m.DB.Exec(stmt, nextAt.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func (m *StapleService) Delete(id int) (deleted bool, err error) {
+	stmt := "DELETE FROM staples WHERE id=?"
+	res, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
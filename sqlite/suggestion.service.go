@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type SuggestionService struct {
+	DB *sql.DB
+}
+
+// Suggest returns completions for prefix from the entries a user has had on
+// their lists, including completed and deleted ones. Items that were used
+// often and recently rank first, and items from the given list count double.
+func (m *SuggestionService) Suggest(userId, listId int, prefix string, limit int) (suggestions []Suggestion, err error) {
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	stmt := `
+		SELECT text, category, list_id, created_at
+		FROM entries
+		WHERE list_id IN (SELECT list_id FROM list_members WHERE user_id=?)
+			AND (text LIKE ? ESCAPE '\' OR text LIKE ? ESCAPE '\')
+		ORDER BY created_at DESC, id DESC
+		LIMIT 5000`
+	rows, err := m.DB.Query(stmt, userId, pattern+"%", "% "+pattern+"%")
+	if err != nil {
+		return suggestions, err
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		suggestion Suggestion
+		score      float64
+		ownList    bool
+	}
+	candidates := map[string]*candidate{}
+	now := time.Now()
+	for rows.Next() {
+		var text, category, createdAtStr string
+		var entryListId int
+		err = rows.Scan(&text, &category, &entryListId, &createdAtStr)
+		if err != nil {
+			return suggestions, err
+		}
+		createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return suggestions, err
+		}
+
+		key := strings.ToLower(strings.TrimSpace(text))
+		c := candidates[key]
+		if c == nil {
+			// rows are newest first, so the first one sets text and category
+			c = &candidate{suggestion: Suggestion{Text: text, Category: category, LastUsed: createdAt}}
+			candidates[key] = c
+		}
+		if entryListId == listId && !c.ownList {
+			c.ownList = true
+			c.suggestion.Category = category
+		}
+
+		// each use counts less the older it is, halving every 30 days
+		weight := math.Pow(0.5, now.Sub(createdAt).Hours()/24/30)
+		if entryListId == listId {
+			weight *= 2
+		}
+		c.score += weight
+		c.suggestion.Count++
+	}
+	err = rows.Err()
+	if err != nil {
+		return suggestions, err
+	}
+
+	lowerPrefix := strings.ToLower(prefix)
+	ranked := []*candidate{}
+	for key, c := range candidates {
+		// items starting with the prefix beat items that only contain a word
+		// starting with it
+		if !strings.HasPrefix(key, lowerPrefix) {
+			c.score /= 4
+		}
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].suggestion.Text < ranked[j].suggestion.Text
+	})
+
+	suggestions = []Suggestion{}
+	for i := 0; i < len(ranked) && i < limit; i++ {
+		suggestions = append(suggestions, ranked[i].suggestion)
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type TemplateService struct {
+	DB *sql.DB
+}
+
+const templateColumns = "id, name, description, color, icon, emoji, creator_id, created_at"
+
+func scanTemplate(row scanner) (template Template, err error) {
+	var createdAtStr string
+	err = row.Scan(
+		&template.Id, &template.Name, &template.Description, &template.Color, &template.Icon, &template.Emoji,
+		&template.CreatorId, &createdAtStr,
+	)
+	if err != nil {
+		return template, err
+	}
+	template.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return template, err
+	}
+	return template, nil
+}
+
+func (m *TemplateService) Get(id int) (template Template, err error) {
+	stmt := "SELECT " + templateColumns + " FROM templates WHERE id=?"
+	template, err = scanTemplate(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		return template, err
+	}
+
+	template.Entries, err = templateEntries(m.DB, id)
+	if err != nil {
+		return template, err
+	}
+	return template, nil
+}
+
+// All returns the templates a user has saved.
+func (m *TemplateService) All(userId int) (templates []Template, err error) {
+	stmt := "SELECT " + templateColumns + " FROM templates WHERE creator_id=? ORDER BY name COLLATE NOCASE, id"
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return templates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return templates, err
+		}
+		templates = append(templates, template)
+	}
+	err = rows.Err()
+	if err != nil {
+		return templates, err
+	}
+
+	for i := range templates {
+		templates[i].Entries, err = templateEntries(m.DB, templates[i].Id)
+		if err != nil {
+			return templates, err
+		}
+	}
+	return templates, nil
+}
+
+func templateEntries(db *sql.DB, templateId int) (entries []TemplateEntry, err error) {
+	stmt := `
+		SELECT text, category, note, price, currency, quantity, unit, rank
+		FROM template_entries
+		WHERE template_id=?
+		ORDER BY category, rank, id`
+	rows, err := db.Query(stmt, templateId)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	entries = []TemplateEntry{}
+	for rows.Next() {
+		var entry TemplateEntry
+		var price sql.NullInt64
+		var currency, unit sql.NullString
+		var quantity sql.NullFloat64
+		err = rows.Scan(&entry.Text, &entry.Category, &entry.Note, &price, &currency, &quantity, &unit, &entry.Rank)
+		if err != nil {
+			return entries, err
+		}
+		if price.Valid {
+			entry.Price = &Price{Amount: int(price.Int64), Currency: currency.String}
+		}
+		if quantity.Valid {
+			entry.Quantity = &Quantity{Amount: quantity.Float64, Unit: unit.String}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Add saves a list with its appearance and its entries, completed or not, as
+// a template of userId.
+func (m *TemplateService) Add(userId, listId int, name string) (template Template, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return template, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		INSERT INTO templates (name, description, color, icon, emoji, creator_id, created_at)
+		SELECT ?, description, color, icon, emoji, ?, ? FROM lists WHERE id=? AND deleted_at IS NULL`
+	res, err := tx.Exec(stmt, name, userId, time.Now().Format(time.RFC3339), listId)
+	if err != nil {
+		return template, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return template, sql.ErrNoRows
+	}
+	lastInsertId, _ := res.LastInsertId()
+
+	stmt = `
+		INSERT INTO template_entries (template_id, text, category, note, price, currency, quantity, unit, rank)
+		SELECT ?, text, category, note, price, currency, quantity, unit, rank
+		FROM entries
+		WHERE list_id=? AND deleted_at IS NULL`
+	_, err = tx.Exec(stmt, lastInsertId, listId)
+	if err != nil {
+		return template, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return template, err
+	}
+	return m.Get(int(lastInsertId))
+}
+
+func (m *TemplateService) Delete(id int) (deleted bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM template_entries WHERE template_id=?", id)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("DELETE FROM templates WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// Instantiate creates a new list owned by userId from a template and returns
+// its id.
+func (m *TemplateService) Instantiate(userId, id int, name string) (listId int, err error) {
+	template, err := m.Get(id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	listId, err = insertList(tx, userId, List{
+		Name:        name,
+		Description: template.Description,
+		Color:       template.Color,
+		Icon:        template.Icon,
+		Emoji:       template.Emoji,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range template.Entries {
+		_, err = insertEntry(tx, userId, Entry{
+			ListId:   listId,
+			Text:     entry.Text,
+			Category: entry.Category,
+			Note:     entry.Note,
+			Price:    entry.Price,
+			Quantity: entry.Quantity,
+			Rank:     entry.Rank,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return listId, tx.Commit()
+}
@@ -0,0 +1,261 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+)
+
+type TrashService struct {
+	DB        *sql.DB
+	Retention time.Duration
+}
+
+func (m *TrashService) Entries(listId int) (entries []Entry, err error) {
+	stmt := "SELECT" + entryColumns + `
+		FROM entries
+		WHERE list_id=? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id`
+	rows, err := m.DB.Query(stmt, listId)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// Lists returns the deleted lists created by a user.
+func (m *TrashService) Lists(userId int) (lists []List, err error) {
+	stmt := `
+		SELECT lists.id, lists.name, users.id, users.username, lists.deleted_at
+		FROM lists
+		INNER JOIN users ON lists.creator_id=users.id
+		WHERE lists.creator_id=? AND lists.deleted_at IS NOT NULL
+		ORDER BY lists.deleted_at DESC`
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return []List{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var list List
+		var deletedAtStr string
+		err = rows.Scan(&list.Id, &list.Name, &list.Creator.Id, &list.Creator.Username, &deletedAtStr)
+		if err != nil {
+			return lists, err
+		}
+		deletedAt, err := time.Parse(time.RFC3339, deletedAtStr)
+		if err != nil {
+			return lists, err
+		}
+		list.DeletedAt = &deletedAt
+
+		lists = append(lists, list)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return lists, err
+	}
+	return lists, nil
+}
+
+// GetList returns a deleted list.
+func (m *TrashService) GetList(id int) (list List, err error) {
+	stmt := `
+		SELECT lists.id, lists.name, users.id, users.username
+		FROM lists
+		INNER JOIN users ON lists.creator_id=users.id
+		WHERE lists.id=? AND lists.deleted_at IS NOT NULL`
+	row := m.DB.QueryRow(stmt, id)
+
+	err = row.Scan(&list.Id, &list.Name, &list.Creator.Id, &list.Creator.Username)
+	if err != nil {
+		return list, err
+	}
+	return list, nil
+}
+
+// GetEntry returns a deleted entry.
+func (m *TrashService) GetEntry(id int) (entry Entry, err error) {
+	stmt := "SELECT" + entryColumns + " FROM entries WHERE id=? AND deleted_at IS NOT NULL"
+	row := m.DB.QueryRow(stmt, id)
+
+	return scanEntry(row)
+}
+
+func (m *TrashService) RestoreEntry(userId, id int) (restored bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	restored, err = restoreEntries(tx, userId, "SELECT id FROM entries WHERE id=? AND deleted_at IS NOT NULL", id)
+	if err != nil || !restored {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func restoreEntries(tx *sql.Tx, userId int, stmt string, args ...any) (restored bool, err error) {
+	ids, err := queryIds(tx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range ids {
+		_, err = changeEntry(tx, userId, id, ActionRestored, func() error {
+			stmt := "UPDATE entries SET deleted_at=NULL, deletion_token=NULL WHERE id=?"
+			_, err := tx.Exec(stmt, id)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(ids) > 0, nil
+}
+
+func (m *TrashService) RestoreList(id int) (restored bool, err error) {
+	stmt := "UPDATE lists SET deleted_at=NULL, deletion_token=NULL WHERE id=? AND deleted_at IS NOT NULL"
+	res, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// GetUndo looks up the deletion an undo token was issued for. isList reports
+// whether a whole list was deleted rather than entries of it.
+func (m *TrashService) GetUndo(token string) (undo Undo, isList bool, err error) {
+	stmt := `
+		SELECT id, deleted_at, TRUE FROM lists WHERE deletion_token=?
+		UNION ALL
+		SELECT list_id, deleted_at, FALSE FROM entries WHERE deletion_token=?
+		LIMIT 1`
+	row := m.DB.QueryRow(stmt, token, token)
+
+	var deletedAtStr string
+	err = row.Scan(&undo.ListId, &deletedAtStr, &isList)
+	if err != nil {
+		return undo, false, err
+	}
+	deletedAt, err := time.Parse(time.RFC3339, deletedAtStr)
+	if err != nil {
+		return undo, false, err
+	}
+	undo.Token = token
+	undo.ExpiresAt = deletedAt.Add(m.Retention)
+	return undo, isList, nil
+}
+
+// Undo restores everything that was deleted together with the given token.
+func (m *TrashService) Undo(userId int, token string) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := "UPDATE lists SET deleted_at=NULL, deletion_token=NULL WHERE deletion_token=?"
+	_, err = tx.Exec(stmt, token)
+	if err != nil {
+		return err
+	}
+	_, err = restoreEntries(tx, userId, "SELECT id FROM entries WHERE deletion_token=?", token)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge permanently removes everything that has been in the trash for longer
+// than the retention period, including the entries, members and invitations
+// of purged lists. It returns the blob keys of the purged attachments, which
+// the caller has to delete from the blob store.
+func (m *TrashService) Purge() (keys []string, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return keys, err
+	}
+	defer tx.Rollback()
+
+	before := time.Now().Add(-m.Retention).UTC().Format(time.RFC3339)
+	stmts := []string{
+		"DELETE FROM entries WHERE deleted_at<?",
+		"DELETE FROM lists WHERE deleted_at<?",
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt, before)
+		if err != nil {
+			return keys, err
+		}
+	}
+
+	stmts = []string{
+		"DELETE FROM entries WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM list_members WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM invitations WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM entry_history WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM staples WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM category_rules WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM invite_links WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM join_requests WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE list_id NOT IN (SELECT id FROM lists))",
+		"DELETE FROM webhooks WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM ingest_aliases WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM pantry_items WHERE list_id NOT IN (SELECT id FROM lists)",
+		"DELETE FROM pantry_restocks WHERE entry_id NOT IN (SELECT id FROM entries) OR item_id NOT IN (SELECT id FROM pantry_items)",
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt)
+		if err != nil {
+			return keys, err
+		}
+	}
+
+	stmt := "SELECT key, thumbnail_key FROM attachments WHERE entry_id NOT IN (SELECT id FROM entries)"
+	rows, err := tx.Query(stmt)
+	if err != nil {
+		return keys, err
+	}
+	for rows.Next() {
+		var key, thumbnailKey string
+		err = rows.Scan(&key, &thumbnailKey)
+		if err != nil {
+			rows.Close()
+			return keys, err
+		}
+		keys = append(keys, key, thumbnailKey)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return keys, err
+	}
+
+	stmt = "DELETE FROM attachments WHERE entry_id NOT IN (SELECT id FROM entries)"
+	_, err = tx.Exec(stmt)
+	if err != nil {
+		return keys, err
+	}
+	return keys, tx.Commit()
+}
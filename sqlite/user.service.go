@@ -20,3 +20,13 @@ func (m *UserService) GetUser(username string) (user User, err error) {
 	}
 	return user, nil
 }
+
+// Get returns the user with an id, without their password hash.
+func (m *UserService) Get(id int) (user User, err error) {
+	stmt := "SELECT id, username FROM users WHERE id=?"
+	err = m.DB.QueryRow(stmt, id).Scan(&user.Id, &user.Username)
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
@@ -0,0 +1,346 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	. "github.com/slh335/shoppinglistserver"
+	"github.com/slh335/shoppinglistserver/crypto"
+)
+
+type WebhookService struct {
+	DB *sql.DB
+}
+
+const webhookColumns = "id, list_id, url, events, created_by, created_at"
+
+func scanWebhook(row scanner) (webhook Webhook, err error) {
+	var events, createdAtStr string
+	err = row.Scan(&webhook.Id, &webhook.ListId, &webhook.URL, &events, &webhook.CreatedBy, &createdAtStr)
+	if err != nil {
+		return webhook, err
+	}
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	webhook.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return webhook, err
+	}
+	return webhook, nil
+}
+
+func (m *WebhookService) Get(id int) (webhook Webhook, err error) {
+	stmt := "SELECT " + webhookColumns + " FROM webhooks WHERE id=?"
+	return scanWebhook(m.DB.QueryRow(stmt, id))
+}
+
+// All returns the webhooks of a list, without their secrets.
+func (m *WebhookService) All(listId int) (webhooks []Webhook, err error) {
+	stmt := "SELECT " + webhookColumns + " FROM webhooks WHERE list_id=? ORDER BY id"
+	rows, err := m.DB.Query(stmt, listId)
+	if err != nil {
+		return webhooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return webhooks, err
+	}
+	return webhooks, nil
+}
+
+// Add adds a webhook to a list. A secret is generated if it has none.
+func (m *WebhookService) Add(webhook Webhook) (_ Webhook, err error) {
+	if webhook.Secret == "" {
+		webhook.Secret = crypto.GenerateToken(32)
+	}
+	webhook.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	stmt := "INSERT INTO webhooks (list_id, url, secret, events, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := m.DB.Exec(stmt, webhook.ListId, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","),
+		webhook.CreatedBy, webhook.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return webhook, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+	webhook.Id = int(lastInsertId)
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	return webhook, nil
+}
+
+// Update changes the URL and events of a webhook, and its secret unless the
+// new one is empty.
+func (m *WebhookService) Update(webhook Webhook) (updated bool, err error) {
+	stmt := "UPDATE webhooks SET url=?, events=?, secret=coalesce(nullif(?, ''), secret) WHERE id=?"
+	res, err := m.DB.Exec(stmt, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, webhook.Id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// Delete removes a webhook along with its deliveries.
+func (m *WebhookService) Delete(id int) (deleted bool, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id=?", id)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("DELETE FROM webhooks WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, tx.Commit()
+}
+
+// Target returns the URL and secret a delivery of a webhook is sent with.
+func (m *WebhookService) Target(id int) (url, secret string, err error) {
+	err = m.DB.QueryRow("SELECT url, secret FROM webhooks WHERE id=?", id).Scan(&url, &secret)
+	return url, secret, err
+}
+
+// Enqueue queues the payload of an event for every webhook of the list that
+// receives events of its type, to be sent at the given time.
+func (m *WebhookService) Enqueue(listId int, eventType string, payload []byte, at time.Time) (err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := "SELECT " + webhookColumns + " FROM webhooks WHERE list_id=?"
+	rows, err := tx.Query(stmt, listId)
+	if err != nil {
+		return err
+	}
+	var webhookIds []int
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if webhook.Receives(eventType) {
+			webhookIds = append(webhookIds, webhook.Id)
+		}
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, webhookId := range webhookIds {
+		_, err = addDelivery(tx, webhookId, eventType, payload, at)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddDelivery queues the payload of an event for a single webhook.
+func (m *WebhookService) AddDelivery(webhookId int, eventType string, payload []byte, at time.Time) (delivery WebhookDelivery, err error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return delivery, err
+	}
+	defer tx.Rollback()
+
+	id, err := addDelivery(tx, webhookId, eventType, payload, at)
+	if err != nil {
+		return delivery, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return delivery, err
+	}
+	return m.Delivery(id)
+}
+
+func addDelivery(tx *sql.Tx, webhookId int, eventType string, payload []byte, at time.Time) (id int, err error) {
+	stmt := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := tx.Exec(stmt, webhookId, eventType, string(payload), DeliveryPending,
+		time.Now().UTC().Format(time.RFC3339), at.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	lastInsertId, _ := res.LastInsertId()
+	return int(lastInsertId), nil
+}
+
+const webhookDeliveryColumns = `
+	id, webhook_id, event, payload, status, attempts, response_status, error,
+	created_at, next_attempt_at, delivered_at`
+
+func scanWebhookDelivery(row scanner) (delivery WebhookDelivery, err error) {
+	var payload, createdAtStr string
+	var responseStatus sql.NullInt64
+	var nextAttemptAtStr, deliveredAtStr sql.NullString
+	err = row.Scan(
+		&delivery.Id, &delivery.WebhookId, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&responseStatus, &delivery.Error, &createdAtStr, &nextAttemptAtStr, &deliveredAtStr,
+	)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = []byte(payload)
+	delivery.ResponseStatus = int(responseStatus.Int64)
+
+	delivery.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return delivery, err
+	}
+	if nextAttemptAtStr.Valid {
+		nextAttemptAt, err := time.Parse(time.RFC3339, nextAttemptAtStr.String)
+		if err != nil {
+			return delivery, err
+		}
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	if deliveredAtStr.Valid {
+		deliveredAt, err := time.Parse(time.RFC3339, deliveredAtStr.String)
+		if err != nil {
+			return delivery, err
+		}
+		delivery.DeliveredAt = &deliveredAt
+	}
+	return delivery, nil
+}
+
+func (m *WebhookService) Delivery(id int) (delivery WebhookDelivery, err error) {
+	stmt := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE id=?"
+	return scanWebhookDelivery(m.DB.QueryRow(stmt, id))
+}
+
+var webhookDeliverySorts = map[string]sortOrder[WebhookDelivery]{
+	SortCreated: {
+		{expr: "id", desc: true, value: func(d WebhookDelivery) any { return d.Id }},
+	},
+}
+
+// Deliveries returns a page of the deliveries of a webhook, newest first.
+// Only the Status and CreatedSince filters apply to deliveries.
+func (m *WebhookService) Deliveries(webhookId int, filter Filter) (deliveries []WebhookDelivery, next string, err error) {
+	sortName := filter.Sort
+	if sortName == "" {
+		sortName = SortCreated
+	}
+	order, ok := lookupSort(webhookDeliverySorts, sortName)
+	if !ok {
+		return deliveries, "", ErrInvalidSort
+	}
+
+	var s selection
+	s.where("webhook_id=?", webhookId)
+	if filter.Status != "" {
+		s.where("status=?", filter.Status)
+	}
+	if filter.CreatedSince != nil {
+		s.where("unixepoch(created_at)>=?", filter.CreatedSince.Unix())
+	}
+	clauses, clauseArgs, err := order.paginate(&s, sortName, filter.Cursor, filter.Limit)
+	if err != nil {
+		return deliveries, "", err
+	}
+
+	stmt := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries" + s.String() + clauses
+	rows, err := m.DB.Query(stmt, append(s.args, clauseArgs...)...)
+	if err != nil {
+		return deliveries, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, "", err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return deliveries, "", err
+	}
+	deliveries, next = page(order, sortName, deliveries, filter.Limit)
+	return deliveries, next, nil
+}
+
+// Due returns up to limit pending deliveries that are due to be sent at now,
+// oldest first.
+func (m *WebhookService) Due(now time.Time, limit int) (deliveries []WebhookDelivery, err error) {
+	stmt := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE status=? AND unixepoch(next_attempt_at)<=?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`
+	rows, err := m.DB.Query(stmt, DeliveryPending, now.Unix(), limit)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return deliveries, err
+	}
+	return deliveries, nil
+}
+
+// Attempted logs an attempt to send a delivery at now. Deliveries that are
+// still pending are retried at next; delivered and failed ones are done.
+func (m *WebhookService) Attempted(id int, status string, responseStatus int, errMessage string, now, next time.Time) (err error) {
+	var nextAttemptAt, deliveredAt sql.NullString
+	switch status {
+	case DeliveryPending:
+		nextAttemptAt = sql.NullString{String: next.UTC().Format(time.RFC3339), Valid: true}
+	case DeliveryDelivered:
+		deliveredAt = sql.NullString{String: now.UTC().Format(time.RFC3339), Valid: true}
+	}
+	stmt := `
+		UPDATE webhook_deliveries
+		SET status=?, attempts=attempts+1, response_status=nullif(?, 0), error=?, next_attempt_at=?, delivered_at=?
+		WHERE id=?`
+	_, err = m.DB.Exec(stmt, status, responseStatus, errMessage, nextAttemptAt, deliveredAt, id)
+	return err
+}
+
+// Prune deletes the deliveries that were done before the given time.
+func (m *WebhookService) Prune(before time.Time) (err error) {
+	stmt := "DELETE FROM webhook_deliveries WHERE status!=? AND unixepoch(created_at)<?"
+	_, err = m.DB.Exec(stmt, DeliveryPending, before.Unix())
+	return err
+}
@@ -0,0 +1,82 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// MaxPixels is the largest number of pixels of images that are decoded. Small
+// files can declare huge dimensions, which would take gigabytes to decode.
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels.
+var ErrTooLarge = errors.New("error: image has too many pixels")
+
+// Generate decodes a JPEG, PNG or GIF image and returns a JPEG scaled down to
+// fit into a square of size pixels, along with the original dimensions.
+// Images with more than MaxPixels pixels are rejected before decoding.
+func Generate(r io.Reader, size int) (thumbnail []byte, width, height int, err error) {
+	// the header read for the dimensions is decoded again with the rest
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxPixels/config.Height {
+		return nil, 0, 0, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := src.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+
+	scaledWidth, scaledHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			scaledWidth, scaledHeight = size, max(1, height*size/width)
+		} else {
+			scaledWidth, scaledHeight = max(1, width*size/height), size
+		}
+	}
+
+	// every target pixel is the average of the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		y0 := bounds.Min.Y + y*height/scaledHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/scaledHeight)
+		for x := 0; x < scaledWidth; x++ {
+			x0 := bounds.Min.X + x*width/scaledWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/scaledWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			// JPEG has no alpha channel, so transparent areas turn white
+			white := 0xffff*n - a
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8((r + white) / n >> 8)
+			dst.Pix[i+1] = uint8((g + white) / n >> 8)
+			dst.Pix[i+2] = uint8((b + white) / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), width, height, nil
+}
@@ -1,31 +1,227 @@
 package shoppinglistserver
 
 import (
+	"encoding/json"
+	"math"
+	"slices"
 	"time"
 )
 
 type List struct {
-	Id      int     `json:"id"`
-	Name    string  `json:"name"`
-	Creator User    `json:"creator,omitempty"`
-	Entries []Entry `json:"entries,omitempty"`
-	Members []User  `json:"members,omitempty"`
+	Id          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Color       string     `json:"color,omitempty"`
+	Icon        string     `json:"icon,omitempty"`
+	Emoji       string     `json:"emoji,omitempty"`
+	Creator     User       `json:"creator,omitempty"`
+	Entries     []Entry    `json:"entries,omitempty"`
+	Members     []User     `json:"members,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
 }
 
+// Template is a saved list that new lists can be created from. Templates are
+// private to the user who saved them.
+type Template struct {
+	Id          int             `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Color       string          `json:"color,omitempty"`
+	Icon        string          `json:"icon,omitempty"`
+	Emoji       string          `json:"emoji,omitempty"`
+	CreatorId   int             `json:"creatorId"`
+	Entries     []TemplateEntry `json:"entries"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+type TemplateEntry struct {
+	Text     string    `json:"text"`
+	Category string    `json:"category"`
+	Note     string    `json:"note,omitempty"`
+	Price    *Price    `json:"price,omitempty"`
+	Quantity *Quantity `json:"quantity,omitempty"`
+	Rank     string    `json:"-"`
+}
+
+// Roles of list members. Owners can do everything, editors can change the
+// entries and settings of a list, and viewers can only read it.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
 type Entry struct {
-	Id         int       `json:"id"`
-	ListId     int       `json:"listId"`
-	Text       string    `json:"text"`
-	Category   string    `json:"category"`
-	OrderIndex int       `json:"orderIndex"`
-	Completed  bool      `json:"completed"`
-	CreatedAt  time.Time `json:"createdAt"`
+	Id          int          `json:"id"`
+	ListId      int          `json:"listId"`
+	Text        string       `json:"text"`
+	Category    string       `json:"category"`
+	Note        string       `json:"note,omitempty"`
+	Price       *Price       `json:"price,omitempty"`
+	Quantity    *Quantity    `json:"quantity,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Rank        string       `json:"rank"`
+	Completed   bool         `json:"completed"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	CreatedBy   int          `json:"createdBy,omitempty"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+	CompletedBy int          `json:"completedBy,omitempty"`
+	CompletedAt *time.Time   `json:"completedAt,omitempty"`
+	DeletedAt   *time.Time   `json:"deletedAt,omitempty"`
+}
+
+// Quantity is how much of an entry is needed, e.g. 500 "g" or 2 "cans". Unit
+// is empty for a number of pieces.
+type Quantity struct {
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit,omitempty"`
+}
+
+// metricUnits maps units that can be converted into each other to their base
+// unit and factor.
+var metricUnits = map[string]struct {
+	base   string
+	factor float64
+}{
+	"mg": {"g", 0.001}, "g": {"g", 1}, "kg": {"g", 1000},
+	"ml": {"ml", 1}, "cl": {"ml", 10}, "dl": {"ml", 100}, "l": {"ml", 1000},
+}
+
+// Add returns the sum of two quantities in the unit of q. It reports false if
+// the units cannot be converted into each other, like "g" and "cup".
+func (q Quantity) Add(other Quantity) (sum Quantity, ok bool) {
+	if q.Unit == other.Unit {
+		return Quantity{Amount: q.Amount + other.Amount, Unit: q.Unit}, true
+	}
+	from, fromOk := metricUnits[other.Unit]
+	to, toOk := metricUnits[q.Unit]
+	if !fromOk || !toOk || from.base != to.base {
+		return q, false
+	}
+	amount := q.Amount + other.Amount*from.factor/to.factor
+	return Quantity{Amount: math.Round(amount*1000) / 1000, Unit: q.Unit}, true
+}
+
+// Scale returns the quantity multiplied by factor.
+func (q Quantity) Scale(factor float64) Quantity {
+	return Quantity{Amount: math.Round(q.Amount*factor*1000) / 1000, Unit: q.Unit}
+}
+
+// Price is an amount of money in minor units, e.g. cents, with its ISO 4217
+// currency code.
+type Price struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Attachment is an image attached to an entry. The image and its thumbnail
+// are kept in the blob store under Key and ThumbnailKey.
+type Attachment struct {
+	Id           int       `json:"id"`
+	EntryId      int       `json:"entryId"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	ContentType  string    `json:"contentType"`
+	Size         int       `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Staple is an item that is added to a list again and again, following its
+// recurrence.
+type Staple struct {
+	Id         int        `json:"id"`
+	ListId     int        `json:"listId"`
+	Text       string     `json:"text"`
+	Category   string     `json:"category"`
+	Recurrence Recurrence `json:"recurrence"`
+	NextAt     time.Time  `json:"nextAt"`
+	CreatedBy  int        `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Recurrence repeats either every Days days or weekly on Weekday.
+type Recurrence struct {
+	Days    int           `json:"days,omitempty"`
+	Weekday *time.Weekday `json:"weekday,omitempty"`
+}
+
+// Next returns the first occurrence after t. Occurrences are at midnight in
+// the location of t.
+func (r Recurrence) Next(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if r.Weekday != nil {
+		days := (int(*r.Weekday) - int(day.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return day.AddDate(0, 0, days)
+	}
+	return day.AddDate(0, 0, max(r.Days, 1))
+}
+
+// Upcoming is a staple that is due to be added to its list at At.
+type Upcoming struct {
+	Staple Staple    `json:"staple"`
+	At     time.Time `json:"at"`
+}
+
+// CategoryRule puts new entries of a list whose text contains Keyword into
+// Category, taking precedence over the list history and the built-in
+// dictionary.
+type CategoryRule struct {
+	Id        int       `json:"id"`
+	ListId    int       `json:"listId"`
+	Keyword   string    `json:"keyword"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const (
+	SearchResultEntry = "entry"
+	SearchResultList  = "list"
+)
+
+// SearchResult is an entry or a list matching a search. Entry is only set for
+// entries and may be completed or in the trash.
+type SearchResult struct {
+	Type       string      `json:"type"`
+	ListId     int         `json:"listId"`
+	ListName   string      `json:"listName"`
+	Entry      *Entry      `json:"entry,omitempty"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Highlight is a field of a search result as HTML, with the matched terms
+// wrapped in <mark> elements.
+type Highlight struct {
+	Field string `json:"field"`
+	Text  string `json:"text"`
+}
+
+// SearchPage is one page of search results. NextOffset is the offset of the
+// next page, or 0 if this is the last one.
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	NextOffset int            `json:"nextOffset,omitempty"`
+}
+
+// Suggestion is a completion for an entry text, with the category the item was
+// last put into.
+type Suggestion struct {
+	Text     string    `json:"text"`
+	Category string    `json:"category"`
+	Count    int       `json:"count"`
+	LastUsed time.Time `json:"lastUsed"`
 }
 
 type User struct {
 	Id           int    `json:"id"`
 	Username     string `json:"username"`
-	PasswordHash string `json:"passwordHash,omitempty"`
+	PasswordHash string `json:"-"`
 }
 
 type ListMember struct {
@@ -33,11 +229,94 @@ type ListMember struct {
 	UserId int
 }
 
+// Member is a member of a list with their role in it.
+type Member struct {
+	User
+	Role string `json:"role"`
+}
+
 type Invitation struct {
-	Token   string `json:"token"`
-	Inviter User   `json:"inviter"`
-	Invitee User   `json:"invitee"`
-	List    List   `json:"list"`
+	Token       string     `json:"token"`
+	Inviter     User       `json:"inviter"`
+	Invitee     User       `json:"invitee"`
+	List        List       `json:"list"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+}
+
+// Invitations start out pending and end up in one of the other states.
+// RespondedAt is when that happened, except for expired invitations.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// InviteLink lets anyone who opens its URL join a list with Role, until it
+// expires, has been used MaxUses times or is revoked. A MaxUses of 0 means
+// any number of uses.
+type InviteLink struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url,omitempty"`
+	List      List       `json:"list"`
+	Creator   User       `json:"creator"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"maxUses,omitempty"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// JoinRequest is a user asking to become a member of a list, which members
+// who may invite to the list approve or reject.
+type JoinRequest struct {
+	Id          int        `json:"id"`
+	List        List       `json:"list"`
+	User        User       `json:"user"`
+	Message     string     `json:"message,omitempty"`
+	Status      string     `json:"status"`
+	Responder   *User      `json:"responder,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+}
+
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// Usable reports whether the link can still be used to join its list.
+func (l InviteLink) Usable(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt) && (l.MaxUses == 0 || l.Uses < l.MaxUses)
+}
+
+const (
+	ActionCreated     = "created"
+	ActionEdited      = "edited"
+	ActionCompleted   = "completed"
+	ActionUncompleted = "uncompleted"
+	ActionMoved       = "moved"
+	ActionDeleted     = "deleted"
+	ActionRestored    = "restored"
+)
+
+// Activity is a recorded change of an entry, with the entry as it was before
+// and after the change.
+type Activity struct {
+	Id        int       `json:"id"`
+	EntryId   int       `json:"entryId"`
+	ListId    int       `json:"listId"`
+	User      User      `json:"user"`
+	Action    string    `json:"action"`
+	Before    *Entry    `json:"before,omitempty"`
+	After     *Entry    `json:"after,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type Session struct {
@@ -47,8 +326,333 @@ type Session struct {
 	ExpiresAt time.Time `json:"expiresAt,omitempty"`
 }
 
+const (
+	EventEntryAdded         = "entry.added"
+	EventEntryUpdated       = "entry.updated"
+	EventEntryCompleted     = "entry.completed"
+	EventEntryMoved         = "entry.moved"
+	EventEntryDeleted       = "entry.deleted"
+	EventEntriesCleared     = "entries.cleared"
+	EventEntriesCompleted   = "entries.completed"
+	EventEntriesMoved       = "entries.moved"
+	EventEntriesDeleted     = "entries.deleted"
+	EventEntryRestored      = "entry.restored"
+	EventEntriesRestored    = "entries.restored"
+	EventEntriesAdded       = "entries.added"
+	EventMemberJoined       = "member.joined"
+	EventInvitationSent     = "invitation.sent"
+	EventInvitationAccepted = "invitation.accepted"
+	EventInvitationDeclined = "invitation.declined"
+	EventJoinRequested      = "join.requested"
+	EventJoinApproved       = "join.approved"
+	EventJoinRejected       = "join.rejected"
+	EventMemberLeft         = "member.left"
+	EventMemberRemoved      = "member.removed"
+	EventMemberPromoted     = "member.promoted"
+	EventOwnerChanged       = "owner.changed"
+	EventListUpdated        = "list.updated"
+	EventListArchived       = "list.archived"
+	EventListUnarchived     = "list.unarchived"
+	EventListDeleted        = "list.deleted"
+	EventListRestored       = "list.restored"
+	EventWebhookTest        = "webhook.test"
+)
+
+// Undo identifies a deletion that can be reverted until the trash is purged.
+type Undo struct {
+	Token     string    `json:"token"`
+	ListId    int       `json:"listId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Event struct {
+	Type      string    `json:"type"`
+	ListId    int       `json:"listId"`
+	User      User      `json:"user"`
+	Data      any       `json:"data,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EntryBatch summarises a bulk operation on the entries of a list.
+type EntryBatch struct {
+	Ids          []int  `json:"ids"`
+	Category     string `json:"category,omitempty"`
+	Completed    bool   `json:"completed,omitempty"`
+	TargetListId int    `json:"targetListId,omitempty"`
+	Undo         *Undo  `json:"undo,omitempty"`
+}
+
+// Notification tells a user about an event they may have missed. Its Type and
+// Data are those of the event.
+type Notification struct {
+	Id        int             `json:"id"`
+	Type      string          `json:"type"`
+	ListId    int             `json:"listId,omitempty"`
+	Actor     User            `json:"actor"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	ReadAt    *time.Time      `json:"readAt,omitempty"`
+}
+
+// NotificationTypes are the types of events users are notified about, each of
+// which they can turn off.
+var NotificationTypes = []string{
+	EventInvitationSent,
+	EventInvitationAccepted,
+	EventInvitationDeclined,
+	EventJoinRequested,
+	EventJoinApproved,
+	EventJoinRejected,
+	EventMemberJoined,
+	EventMemberLeft,
+	EventMemberRemoved,
+	EventEntryAdded,
+	EventEntriesAdded,
+	EventListDeleted,
+}
+
+// PushSubscription is a browser or device a user receives Web Push messages
+// on. P256dh and Auth are its encryption keys in URL-safe base64.
+type PushSubscription struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"-"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"-"`
+	Auth      string    `json:"-"`
+	Device    string    `json:"device,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PushMessage is the payload of a Web Push message about an event. Messages
+// about entries added to the same list shortly after each other are merged
+// into one, which lists all of their Items. Actor is empty if the items were
+// added by different users. Title and Body are filled in when it is sent.
+type PushMessage struct {
+	Type     string   `json:"type"`
+	ListId   int      `json:"listId,omitempty"`
+	ListName string   `json:"listName,omitempty"`
+	Actor    string   `json:"actor,omitempty"`
+	Items    []string `json:"items,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Body     string   `json:"body,omitempty"`
+}
+
+// Merge adds the items of a message that was sent shortly after m to it.
+func (m PushMessage) Merge(next PushMessage) PushMessage {
+	if m.Actor != next.Actor {
+		m.Actor = ""
+	}
+	m.Items = append(m.Items, next.Items...)
+	return m
+}
+
+// PushDelivery is a queued push message for a subscription.
+type PushDelivery struct {
+	Id           int
+	Subscription PushSubscription
+	Message      PushMessage
+	Attempts     int
+}
+
+// EmailSettings are the email address of a user and the mails they want to
+// get besides password resets: notifications of invitations, and a digest of
+// the open entries of their lists. The UnsubscribeToken turns both off from a
+// link in the mails.
+type EmailSettings struct {
+	User             User       `json:"-"`
+	Email            string     `json:"email"`
+	Notifications    bool       `json:"notifications"`
+	Digest           string     `json:"digest"`
+	DigestSentAt     *time.Time `json:"digestSentAt,omitempty"`
+	UnsubscribeToken string     `json:"-"`
+	// Verified tells whether the user has confirmed that the address is
+	// theirs. No mails but the one to verify it are sent to it before.
+	Verified          bool   `json:"verified"`
+	VerificationToken string `json:"-"`
+}
+
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var Digests = []string{DigestOff, DigestDaily, DigestWeekly}
+
+// Webhook is a URL the entry and membership events of a list are posted to,
+// signed with its Secret. It receives the WebhookEvents in Events, or all of
+// them if Events is empty. The secret is only shown when the webhook is added.
+type Webhook struct {
+	Id        int       `json:"id"`
+	ListId    int       `json:"listId"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedBy int       `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var WebhookEvents = []string{
+	EventEntryAdded, EventEntryUpdated, EventEntryCompleted, EventEntryMoved, EventEntryDeleted,
+	EventEntryRestored, EventEntriesAdded, EventEntriesCleared, EventEntriesCompleted, EventEntriesMoved,
+	EventEntriesDeleted, EventEntriesRestored, EventMemberJoined, EventMemberLeft,
+	EventMemberRemoved, EventMemberPromoted, EventOwnerChanged,
+}
+
+// Receives reports whether the webhook is subscribed to an event type. Test
+// events are sent to every webhook.
+func (w Webhook) Receives(eventType string) bool {
+	if eventType == EventWebhookTest {
+		return true
+	}
+	if !slices.Contains(WebhookEvents, eventType) {
+		return false
+	}
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var DeliveryStatuses = []string{DeliveryPending, DeliveryDelivered, DeliveryFailed}
+
+// WebhookDelivery is an event queued for a webhook, and the log of the
+// attempts to deliver it. ResponseStatus and Error describe the last attempt.
+type WebhookDelivery struct {
+	Id             int             `json:"id"`
+	WebhookId      int             `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// IngestAlias maps the sender of inbound messages, like an email address or a
+// chat user, to the user and list whose entries the messages are added as.
+// Messages are only accepted once the sender confirmed the alias.
+type IngestAlias struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"-"`
+	Sender string `json:"sender"`
+	List   List   `json:"list"`
+	// Code is the code the sender has to send back to confirm the alias. It is
+	// empty once the alias is confirmed.
+	Code      string    `json:"code,omitempty"`
+	Confirmed bool      `json:"confirmed"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Recipe is a recipe of a user, imported from schema.org JSON-LD or entered
+// by hand. The quantities of its ingredients are for Servings servings.
+type Recipe struct {
+	Id          int          `json:"id"`
+	UserId      int          `json:"-"`
+	Name        string       `json:"name"`
+	Servings    int          `json:"servings"`
+	URL         string       `json:"url,omitempty"`
+	Ingredients []Ingredient `json:"ingredients,omitempty"`
+	CreatedAt   *time.Time   `json:"createdAt,omitempty"`
+}
+
+// Ingredient is a line of the ingredients of a recipe and the entry parsed
+// from it.
+type Ingredient struct {
+	Line     string    `json:"line"`
+	Text     string    `json:"text"`
+	Note     string    `json:"note,omitempty"`
+	Quantity *Quantity `json:"quantity,omitempty"`
+}
+
+// Scaled returns the ingredients of the recipe with their quantities scaled
+// from the servings of the recipe to servings.
+func (r Recipe) Scaled(servings int) []Ingredient {
+	ingredients := slices.Clone(r.Ingredients)
+	if servings == r.Servings || r.Servings == 0 {
+		return ingredients
+	}
+	for i, ingredient := range ingredients {
+		if ingredient.Quantity != nil {
+			quantity := ingredient.Quantity.Scale(float64(servings) / float64(r.Servings))
+			ingredients[i].Quantity = &quantity
+		}
+	}
+	return ingredients
+}
+
+// MergeResult is the entries added to a list and the entries whose quantity
+// was increased by merging entries into it.
+type MergeResult struct {
+	Added   []Entry `json:"added"`
+	Updated []Entry `json:"updated"`
+}
+
+// Meal is a recipe planned for a day, in the format 2006-01-02, of the meal
+// plan of a user. Only the id, name and servings of its recipe are set.
+type Meal struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"-"`
+	Date      string    `json:"date"`
+	Recipe    Recipe    `json:"recipe"`
+	Servings  int       `json:"servings"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PantryItem is the stock of something kept at home, on the pantry of the
+// household of a list. Stock below Minimum puts the item on the list, and
+// completing an entry of the item adds its quantity to the stock. ExpiresOn
+// is the day, in the format 2006-01-02, the stock expires.
+type PantryItem struct {
+	Id        int       `json:"id"`
+	ListId    int       `json:"listId"`
+	Name      string    `json:"name"`
+	Stock     float64   `json:"stock"`
+	Unit      string    `json:"unit,omitempty"`
+	Minimum   *float64  `json:"minimum,omitempty"`
+	ExpiresOn string    `json:"expiresOn,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Low reports whether the stock of the item is below its minimum.
+func (item PantryItem) Low() bool {
+	return item.Minimum != nil && item.Stock < *item.Minimum
+}
+
 type Response struct {
 	Success bool   `json:"success,omitempty"`
 	Message string `json:"message,omitempty"`
 	Data    any    `json:"data,omitempty"`
+	Next    string `json:"next,omitempty"`
+}
+
+const (
+	SortCategory = "category"
+	SortName     = "name"
+	SortText     = "text"
+	SortCreated  = "created"
+	SortUpdated  = "updated"
+)
+
+// Filter narrows down, sorts and paginates a collection. Fields that are nil
+// or zero do not restrict it, and a Limit of 0 returns everything after
+// Cursor. Sort names a sort order, which a leading "-" reverses.
+type Filter struct {
+	Archived     *bool
+	Completed    *bool
+	Read         *bool
+	Status       string
+	Category     *string
+	CreatedSince *time.Time
+	CreatedBy    int
+	Sort         string
+	Cursor       string
+	Limit        int
 }
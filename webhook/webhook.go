@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/slh335/shoppinglistserver/netguard"
+)
+
+// ErrForbiddenAddress is returned for webhooks on loopback, private,
+// link-local or unspecified addresses, which would let list owners reach the
+// network of the server.
+var ErrForbiddenAddress = errors.New("error: webhook must not point to a loopback, private or link-local address")
+
+// StatusError is returned when a webhook responds with a status other than
+// 2xx.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error: webhook responded with status %d", e.StatusCode)
+}
+
+// Sign returns the signature of a payload sent at timestamp: the HMAC-SHA256
+// of the timestamp in Unix seconds, a dot and the payload, keyed with the
+// secret of the webhook, in hex. Signing the timestamp lets receivers reject
+// replayed requests.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender posts signed JSON payloads to webhooks.
+type Sender struct {
+	Client *http.Client
+	// AllowPrivate allows webhooks on private addresses, for development.
+	AllowPrivate bool
+}
+
+// NewSender returns a sender whose client only connects to public addresses,
+// unless allowPrivate is set, and does not follow redirects.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	return &Sender{
+		Client:       netguard.NewClient(timeout, allowPrivate),
+		AllowPrivate: allowPrivate,
+	}
+}
+
+// CheckURL checks that a webhook URL is an http or https URL whose host only
+// resolves to public addresses.
+func (s *Sender) CheckURL(ctx context.Context, rawURL string) (err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return errors.New("error: field 'url' must be an http or https URL")
+	}
+	if s.AllowPrivate {
+		return nil
+	}
+	err = netguard.CheckHost(ctx, u.Hostname())
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return ErrForbiddenAddress
+	}
+	if err != nil {
+		return fmt.Errorf("error: host '%s' of the webhook cannot be resolved", u.Hostname())
+	}
+	return nil
+}
+
+// Send posts the payload of a delivery to a webhook and returns the status it
+// responded with, or 0 if it could not be reached.
+func (s *Sender) Send(url, secret string, deliveryId int, event string, payload []byte) (status int, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shoppinglistserver-webhook")
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(deliveryId))
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(secret, now, payload))
+
+	res, err := s.Client.Do(req)
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return 0, ErrForbiddenAddress
+	}
+	if err != nil {
+		return 0, err
+	}
+	// the body is drained so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, &StatusError{StatusCode: res.StatusCode}
+	}
+	return res.StatusCode, nil
+}